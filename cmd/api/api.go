@@ -2,82 +2,160 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/gorilla/mux"
 	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/health"
+	"github.com/strax84mb/go-travel-reactive/internal/metrics"
 	"github.com/strax84mb/go-travel-reactive/internal/services/auth"
+	"github.com/strax84mb/go-travel-reactive/internal/services/webhooks"
 	"github.com/strax84mb/go-travel-reactive/internal/storage"
-	"github.com/strax84mb/go-travel-reactive/internal/web/handlers"
-	"gopkg.in/yaml.v3"
+	"github.com/strax84mb/go-travel-reactive/internal/tracing"
 )
 
 func main() {
-	args := parseArgs(os.Args)
+	opts, err := parseArgs(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 
-	cfg, err := loadConfig(args["config"])
+	cfg, err := app.LoadConfig(opts.configFile, os.Environ())
 	if err != nil {
 		log.Fatalf("could not load config: %s", err.Error())
 	}
 
+	switch strings.Join(opts.command, " ") {
+	case "":
+	case "config print":
+		if err = printConfig(os.Stdout, cfg); err != nil {
+			log.Fatal(err.Error())
+		}
+
+		return
+	default:
+		log.Fatalf("unknown command: %s", strings.Join(opts.command, " "))
+	}
+
 	ctx := context.Background()
-	logger := app.NewLogger()
 
-	repository, err := storage.NewRepository(cfg.API.DbDsn)
+	level, err := app.ParseSeverity(cfg.Log.Level)
 	if err != nil {
-		logger.Error(app.ContextWithError(ctx, err), "can't connect to DB")
+		log.Fatalf("could not configure logger: %s", err.Error())
 	}
 
-	authentication := auth.NewAuthService(repository, logger)
+	sink, err := app.NewSink(cfg.Log)
+	if err != nil {
+		log.Fatalf("could not configure logger: %s", err.Error())
+	}
 
-	r := mux.NewRouter()
-	s := r.PathPrefix("/gotravel/reactivex/v1").Subrouter()
+	defer sink.Close()
 
-	handlers.RegisterTestHandler(s)
-	handlers.RegisterUserHandlers(s, authentication)
+	logger := app.NewLogger(level, sink)
 
-	if err := http.ListenAndServe(cfg.API.Listen, r); err != nil {
-		logger.Error(app.ContextWithError(ctx, err), "can't start server")
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		log.Fatalf("could not configure tracing: %s", err.Error())
 	}
-}
 
-func parseArgs(args []string) map[string]string {
-	if len(args) > 1 {
-		args = args[1:]
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error(app.ContextWithError(ctx, err), "could not flush traces")
+		}
+	}()
+
+	repository, err := storage.NewRepository(ctx, cfg)
+	if err != nil {
+		log.Fatalf("can't connect to DB: %s", err.Error())
 	}
 
-	m := make(map[string]string)
+	authentication := auth.NewAuthService(repository, logger, cfg.Auth.TokenTTL)
 
-	for _, a := range args {
-		switch {
-		case strings.HasPrefix(a, "--config="):
-			m["config"] = strings.TrimPrefix(a, "--config=")
+	probes := health.NewRegistry(cfg.API.HealthTimeout)
+	probes.Register("db", repository.Ping)
+	probes.Register("schema", repository.CheckSchema)
+	probes.Register("migrations", func(ctx context.Context) error {
+		version, err := repository.SchemaVersion(ctx)
+		if err != nil {
+			return err
 		}
+
+		if version != storage.CurrentSchemaVersion {
+			return fmt.Errorf("schema version is %d, expected %d", version, storage.CurrentSchemaVersion)
+		}
+
+		return nil
+	})
+	probes.Register("routes", repository.CheckRouteGraph)
+
+	if err = metrics.RegisterDBStats(repository); err != nil {
+		logger.Error(app.ContextWithError(ctx, err), "can't register DB metrics")
 	}
 
-	if _, ok := m["config"]; !ok {
-		m["config"] = "config.yml"
+	r := newRouter(cfg, repository, authentication, probes, logger)
+
+	if def := cfg.API.Versions.Default; def != "" && def != r.versions.Default() {
+		logger.Warn(app.ContextWithValue(ctx, "version", def), "default API version is not registered, using %s", r.versions.Default())
 	}
 
-	return m
-}
+	serveCtx, cancel := context.WithCancel(ctx)
+
+	store := app.NewConfigStore(opts.configFile, os.Environ(), cfg)
+	store.Subscribe(func(cfg *app.Config) {
+		// level was validated by LoadConfig
+		level, _ := app.ParseSeverity(cfg.Log.Level)
+		logger.SetLevel(level)
+		authentication.SetTokenTTL(cfg.Auth.TokenTTL)
+		probes.SetTimeout(cfg.API.HealthTimeout)
+		r.cors.SetConfig(cfg.API.CORS)
+		r.versions.SetConfig(cfg.API.Versions)
+		r.limiter.SetConfig(cfg.RateLimit)
+	})
+
+	go store.Watch(serveCtx, 0, logger)
+
+	// dispatcher finishes deliveries in flight before repository is closed
+	dispatched := make(chan struct{})
+
+	if cfg.Webhooks.Enabled {
+		go func() {
+			defer close(dispatched)
+			webhooks.NewDispatcher(repository, logger, cfg.Webhooks).Run(serveCtx)
+		}()
+	} else {
+		close(dispatched)
+	}
 
-func loadConfig(file string) (*app.Config, error) {
-	bytes, err := ioutil.ReadFile(file)
+	servers, err := newServers(serveCtx, cfg, r.Handler(), logger)
 	if err != nil {
-		return nil, fmt.Errorf("could not read from file: %w", err)
+		log.Fatalf("could not configure server: %s", err.Error())
+	}
+
+	// event streams never finish on their own and would hold up shutdown
+	servers[0].RegisterOnShutdown(r.bus.Close)
+
+	if err = serve(ctx, servers, cfg.API.Server, probes, logger); err != nil {
+		logger.Error(app.ContextWithError(ctx, err), "server stopped with error")
 	}
 
-	cfg := app.Config{}
+	cancel()
+	<-dispatched
 
-	if err = yaml.Unmarshal(bytes, &cfg); err != nil {
-		return nil, fmt.Errorf("could not unmarshall data: %w", err)
+	if err = repository.Close(); err != nil {
+		logger.Error(app.ContextWithError(ctx, err), "could not close DB")
 	}
 
-	return &cfg, nil
+	logger.Info(ctx, "server stopped")
 }
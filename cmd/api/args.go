@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigFile = "config.yml"
+
+type options struct {
+	configFile string
+	// command is empty when server should be started
+	command []string
+}
+
+// parseArgs accepts flags before and after command words, e.g. "config print --config=prod.yml"
+func parseArgs(args []string) (options, error) {
+	opts := options{}
+
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	fs.StringVar(&opts.configFile, "config", defaultConfigFile, "path to YAML config file")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: api [flags] [command]\n\n")
+		fmt.Fprintf(out, "Commands:\n  config print\tprint effective configuration with secrets redacted\n\n")
+		fmt.Fprintf(out, "Flags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(out, "\nEvery setting can be overridden with environment variable named %s<SECTION>_<KEY>,\n", app.EnvPrefix)
+		fmt.Fprintf(out, "e.g. %sAPI_DBDSN or %sAPI_DBPOOL_MAXOPENCONNS, lists are comma separated.\n", app.EnvPrefix, app.EnvPrefix)
+	}
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return options{}, err
+		}
+
+		if fs.NArg() == 0 {
+			break
+		}
+
+		opts.command = append(opts.command, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	configSet := false
+	fs.Visit(func(f *flag.Flag) {
+		configSet = configSet || f.Name == "config"
+	})
+
+	// defaults and environment are enough when default file is missing
+	if !configSet {
+		if _, err := os.Stat(opts.configFile); errors.Is(err, os.ErrNotExist) {
+			opts.configFile = ""
+		}
+	}
+
+	return opts, nil
+}
+
+func printConfig(w io.Writer, cfg *app.Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(cfg.Redacted()); err != nil {
+		return fmt.Errorf("could not print config: %w", err)
+	}
+
+	return enc.Close()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/health"
+	"github.com/strax84mb/go-travel-reactive/internal/metrics"
+	"github.com/strax84mb/go-travel-reactive/internal/ratelimit"
+	"github.com/strax84mb/go-travel-reactive/internal/services/cities"
+	"github.com/strax84mb/go-travel-reactive/internal/services/routes"
+	"github.com/strax84mb/go-travel-reactive/internal/services/webhooks"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+	"github.com/strax84mb/go-travel-reactive/internal/web/handlers"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
+)
+
+type authService interface {
+	ValidateJwt(ctx context.Context, r *http.Request, expectedRole entity.UserRole) (string, error)
+	Login(ctx context.Context, username, password string) (string, error)
+	SaveUser(ctx context.Context, username, password string) (int, error)
+	TokenSubject(ctx context.Context, r *http.Request) (string, error)
+}
+
+// router serves every API route, parts which follow config reload are kept with it
+type router struct {
+	*mux.Router
+	operations openapi.Operations
+	bus        *events.Bus
+	cors       *web.CORS
+	versions   *web.Versions
+	limiter    *web.RateLimiter
+}
+
+// newRouter registers middleware and handlers of all API versions and OpenAPI document
+func newRouter(cfg *app.Config, repository storage.Repository, authentication authService, probes *health.Registry, logger app.Logger) *router {
+	r := mux.NewRouter()
+	limiter := web.NewRateLimiter(cfg.RateLimit, ratelimit.NewMemoryStore(), authentication, logger)
+
+	r.Use(web.RequestID, web.Tracing, web.AccessLog(logger), web.Metrics, limiter.Middleware, web.MaxBodySize(cfg.API.MaxBodyBytes))
+
+	if cfg.API.Compression.Enabled {
+		r.Use(web.Compress(cfg.API.Compression.MinBytes))
+	}
+
+	r.NotFoundHandler = web.RequestID(web.Tracing(web.AccessLog(logger)(web.Metrics(http.NotFoundHandler()))))
+	r.Methods(http.MethodGet).Path("/metrics").Name("metrics").Handler(metrics.Handler())
+	handlers.RegisterHealthHandlers(r, probes)
+
+	bus := events.NewBus(cfg.API.Events.BufferSize)
+	cors := web.NewCORS(cfg.API.CORS, r)
+	versions := web.NewVersions(r, "/gotravel/reactivex", cfg.API.Versions)
+	cityService := cities.NewCityService(repository, logger, bus, cfg.Webhooks.Enabled)
+	routeService := routes.NewRouteService(repository, logger, bus, cfg.Webhooks.Enabled)
+	webhookService := webhooks.NewWebhookService(repository, logger)
+
+	// versions differ only by shape of cities
+	for _, name := range []string{"v1", "v2"} {
+		v := versions.Register(name)
+
+		handlers.RegisterTestHandler(v)
+		handlers.RegisterUserHandlers(v, authentication)
+		handlers.RegisterStatsHandlers(v, repository, authentication)
+		handlers.RegisterCitiesHandlers(v, cityService, authentication)
+		handlers.RegisterEventHandlers(v, bus, authentication, cfg.API.Events.Heartbeat)
+		handlers.RegisterCommentHandlers(v, cityService, bus, authentication, cfg.API.WebSocket, cors.OriginAllowed)
+		handlers.RegisterRouteHandlers(v, routeService, authentication)
+		handlers.RegisterWebhookHandlers(v, webhookService, authentication)
+	}
+
+	operations := handlers.Operations()
+	handlers.RegisterOpenAPIHandlers(r, operations)
+
+	return &router{
+		Router:     r,
+		operations: operations,
+		bus:        bus,
+		cors:       cors,
+		versions:   versions,
+		limiter:    limiter,
+	}
+}
+
+// Handler applies version negotiation and CORS before routing
+func (r *router) Handler() http.Handler {
+	return r.versions.Handler(r.cors.Handler(r.Router))
+}
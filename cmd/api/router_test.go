@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/health"
+	"github.com/strax84mb/go-travel-reactive/internal/services/auth"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
+)
+
+func newTestRouter(t *testing.T) (*router, storage.Repository) {
+	t.Helper()
+
+	cfg := app.DefaultConfig()
+	cfg.API.DbDriver = storage.DriverMemory
+
+	repo, err := storage.NewRepository(context.Background(), &cfg)
+	if err != nil {
+		t.Fatalf("could not open repository: %s", err.Error())
+	}
+
+	t.Cleanup(func() { _ = repo.Close() })
+
+	logger := app.NewLogger(app.ErrorSeverity, app.NewMemorySink())
+
+	r := newRouter(&cfg, repo, auth.NewAuthService(repo, logger, cfg.Auth.TokenTTL), health.NewRegistry(0), logger)
+	t.Cleanup(r.bus.Close)
+
+	return r, repo
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	undocumented, err := openapi.Undocumented(r.Router, r.operations)
+	if err != nil {
+		t.Fatalf("could not list routes: %s", err.Error())
+	}
+
+	for _, route := range undocumented {
+		t.Errorf("route %s is missing from OpenAPI document", route)
+	}
+}
+
+func TestOpenAPIDocumentIsServed(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestDocsLoadNoThirdPartyAssets(t *testing.T) {
+	r, _ := newTestRouter(t)
+	handler := r.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/init.js", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/openapi.json") {
+		t.Fatalf("unexpected %d response of init.js: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	switch rec.Code {
+	case http.StatusOK:
+		if body := rec.Body.String(); strings.Contains(body, "://") {
+			t.Errorf("page loads remote assets: %s", body)
+		}
+
+		if rec.Header().Get("Content-Security-Policy") == "" {
+			t.Error("page has no Content-Security-Policy")
+		}
+	case http.StatusServiceUnavailable:
+		// swagger-ui-dist is not vendored in this tree
+	default:
+		t.Errorf("unexpected %d response of /docs", rec.Code)
+	}
+}
+
+func TestVersionsServeTheirCityShapes(t *testing.T) {
+	r, repo := newTestRouter(t)
+	ctx := context.Background()
+
+	admin, err := repo.GetUserByUsername(ctx, "admin")
+	if err != nil {
+		t.Fatalf("GetUserByUsername failed: %s", err.Error())
+	}
+
+	now := time.Now().UTC()
+	if _, err = repo.AddComment(ctx, entity.Comment{CityID: 1, PosterID: admin.ID, Text: "Nice", Created: now, Modified: now}); err != nil {
+		t.Fatalf("AddComment failed: %s", err.Error())
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		accept  string
+		version string
+		poster  string
+	}{
+		{name: "v1 path", path: "/gotravel/reactivex/v1/city/1", version: "v1", poster: `"posterUsername":"admin"`},
+		{name: "v2 path", path: "/gotravel/reactivex/v2/city/1", version: "v2", poster: `"poster":{"id":1,"username":"admin"}`},
+		{name: "default", path: "/gotravel/reactivex/city/1", version: "v1", poster: `"posterUsername":"admin"`},
+		{name: "v2 accept", path: "/gotravel/reactivex/city/1", accept: "application/json; version=2", version: "v2", poster: `"poster":{"id":1,"username":"admin"}`},
+		{name: "v2 list", path: "/gotravel/reactivex/v2/city", version: "v2", poster: `"poster":{"id":1,"username":"admin"}`},
+	}
+
+	handler := r.Handler()
+
+	var wg sync.WaitGroup
+
+	for _, tt := range tests {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func(name, path, accept, version, poster string) {
+				defer wg.Done()
+
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				if accept != "" {
+					req.Header.Set("Accept", accept)
+				}
+
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				body := rec.Body.String()
+
+				if rec.Code != http.StatusOK || rec.Header().Get("API-Version") != version || !strings.Contains(body, poster) {
+					t.Errorf("%s: unexpected %d response of %s: %s", name, rec.Code, rec.Header().Get("API-Version"), body)
+				}
+
+				if version == "v2" && strings.Contains(body, "posterUsername") {
+					t.Errorf("%s: v2 has v1 fields: %s", name, body)
+				}
+			}(tt.name, tt.path, tt.accept, tt.version, tt.poster)
+		}
+	}
+
+	wg.Wait()
+}
+
+func TestOperationIDsAreUnique(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid document: %s", err.Error())
+	}
+
+	seen := map[string]string{}
+
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			if other, ok := seen[op.OperationID]; ok {
+				t.Errorf("%s %s has operationId %s of %s", method, path, op.OperationID, other)
+			}
+
+			seen[op.OperationID] = method + " " + path
+		}
+	}
+
+	for _, id := range []string{"v1.getCity", "v2.getCity"} {
+		if _, ok := seen[id]; !ok {
+			t.Errorf("%s is not documented", id)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/health"
+	"github.com/strax84mb/go-travel-reactive/internal/tlsconfig"
+)
+
+const (
+	defaultReadTimeout       = 15 * time.Second
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 60 * time.Second
+	defaultShutdownTimeout   = 30 * time.Second
+)
+
+func orDefault(value, def time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+
+	return def
+}
+
+func newServer(addr string, cfg app.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       orDefault(cfg.ReadTimeout, defaultReadTimeout),
+		ReadHeaderTimeout: orDefault(cfg.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		WriteTimeout:      orDefault(cfg.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       orDefault(cfg.IdleTimeout, defaultIdleTimeout),
+	}
+}
+
+// newServers creates API server and, with TLS enabled, optional redirecting server.
+// Certificate is reloaded until ctx is done.
+func newServers(ctx context.Context, cfg *app.Config, handler http.Handler, logger app.Logger) ([]*http.Server, error) {
+	srv := newServer(cfg.API.Listen, cfg.API.Server, handler)
+	if !cfg.API.TLS.Enabled {
+		return []*http.Server{srv}, nil
+	}
+
+	reloader, err := tlsconfig.NewReloader(cfg.API.TLS.CertFile, cfg.API.TLS.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if srv.TLSConfig, err = tlsconfig.New(cfg.API.TLS, reloader); err != nil {
+		return nil, err
+	}
+
+	go reloader.Watch(ctx, cfg.API.TLS.ReloadInterval, logger)
+
+	if cfg.API.TLS.RedirectListen == "" {
+		return []*http.Server{srv}, nil
+	}
+
+	_, port, err := net.SplitHostPort(cfg.API.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address: %w", err)
+	}
+
+	return []*http.Server{srv, newServer(cfg.API.TLS.RedirectListen, cfg.API.Server, redirectToHTTPS(port))}, nil
+}
+
+// redirectToHTTPS sends clients to the same host and path on HTTPS port
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+func listen(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		// certificate comes from TLSConfig.GetCertificate
+		return srv.ListenAndServeTLS("", "")
+	}
+
+	return srv.ListenAndServe()
+}
+
+// serve runs servers until SIGINT or SIGTERM, then fails readiness for drainDelay
+// and waits up to shutdownTimeout for in-flight requests to finish
+func serve(ctx context.Context, servers []*http.Server, cfg app.ServerConfig, probes *health.Registry, logger app.Logger) error {
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, len(servers))
+
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			errCh <- listen(srv)
+		}(srv)
+
+		logger.Info(ctx, "listening on %s, TLS: %t", srv.Addr, srv.TLSConfig != nil)
+	}
+
+	select {
+	case err := <-errCh:
+		shutdown(servers)
+		return fmt.Errorf("could not start server: %w", err)
+	case <-sigCtx.Done():
+	}
+
+	// second signal kills process without waiting
+	stop()
+
+	logger.Info(ctx, "shutting down")
+	probes.SetDraining()
+
+	time.Sleep(cfg.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), orDefault(cfg.ShutdownTimeout, defaultShutdownTimeout))
+	defer cancel()
+
+	var result error
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			_ = srv.Close()
+			result = errors.Join(result, fmt.Errorf("could not drain connections on %s: %w", srv.Addr, err))
+		}
+	}
+
+	for range servers {
+		if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+			result = errors.Join(result, err)
+		}
+	}
+
+	return result
+}
+
+// shutdown closes servers which are still running after one of them failed
+func shutdown(servers []*http.Server) {
+	for _, srv := range servers {
+		_ = srv.Close()
+	}
+}
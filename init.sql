@@ -1,3 +1,7 @@
+DROP TABLE IF EXISTS schema_version;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
+DROP TABLE IF EXISTS outbox;
 DROP TABLE IF EXISTS routes;
 DROP TABLE IF EXISTS airports;
 DROP TABLE IF EXISTS comments;
@@ -24,6 +28,7 @@ CREATE TABLE cities (
                         id INTEGER NOT NULL AUTO_INCREMENT,
                         `name` VARCHAR(100) NOT NULL,
                         country VARCHAR(100) NOT NULL,
+                        version INTEGER NOT NULL DEFAULT 1,
                         PRIMARY KEY (id)
 );
 
@@ -62,4 +67,47 @@ CREATE TABLE routes (
                         FOREIGN KEY (source_id) REFERENCES airports(id),
                         FOREIGN KEY (destination_id) REFERENCES airports(id),
                         PRIMARY KEY (id)
-);
\ No newline at end of file
+);
+
+-- times of outbox and webhooks are unix milliseconds so that they compare the same way in every backend
+CREATE TABLE outbox (
+                        id INTEGER NOT NULL AUTO_INCREMENT,
+                        topic VARCHAR(50) NOT NULL,
+                        event_type VARCHAR(20) NOT NULL,
+                        payload TEXT NOT NULL,
+                        created BIGINT NOT NULL,
+                        dispatched BIGINT NULL,
+                        PRIMARY KEY (id),
+                        INDEX idx_outbox_dispatched (dispatched, id)
+);
+
+CREATE TABLE webhook_subscriptions (
+                                       id INTEGER NOT NULL AUTO_INCREMENT,
+                                       url VARCHAR(500) NOT NULL,
+                                       secret VARCHAR(100) NOT NULL,
+                                       topics VARCHAR(255) NOT NULL DEFAULT '',
+                                       created BIGINT NOT NULL,
+                                       PRIMARY KEY (id)
+);
+
+CREATE TABLE webhook_deliveries (
+                                    id INTEGER NOT NULL AUTO_INCREMENT,
+                                    event_id INTEGER NOT NULL,
+                                    subscription_id INTEGER NOT NULL,
+                                    status VARCHAR(15) NOT NULL,
+                                    attempts INTEGER NOT NULL DEFAULT 0,
+                                    next_attempt BIGINT NOT NULL,
+                                    last_error VARCHAR(255) NOT NULL DEFAULT '',
+                                    updated BIGINT NOT NULL,
+                                    FOREIGN KEY (event_id) REFERENCES outbox(id),
+                                    FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+                                    PRIMARY KEY (id),
+                                    INDEX idx_webhook_deliveries_due (status, next_attempt)
+);
+
+-- version of schema created by this script, service migrates older databases and writes their version on start
+CREATE TABLE schema_version (
+                                version INTEGER NOT NULL
+);
+
+INSERT INTO schema_version (version) VALUES (2);
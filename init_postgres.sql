@@ -0,0 +1,102 @@
+DROP TABLE IF EXISTS schema_version;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS routes;
+DROP TABLE IF EXISTS airports;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS cities;
+DROP TABLE IF EXISTS users;
+
+CREATE TABLE users (
+                       id SERIAL PRIMARY KEY,
+                       username VARCHAR(30) UNIQUE NOT NULL,
+                       password VARCHAR(200) NOT NULL,
+                       salt VARCHAR(100) NOT NULL,
+                       role VARCHAR(15) NOT NULL
+);
+
+INSERT INTO users (username, password, salt, role) VALUES
+('admin',
+ '92766f4ade6d45666bd4c26798a39c974874c118bd4d95815b62a548988fd7db33060246e2555bf93328d5dfabd3ffbd799efafbe4b9e775ca46d005fe0932072857d6e63173fa2c41ccd10d194bfef8',
+ '92766f4ade6d45666bd4c26798a39c97',
+ 'ADMIN');
+
+CREATE TABLE cities (
+                        id SERIAL PRIMARY KEY,
+                        name VARCHAR(100) NOT NULL,
+                        country VARCHAR(100) NOT NULL,
+                        version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX idx_cities_name_country ON cities (LOWER(name), LOWER(country));
+
+INSERT INTO cities (name, country) VALUES
+                                       ('Beograd', 'Srbija'),
+                                       ('New York', 'USA'),
+                                       ('Paris', 'France'),
+                                       ('Berlin', 'Deutchland'),
+                                       ('Zagreb', 'Hrvatska');
+
+CREATE TABLE comments (
+                          id SERIAL PRIMARY KEY,
+                          city_id INTEGER NOT NULL REFERENCES cities(id) ON DELETE CASCADE,
+                          poster_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                          text VARCHAR(255) NOT NULL,
+                          created TIMESTAMP NOT NULL,
+                          modified TIMESTAMP NOT NULL
+);
+
+CREATE TABLE airports (
+                          id SERIAL PRIMARY KEY,
+                          airport_id INTEGER UNIQUE NOT NULL,
+                          name VARCHAR(100) NOT NULL,
+                          city_id INTEGER NOT NULL REFERENCES cities(id)
+);
+
+CREATE TABLE routes (
+                        id SERIAL PRIMARY KEY,
+                        source_id INTEGER NOT NULL REFERENCES airports(id),
+                        destination_id INTEGER NOT NULL REFERENCES airports(id),
+                        price REAL NOT NULL
+);
+
+-- times of outbox and webhooks are unix milliseconds so that they compare the same way in every backend
+CREATE TABLE outbox (
+                        id SERIAL PRIMARY KEY,
+                        topic VARCHAR(50) NOT NULL,
+                        event_type VARCHAR(20) NOT NULL,
+                        payload TEXT NOT NULL,
+                        created BIGINT NOT NULL,
+                        dispatched BIGINT NULL
+);
+
+CREATE INDEX idx_outbox_dispatched ON outbox (dispatched, id);
+
+CREATE TABLE webhook_subscriptions (
+                                       id SERIAL PRIMARY KEY,
+                                       url VARCHAR(500) NOT NULL,
+                                       secret VARCHAR(100) NOT NULL,
+                                       topics VARCHAR(255) NOT NULL DEFAULT '',
+                                       created BIGINT NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+                                    id SERIAL PRIMARY KEY,
+                                    event_id INTEGER NOT NULL REFERENCES outbox(id),
+                                    subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+                                    status VARCHAR(15) NOT NULL,
+                                    attempts INTEGER NOT NULL DEFAULT 0,
+                                    next_attempt BIGINT NOT NULL,
+                                    last_error VARCHAR(255) NOT NULL DEFAULT '',
+                                    updated BIGINT NOT NULL
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt);
+
+-- version of schema created by this script, service migrates older databases and writes their version on start
+CREATE TABLE schema_version (
+                                version INTEGER NOT NULL
+);
+
+INSERT INTO schema_version (version) VALUES (2);
@@ -1,8 +1,203 @@
 package app
 
+import "time"
+
+// Config is loaded by LoadConfig, settings tagged with reload:"true" can be changed
+// while server is running, tag on struct field applies to all of its settings
 type Config struct {
 	API struct {
-		Listen string `yaml:"listen"`
-		DbDsn  string `yaml:"dbDsn"`
+		Listen   string `yaml:"listen"`
+		DbDriver string `yaml:"dbDriver"`
+		DbDsn    string `yaml:"dbDsn"`
+		DbPool   DbPool `yaml:"dbPool"`
+		// HealthTimeout limits each readiness check
+		HealthTimeout time.Duration `yaml:"healthTimeout" reload:"true"`
+		// MaxBodyBytes limits JSON request bodies
+		MaxBodyBytes int64             `yaml:"maxBodyBytes"`
+		Compression  CompressionConfig `yaml:"compression"`
+		Server       ServerConfig      `yaml:"server"`
+		TLS          TLSConfig         `yaml:"tls"`
+		CORS         CORSConfig        `yaml:"cors" reload:"true"`
+		// Versions selects default API version and deprecates old ones
+		Versions  VersionsConfig  `yaml:"versions" reload:"true"`
+		Events    EventsConfig    `yaml:"events"`
+		WebSocket WebSocketConfig `yaml:"webSocket"`
 	} `yaml:"api"`
+	Auth      AuthConfig      `yaml:"auth" reload:"true"`
+	RateLimit RateLimitConfig `yaml:"rateLimit" reload:"true"`
+	Log       LogConfig       `yaml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Webhooks  WebhooksConfig  `yaml:"webhooks"`
+}
+
+// RateLimitConfig limits requests per client, client is identified by accepted X-API-Key,
+// then by user from verified JWT and then by IP address
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// APIKeys are accepted X-API-Key values
+	APIKeys []string `yaml:"apiKeys"`
+	// Default applies to requests which don't belong to any group
+	Default RateLimit `yaml:"default"`
+	// Groups are matched in order by path prefix, prefix without API version like
+	// /gotravel/reactivex/user/login matches every version
+	Groups []RateLimitGroup `yaml:"groups"`
+}
+
+// RateLimit allows Requests per Period with bursts of up to Burst requests, zero Requests disables limit
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	Burst    int           `yaml:"burst"`
+}
+
+type RateLimitGroup struct {
+	Name         string    `yaml:"name"`
+	PathPrefixes []string  `yaml:"pathPrefixes"`
+	Limit        RateLimit `yaml:"limit"`
+	// ByIP limits every caller by IP address, also ones with API key or token,
+	// it is meant for routes which need no authentication like login
+	ByIP bool `yaml:"byIP"`
+}
+
+// AuthConfig configures issued tokens
+type AuthConfig struct {
+	TokenTTL time.Duration `yaml:"tokenTTL"`
+}
+
+// LogConfig selects minimum level and output of application logger
+type LogConfig struct {
+	// Level is one of debug, info, warn or error
+	Level string `yaml:"level" reload:"true"`
+	// Output is one of stdout, stderr or file
+	Output string `yaml:"output"`
+	// File, MaxSizeMB and MaxBackups are used when output is file
+	File       string `yaml:"file"`
+	MaxSizeMB  int    `yaml:"maxSizeMB"`
+	MaxBackups int    `yaml:"maxBackups"`
+}
+
+// TracingConfig selects where spans are exported
+type TracingConfig struct {
+	// Exporter is one of none, stdout or otlp
+	Exporter string `yaml:"exporter"`
+	// Endpoint is host:port of OTLP HTTP receiver
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	ServiceName string  `yaml:"serviceName"`
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+// ServerConfig holds HTTP server timeouts, zero values are replaced with defaults
+type ServerConfig struct {
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+	// DrainDelay is time between readiness turning false and server refusing new connections
+	DrainDelay time.Duration `yaml:"drainDelay"`
+	// ShutdownTimeout limits waiting for in-flight requests to finish
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+}
+
+// TLSConfig enables HTTPS on api.listen
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// MinVersion is 1.2 or 1.3
+	MinVersion string `yaml:"minVersion"`
+	// CipherSuites limits TLS 1.2 suites by Go names, empty list keeps Go defaults
+	CipherSuites []string `yaml:"cipherSuites"`
+	// ClientAuth is none, optional or require, client certificates are verified against ClientCAFile
+	ClientAuth   string `yaml:"clientAuth"`
+	ClientCAFile string `yaml:"clientCAFile"`
+	// ReloadInterval is how often certificate files are checked for changes
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+	// RedirectListen is address of plain HTTP listener which redirects to HTTPS, empty disables it
+	RedirectListen string `yaml:"redirectListen"`
+}
+
+// CORSConfig lists cross-origin callers, empty AllowedOrigins disables CORS
+type CORSConfig struct {
+	// AllowedOrigins accepts exact origins, one * wildcard like https://*.example.com or * for any origin
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+	// AllowedMethods defaults to GET, HEAD, POST, PUT, PATCH and DELETE
+	AllowedMethods []string `yaml:"allowedMethods"`
+	// AllowedHeaders are request headers besides CORS-safelisted ones, * allows any
+	AllowedHeaders   []string      `yaml:"allowedHeaders"`
+	ExposedHeaders   []string      `yaml:"exposedHeaders"`
+	AllowCredentials bool          `yaml:"allowCredentials"`
+	MaxAge           time.Duration `yaml:"maxAge"`
+}
+
+// CompressionConfig enables brotli and gzip responses negotiated from Accept-Encoding
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MinBytes is size of smallest body which is compressed
+	MinBytes int `yaml:"minBytes"`
+}
+
+// EventsConfig configures feed of entity changes
+type EventsConfig struct {
+	// BufferSize is number of latest events kept for clients resuming with Last-Event-ID
+	BufferSize int `yaml:"bufferSize"`
+	// Heartbeat is interval of messages which keep idle connections open
+	Heartbeat time.Duration `yaml:"heartbeat"`
+}
+
+// WebSocketConfig configures WebSocket connections
+type WebSocketConfig struct {
+	// SendBuffer is number of messages connection may fall behind before it is closed
+	SendBuffer int `yaml:"sendBuffer"`
+	// PingInterval has to be shorter than PongTimeout, connection is closed when client
+	// sends nothing, pongs included, for PongTimeout
+	PingInterval time.Duration `yaml:"pingInterval"`
+	PongTimeout  time.Duration `yaml:"pongTimeout"`
+	// MaxMessageBytes limits messages sent by client
+	MaxMessageBytes int64 `yaml:"maxMessageBytes"`
+}
+
+// WebhooksConfig configures delivery of outbox events to webhook subscriptions,
+// events are recorded only while delivery is enabled
+type WebhooksConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// PollInterval is pause between checks for new events and due deliveries
+	PollInterval time.Duration `yaml:"pollInterval"`
+	// BatchSize limits events and deliveries handled by one check
+	BatchSize int `yaml:"batchSize"`
+	// Timeout limits one delivery request
+	Timeout time.Duration `yaml:"timeout"`
+	// Workers is number of deliveries sent at once
+	Workers int `yaml:"workers"`
+	// MaxAttempts failed attempts make delivery dead until it is replayed
+	MaxAttempts int `yaml:"maxAttempts"`
+	// InitialBackoff is doubled after every failed attempt up to MaxBackoff
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+}
+
+// VersionsConfig is applied to versions registered by main
+type VersionsConfig struct {
+	// Default serves requests which name version neither in path nor in Accept header,
+	// latest version is used when it is empty
+	Default string `yaml:"default"`
+	// Deprecated versions keep working and announce their end in response headers
+	Deprecated []DeprecatedVersion `yaml:"deprecated"`
+}
+
+// DeprecatedVersion is announced with Deprecation header since Since and Sunset header when Sunset is set
+type DeprecatedVersion struct {
+	Name   string    `yaml:"name"`
+	Since  time.Time `yaml:"since"`
+	Sunset time.Time `yaml:"sunset"`
+}
+
+// DbPool configures sql.DB connection pool, zero values keep defaults
+type DbPool struct {
+	MaxOpenConns    int           `yaml:"maxOpenConns"`
+	MaxIdleConns    int           `yaml:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"connMaxIdleTime"`
+	// PingTimeout limits how long startup keeps retrying to reach the database
+	PingTimeout time.Duration `yaml:"pingTimeout"`
 }
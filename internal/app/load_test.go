@@ -0,0 +1,254 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const dsnEnv = "GOTRAVEL_API_DBDSN=postgres://travel:secret@db:5432/travel"
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("could not write config: %s", err.Error())
+	}
+
+	return file
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	const file = `
+api:
+  listen: ":9000"
+  dbDsn: "file-dsn"
+  cors:
+    allowedOrigins: ["https://file.example"]
+log:
+  level: warn
+rateLimit:
+  default:
+    requests: 10
+`
+
+	tests := []struct {
+		name    string
+		file    string
+		environ []string
+		check   func(t *testing.T, cfg *Config)
+	}{
+		{
+			name:    "defaults",
+			environ: []string{dsnEnv},
+			check: func(t *testing.T, cfg *Config) {
+				want := DefaultConfig()
+				want.API.DbDsn = "postgres://travel:secret@db:5432/travel"
+
+				if !reflect.DeepEqual(*cfg, want) {
+					t.Errorf("expected defaults, got %+v", *cfg)
+				}
+			},
+		},
+		{
+			name: "file over defaults",
+			file: file,
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.API.Listen != ":9000" || cfg.Log.Level != "warn" || cfg.RateLimit.Default.Requests != 10 {
+					t.Errorf("file was not applied: %+v", *cfg)
+				}
+
+				if cfg.RateLimit.Default.Burst != 200 || cfg.API.Server.ReadTimeout != 15*time.Second {
+					t.Errorf("settings missing from file lost defaults: %+v", *cfg)
+				}
+			},
+		},
+		{
+			name: "env over file",
+			file: file,
+			environ: []string{
+				"GOTRAVEL_API_LISTEN=:9100",
+				"GOTRAVEL_LOG_LEVEL=debug",
+				"GOTRAVEL_RATELIMIT_DEFAULT_REQUESTS=20",
+				"GOTRAVEL_API_CORS_ALLOWEDORIGINS=https://a.example, https://b.example",
+				"GOTRAVEL_API_SERVER_READTIMEOUT=3s",
+				"GOTRAVEL_TRACING_SAMPLERATIO=0.5",
+				"OTHER_API_LISTEN=:1",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.API.Listen != ":9100" || cfg.Log.Level != "debug" || cfg.RateLimit.Default.Requests != 20 {
+					t.Errorf("env was not applied over file: %+v", *cfg)
+				}
+
+				if origins := cfg.API.CORS.AllowedOrigins; !reflect.DeepEqual(origins, []string{"https://a.example", "https://b.example"}) {
+					t.Errorf("unexpected origins %v", origins)
+				}
+
+				if cfg.API.Server.ReadTimeout != 3*time.Second || cfg.Tracing.SampleRatio != 0.5 {
+					t.Errorf("duration or float from env was not applied: %+v", *cfg)
+				}
+
+				if cfg.API.DbDsn != "file-dsn" {
+					t.Errorf("file value without env override was lost: %s", cfg.API.DbDsn)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = writeConfig(t, tt.file)
+			}
+
+			cfg, err := LoadConfig(path, tt.environ)
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %s", err.Error())
+			}
+
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestReloadableSettings(t *testing.T) {
+	cfg := DefaultConfig()
+	reloadable := map[string]bool{}
+
+	for _, s := range settings(reflect.ValueOf(&cfg).Elem(), nil) {
+		reloadable[s.name()] = s.reloadable
+	}
+
+	tests := map[string]bool{
+		"api.healthTimeout":          true,
+		"api.cors.allowedOrigins":    true,
+		"api.versions.default":       true,
+		"auth.tokenTTL":              true,
+		"rateLimit.apiKeys":          true,
+		"rateLimit.default.requests": true,
+		"log.level":                  true,
+		"api.listen":                 false,
+		"api.dbDsn":                  false,
+		"api.dbPool.maxOpenConns":    false,
+		"api.tls.certFile":           false,
+		"log.output":                 false,
+	}
+
+	for name, want := range tests {
+		got, ok := reloadable[name]
+		if !ok {
+			t.Errorf("%s is not a setting", name)
+			continue
+		}
+
+		if got != want {
+			t.Errorf("%s: expected reloadable %t, got %t", name, want, got)
+		}
+	}
+}
+
+func TestReloadFromFile(t *testing.T) {
+	path := writeConfig(t, "api:\n  dbDsn: dsn\nlog:\n  level: info\n")
+
+	cfg, err := LoadConfig(path, nil)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %s", err.Error())
+	}
+
+	store := NewConfigStore(path, nil, cfg)
+	logger := NewLogger(ErrorSeverity, NewMemorySink())
+
+	if err = os.WriteFile(path, []byte("api:\n  dbDsn: dsn\nlog:\n  level: debug\n"), 0o600); err != nil {
+		t.Fatalf("could not write config: %s", err.Error())
+	}
+
+	if err = store.Reload(context.Background(), logger); err != nil {
+		t.Fatalf("Reload failed: %s", err.Error())
+	}
+
+	if store.Current().Log.Level != "debug" {
+		t.Errorf("reloadable setting was not applied: %s", store.Current().Log.Level)
+	}
+
+	if err = os.WriteFile(path, []byte("api:\n  dbDsn: dsn\n  listen: \":9000\"\nlog:\n  level: warn\n"), 0o600); err != nil {
+		t.Fatalf("could not write config: %s", err.Error())
+	}
+
+	if err = store.Reload(context.Background(), logger); err == nil || !strings.Contains(err.Error(), "api.listen") {
+		t.Fatalf("expected api.listen to be rejected, got %v", err)
+	}
+
+	if current := store.Current(); current.Log.Level != "debug" || current.API.Listen != ":8081" {
+		t.Errorf("rejected reload changed config: %+v", *current)
+	}
+}
+
+func TestLoadConfigRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		environ []string
+		errors  []string
+	}{
+		{name: "missing dsn", errors: []string{"api.dbDsn: is required"}},
+		{name: "memory needs no dsn", environ: []string{"GOTRAVEL_API_DBDRIVER=memory"}},
+		{name: "unknown driver", environ: []string{dsnEnv, "GOTRAVEL_API_DBDRIVER=oracle"}, errors: []string{"api.dbDriver: must be one of"}},
+		{name: "bad listen", environ: []string{dsnEnv, "GOTRAVEL_API_LISTEN=8081"}, errors: []string{"api.listen: must be host:port"}},
+		{name: "bad number", environ: []string{dsnEnv, "GOTRAVEL_API_MAXBODYBYTES=big"}, errors: []string{"GOTRAVEL_API_MAXBODYBYTES"}},
+		{name: "bad duration", environ: []string{dsnEnv, "GOTRAVEL_AUTH_TOKENTTL=1 hour"}, errors: []string{"GOTRAVEL_AUTH_TOKENTTL"}},
+		{name: "bad bool", environ: []string{dsnEnv, "GOTRAVEL_RATELIMIT_ENABLED=maybe"}, errors: []string{"GOTRAVEL_RATELIMIT_ENABLED"}},
+		{name: "negative", environ: []string{dsnEnv, "GOTRAVEL_API_MAXBODYBYTES=-1"}, errors: []string{"api.maxBodyBytes: must not be negative"}},
+		{name: "sample ratio", environ: []string{dsnEnv, "GOTRAVEL_TRACING_SAMPLERATIO=2"}, errors: []string{"tracing.sampleRatio"}},
+		{name: "tls without files", environ: []string{dsnEnv, "GOTRAVEL_API_TLS_ENABLED=true"}, errors: []string{"api.tls.certFile: is required", "api.tls.keyFile: is required"}},
+		{name: "bad version", environ: []string{dsnEnv, "GOTRAVEL_API_VERSIONS_DEFAULT=2"}, errors: []string{"api.versions.default"}},
+		{
+			name:    "all errors at once",
+			environ: []string{"GOTRAVEL_LOG_LEVEL=loud", "GOTRAVEL_LOG_OUTPUT=syslog"},
+			errors:  []string{"api.dbDsn", "log.level", "log.output"},
+		},
+		{name: "group without prefixes", file: "api:\n  dbDsn: dsn\nrateLimit:\n  groups:\n    - name: admin\n", errors: []string{"rateLimit.groups[0].pathPrefixes"}},
+		{name: "malformed file", file: "api: [", errors: []string{"could not unmarshall data"}},
+		{name: "wrong type in file", file: "api:\n  maxBodyBytes: big\n", errors: []string{"could not unmarshall data"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = writeConfig(t, tt.file)
+			}
+
+			cfg, err := LoadConfig(path, tt.environ)
+
+			if len(tt.errors) == 0 {
+				if err != nil {
+					t.Fatalf("LoadConfig failed: %s", err.Error())
+				}
+
+				return
+			}
+
+			if err == nil || cfg != nil {
+				t.Fatalf("expected config to be rejected, got %+v", cfg)
+			}
+
+			for _, e := range tt.errors {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("expected %q in %q", e, err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yml"), []string{dsnEnv}); err == nil || !strings.Contains(err.Error(), "could not read from file") {
+		t.Errorf("expected missing file to fail, got %v", err)
+	}
+}
@@ -2,8 +2,12 @@ package app
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,7 +27,7 @@ func ContextWithValue(ctx context.Context, key string, value interface{}) contex
 
 	result.values[key] = value
 
-	return context.WithValue(ctx, ctxLogCont, &result)
+	return context.WithValue(ctx, ctxLogCont, result)
 }
 
 func ContextWithError(ctx context.Context, err error) context.Context {
@@ -31,7 +35,7 @@ func ContextWithError(ctx context.Context, err error) context.Context {
 
 	result.values["error"] = err.Error()
 
-	return context.WithValue(ctx, ctxLogCont, &result)
+	return context.WithValue(ctx, ctxLogCont, result)
 }
 
 func copyContextData(ctx context.Context) *ctxValues {
@@ -47,53 +51,111 @@ func copyContextData(ctx context.Context) *ctxValues {
 	return &result
 }
 
-type severity string
+type Severity string
 
 const (
-	infoSeverity  severity = "INFO"
-	errorSeverity severity = "ERROR"
+	DebugSeverity Severity = "DEBUG"
+	InfoSeverity  Severity = "INFO"
+	WarnSeverity  Severity = "WARN"
+	ErrorSeverity Severity = "ERROR"
 )
 
-type logOutput struct {
-	Level   severity               `json:"level"`
-	Context map[string]interface{} `json:"context,omitempty"`
+var severityRank = map[Severity]int{
+	DebugSeverity: 0,
+	InfoSeverity:  1,
+	WarnSeverity:  2,
+	ErrorSeverity: 3,
+}
+
+// ParseSeverity accepts level name in any case, empty name means INFO
+func ParseSeverity(name string) (Severity, error) {
+	if name == "" {
+		return InfoSeverity, nil
+	}
+
+	level := Severity(strings.ToUpper(name))
+	if _, ok := severityRank[level]; !ok {
+		return "", fmt.Errorf("unknown log level: %s", name)
+	}
+
+	return level, nil
+}
+
+// Entry is one log line, it is written as single line JSON
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Level   Severity               `json:"level"`
+	Caller  string                 `json:"caller,omitempty"`
 	Message string                 `json:"message"`
+	Context map[string]interface{} `json:"context,omitempty"`
 }
 
 type Logger interface {
+	Debug(ctx context.Context, template string, params ...interface{})
 	Info(ctx context.Context, template string, params ...interface{})
+	Warn(ctx context.Context, template string, params ...interface{})
 	Error(ctx context.Context, template string, params ...interface{})
+	// SetLevel changes minimum level of entries which are written
+	SetLevel(minLevel Severity)
 }
 
-func NewLogger() Logger {
-	return logger{}
+// NewLogger writes entries with level of at least minLevel to sink
+func NewLogger(minLevel Severity, sink Sink) Logger {
+	l := &logger{sink: sink}
+	l.SetLevel(minLevel)
+
+	return l
 }
 
-type logger struct{}
+type logger struct {
+	minRank atomic.Int32
+	sink    Sink
+}
 
-func (l logger) Info(ctx context.Context, template string, params ...interface{}) {
-	l.log(ctx, infoSeverity, template, params...)
+func (l *logger) SetLevel(minLevel Severity) {
+	l.minRank.Store(int32(severityRank[minLevel]))
 }
 
-func (l logger) Error(ctx context.Context, template string, params ...interface{}) {
-	l.log(ctx, errorSeverity, template, params...)
+func (l *logger) Debug(ctx context.Context, template string, params ...interface{}) {
+	l.log(ctx, DebugSeverity, template, params...)
 }
 
-func (l logger) log(ctx context.Context, level severity, template string, params ...interface{}) {
-	output := logOutput{
+func (l *logger) Info(ctx context.Context, template string, params ...interface{}) {
+	l.log(ctx, InfoSeverity, template, params...)
+}
+
+func (l *logger) Warn(ctx context.Context, template string, params ...interface{}) {
+	l.log(ctx, WarnSeverity, template, params...)
+}
+
+func (l *logger) Error(ctx context.Context, template string, params ...interface{}) {
+	l.log(ctx, ErrorSeverity, template, params...)
+}
+
+// callerSkip skips log and exported logging method
+const callerSkip = 2
+
+func (l *logger) log(ctx context.Context, level Severity, template string, params ...interface{}) {
+	if int32(severityRank[level]) < l.minRank.Load() {
+		return
+	}
+
+	entry := Entry{
+		Time:    time.Now(),
 		Level:   level,
 		Message: fmt.Sprintf(template, params...),
 	}
 
+	if _, file, line, ok := runtime.Caller(callerSkip); ok {
+		entry.Caller = fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(file)), filepath.Base(file), line)
+	}
+
 	vals, _ := ctx.Value(ctxLogCont).(*ctxValues)
 	if vals != nil {
-		output.Context = vals.values
+		entry.Context = vals.values
 	}
 
-	bytes, err := json.Marshal(&output)
-	if err != nil {
-		fmt.Printf("error logging: %s\n", err.Error())
-	} else {
-		fmt.Printf("%s -> %s", time.Now().Format(time.RFC3339), string(bytes))
+	if err := l.sink.Write(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "error logging: %s\n", err.Error())
 	}
 }
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLoggerLevel(t *testing.T) {
+	sink := NewMemorySink()
+	logger := NewLogger(WarnSeverity, sink)
+
+	logger.Debug(context.Background(), "debug")
+	logger.Info(context.Background(), "info")
+	logger.Warn(context.Background(), "warn %d", 1)
+	logger.Error(context.Background(), "error %d", 2)
+
+	entries := sink.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+
+	if entries[0].Level != WarnSeverity || entries[0].Message != "warn 1" {
+		t.Errorf("unexpected entry %+v", entries[0])
+	}
+
+	if entries[1].Level != ErrorSeverity || entries[1].Message != "error 2" {
+		t.Errorf("unexpected entry %+v", entries[1])
+	}
+
+	sink.Reset()
+	logger.SetLevel(DebugSeverity)
+	logger.Debug(context.Background(), "debug")
+
+	if entries = sink.Entries(); len(entries) != 1 || entries[0].Level != DebugSeverity {
+		t.Errorf("expected debug entry after SetLevel, got %v", entries)
+	}
+}
+
+func TestLoggerContext(t *testing.T) {
+	sink := NewMemorySink()
+	logger := NewLogger(InfoSeverity, sink)
+
+	ctx := ContextWithValue(context.Background(), "city", 7)
+	ctx = ContextWithError(ctx, errors.New("failed"))
+
+	logger.Info(ctx, "message")
+	logger.Info(context.Background(), "plain")
+
+	entries := sink.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+
+	if entries[0].Context["city"] != 7 || entries[0].Context["error"] != "failed" {
+		t.Errorf("unexpected context %v", entries[0].Context)
+	}
+
+	if !strings.HasPrefix(entries[0].Caller, "app/logger_test.go:") {
+		t.Errorf("unexpected caller %s", entries[0].Caller)
+	}
+
+	if entries[1].Context != nil {
+		t.Errorf("expected no context, got %v", entries[1].Context)
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	for name, expected := range map[string]Severity{"": InfoSeverity, "debug": DebugSeverity, "Warn": WarnSeverity} {
+		if level, err := ParseSeverity(name); err != nil || level != expected {
+			t.Errorf("ParseSeverity(%q) = %s, %v", name, level, err)
+		}
+	}
+
+	if _, err := ParseSeverity("verbose"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
@@ -0,0 +1,215 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const defaultWatchInterval = 5 * time.Second
+
+// ConfigStore holds effective config and replaces it when config file changes or SIGHUP is received.
+// Only settings tagged as reloadable may change, reload which touches any other is rejected as a whole.
+type ConfigStore struct {
+	file    string
+	environ []string
+	current atomic.Pointer[Config]
+
+	// mu serializes reloads and calls to subscribers
+	mu          sync.Mutex
+	subscribers []func(cfg *Config)
+	modified    time.Time
+}
+
+// NewConfigStore keeps cfg loaded from file, environ is applied again on every reload
+func NewConfigStore(file string, environ []string, cfg *Config) *ConfigStore {
+	s := &ConfigStore{
+		file:    file,
+		environ: environ,
+	}
+
+	s.current.Store(cfg)
+	s.modified, _ = s.lastModified()
+
+	return s
+}
+
+// Current returns config which must not be modified
+func (s *ConfigStore) Current() *Config {
+	return s.current.Load()
+}
+
+// Subscribe registers fn which is called with new config after every applied reload
+func (s *ConfigStore) Subscribe(fn func(cfg *Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// Change describes one setting modified by reload, secrets are redacted
+type Change struct {
+	Setting string
+	Old     interface{}
+	New     interface{}
+}
+
+// ErrNotReloadable lists settings which can't be changed without restart
+type ErrNotReloadable struct {
+	Settings []string
+}
+
+func (e ErrNotReloadable) Error() string {
+	return "restart is needed to change " + strings.Join(e.Settings, ", ")
+}
+
+// Reload loads and validates config again, logs changed settings, applies them and notifies subscribers.
+// Changes are logged before they are applied so raising log level does not hide them.
+func (s *ConfigStore) Reload(ctx context.Context, logger Logger) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next, err := LoadConfig(s.file, s.environ)
+	if err != nil {
+		return err
+	}
+
+	changes, err := diff(s.Current(), next)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		logger.Info(ctx, "config reloaded without changes")
+		return nil
+	}
+
+	for _, c := range changes {
+		logger.Info(ContextWithValue(ctx, "setting", c.Setting), "config %s changed from %v to %v", c.Setting, c.Old, c.New)
+	}
+
+	s.current.Store(next)
+
+	for _, fn := range s.subscribers {
+		fn(next)
+	}
+
+	return nil
+}
+
+// diff fails if any setting which is not reloadable differs, values of changes are redacted
+// only after comparison so that change of a secret is not missed
+func diff(old, next *Config) ([]Change, error) {
+	oldSettings := settings(reflect.ValueOf(old).Elem(), nil)
+	nextSettings := settings(reflect.ValueOf(next).Elem(), nil)
+
+	oldRedacted, nextRedacted := old.Redacted(), next.Redacted()
+	oldReported := settings(reflect.ValueOf(&oldRedacted).Elem(), nil)
+	nextReported := settings(reflect.ValueOf(&nextRedacted).Elem(), nil)
+
+	var (
+		changes []Change
+		fixed   []string
+	)
+
+	for i, o := range oldSettings {
+		n := nextSettings[i]
+
+		if reflect.DeepEqual(o.value.Interface(), n.value.Interface()) {
+			continue
+		}
+
+		if !o.reloadable {
+			fixed = append(fixed, o.name())
+			continue
+		}
+
+		changes = append(changes, Change{
+			Setting: o.name(),
+			Old:     oldReported[i].value.Interface(),
+			New:     nextReported[i].value.Interface(),
+		})
+	}
+
+	if len(fixed) > 0 {
+		return nil, ErrNotReloadable{Settings: fixed}
+	}
+
+	return changes, nil
+}
+
+func (s *ConfigStore) lastModified() (time.Time, error) {
+	if s.file == "" {
+		return time.Time{}, nil
+	}
+
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not stat config file: %w", err)
+	}
+
+	return info.ModTime(), nil
+}
+
+// Watch reloads config when SIGHUP is received or file modification time changes,
+// file is checked every interval until ctx is done
+func (s *ConfigStore) Watch(ctx context.Context, interval time.Duration, logger Logger) {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			s.reloadAndLog(ctx, "SIGHUP", logger)
+		case <-ticker.C:
+			modified, err := s.lastModified()
+			if err != nil {
+				logger.Error(ContextWithError(ctx, err), "could not check config file")
+				continue
+			}
+
+			s.mu.Lock()
+			changed := !modified.Equal(s.modified)
+			s.modified = modified
+			s.mu.Unlock()
+
+			if changed {
+				s.reloadAndLog(ctx, "file change", logger)
+			}
+		}
+	}
+}
+
+func (s *ConfigStore) reloadAndLog(ctx context.Context, reason string, logger Logger) {
+	ctx = ContextWithValue(ctx, "reason", reason)
+
+	err := s.Reload(ctx, logger)
+
+	var notReloadable ErrNotReloadable
+
+	switch {
+	case errors.As(err, &notReloadable):
+		logger.Warn(ContextWithValue(ctx, "settings", notReloadable.Settings), "config reload rejected: %s", err.Error())
+	case err != nil:
+		logger.Error(ContextWithError(ctx, err), "config reload failed, keeping current config")
+	}
+}
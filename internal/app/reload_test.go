@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func newTestStore(t *testing.T, environ ...string) *ConfigStore {
+	t.Helper()
+
+	cfg, err := LoadConfig("", environ)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %s", err.Error())
+	}
+
+	return NewConfigStore("", environ, cfg)
+}
+
+func logged(sink *MemorySink) string {
+	var sb strings.Builder
+
+	for _, e := range sink.Entries() {
+		fmt.Fprintf(&sb, "%s %v\n", e.Message, e.Context)
+	}
+
+	return sb.String()
+}
+
+func TestReloadRejectsDsnPasswordChange(t *testing.T) {
+	store := newTestStore(t, "GOTRAVEL_API_DBDSN=postgres://travel:first@db:5432/travel")
+	store.environ = []string{"GOTRAVEL_API_DBDSN=postgres://travel:second@db:5432/travel"}
+
+	sink := NewMemorySink()
+
+	var notReloadable ErrNotReloadable
+
+	err := store.Reload(context.Background(), NewLogger(DebugSeverity, sink))
+	if !errors.As(err, &notReloadable) || len(notReloadable.Settings) != 1 || notReloadable.Settings[0] != "api.dbDsn" {
+		t.Fatalf("expected api.dbDsn to be rejected, got %v", err)
+	}
+
+	if store.Current().API.DbDsn != "postgres://travel:first@db:5432/travel" {
+		t.Errorf("rejected reload changed config")
+	}
+}
+
+func TestReloadRedactsReportedChanges(t *testing.T) {
+	const dsn = "GOTRAVEL_API_DBDSN=postgres://travel:secret@db:5432/travel"
+
+	store := newTestStore(t, dsn, "GOTRAVEL_RATELIMIT_APIKEYS=first-key")
+	store.environ = []string{dsn, "GOTRAVEL_RATELIMIT_APIKEYS=second-key"}
+
+	notified := 0
+	store.Subscribe(func(cfg *Config) {
+		notified++
+	})
+
+	sink := NewMemorySink()
+
+	if err := store.Reload(context.Background(), NewLogger(DebugSeverity, sink)); err != nil {
+		t.Fatalf("Reload failed: %s", err.Error())
+	}
+
+	if keys := store.Current().RateLimit.APIKeys; len(keys) != 1 || keys[0] != "second-key" {
+		t.Errorf("new API key was not applied: %v", keys)
+	}
+
+	if notified != 1 {
+		t.Errorf("expected one notification, got %d", notified)
+	}
+
+	out := logged(sink)
+	if !strings.Contains(out, "rateLimit.apiKeys") {
+		t.Errorf("change of API keys was not logged: %s", out)
+	}
+
+	if strings.Contains(out, "first-key") || strings.Contains(out, "second-key") {
+		t.Errorf("API keys were logged: %s", out)
+	}
+}
+
+func TestReloadWithoutChanges(t *testing.T) {
+	store := newTestStore(t, "GOTRAVEL_API_DBDSN=postgres://travel:first@db:5432/travel")
+	sink := NewMemorySink()
+
+	if err := store.Reload(context.Background(), NewLogger(DebugSeverity, sink)); err != nil {
+		t.Fatalf("Reload failed: %s", err.Error())
+	}
+
+	if entries := sink.Entries(); len(entries) != 1 || entries[0].Message != "config reloaded without changes" {
+		t.Errorf("unexpected log %v", entries)
+	}
+}
@@ -0,0 +1,240 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	defaultMaxSizeMB  = 100
+	defaultMaxBackups = 3
+)
+
+// Sink receives every entry which passed logger's level check
+type Sink interface {
+	Write(entry Entry) error
+	Close() error
+}
+
+// NewSink creates sink for log.output, stdout is used when output is not set
+func NewSink(cfg LogConfig) (Sink, error) {
+	switch cfg.Output {
+	case "", "stdout":
+		return NewWriterSink(os.Stdout), nil
+	case "stderr":
+		return NewWriterSink(os.Stderr), nil
+	case "file":
+		return NewFileSink(cfg.File, cfg.MaxSizeMB, cfg.MaxBackups)
+	default:
+		return nil, fmt.Errorf("unknown log output: %s", cfg.Output)
+	}
+}
+
+func marshalEntry(entry Entry) ([]byte, error) {
+	bytes, err := json.Marshal(&entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal log entry: %w", err)
+	}
+
+	return append(bytes, '\n'), nil
+}
+
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink writes one JSON entry per line to w, w is not closed by sink
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Write(entry Entry) error {
+	bytes, err := marshalEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(bytes)
+
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// fileSink rotates file once it would grow over maxSize,
+// file.1 is the newest backup and backups over maxBackups are removed
+type fileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func NewFileSink(path string, maxSizeMB, maxBackups int) (Sink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("log file path is not set")
+	}
+
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultMaxSizeMB
+	}
+
+	if maxBackups <= 0 {
+		maxBackups = defaultMaxBackups
+	}
+
+	s := &fileSink{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not stat log file: %w", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+
+	return nil
+}
+
+// rotate always leaves file open when it can, so logging continues into the current file
+// after failed rotation and rotation is tried again with the next entry
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return s.reopen(fmt.Errorf("could not close log file: %w", err))
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+
+	for i := s.maxBackups - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return s.reopen(fmt.Errorf("could not rotate log file: %w", err))
+	}
+
+	if err := s.open(); err != nil {
+		s.file = nil
+		return err
+	}
+
+	return nil
+}
+
+// reopen appends to current file after rotation failed with err
+func (s *fileSink) reopen(err error) error {
+	if openErr := s.open(); openErr != nil {
+		s.file = nil
+		return errors.Join(err, openErr)
+	}
+
+	return err
+}
+
+func (s *fileSink) Write(entry Entry) error {
+	bytes, err := marshalEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		if err = s.open(); err != nil {
+			return err
+		}
+	}
+
+	var rotateErr error
+
+	if s.size > 0 && s.size+int64(len(bytes)) > s.maxSize {
+		if rotateErr = s.rotate(); s.file == nil {
+			return rotateErr
+		}
+	}
+
+	n, err := s.file.Write(bytes)
+	s.size += int64(n)
+
+	return errors.Join(rotateErr, err)
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	return s.file.Close()
+}
+
+// MemorySink keeps entries in memory so tests can assert on them
+type MemorySink struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Write(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, entry)
+
+	return nil
+}
+
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+// Entries returns copy of entries written so far
+func (s *MemorySink) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Entry(nil), s.entries...)
+}
+
+func (s *MemorySink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = nil
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestFileSink(t *testing.T, maxSize int64, maxBackups int) (*fileSink, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "api.log")
+
+	sink, err := NewFileSink(path, 1, maxBackups)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %s", err.Error())
+	}
+
+	t.Cleanup(func() { _ = sink.Close() })
+
+	s := sink.(*fileSink)
+	s.maxSize = maxSize
+
+	return s, path
+}
+
+func readMessages(t *testing.T, path string) []string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open %s: %s", path, err.Error())
+	}
+
+	defer file.Close()
+
+	var messages []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid entry %q: %s", scanner.Text(), err.Error())
+		}
+
+		messages = append(messages, entry.Message)
+	}
+
+	return messages
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	// every entry is bigger than half of max size, so each one goes to new file
+	s, path := newTestFileSink(t, 150, 2)
+
+	for _, message := range []string{"first", "second", "third", "fourth"} {
+		if err := s.Write(Entry{Level: InfoSeverity, Message: message + strings.Repeat(".", 50)}); err != nil {
+			t.Fatalf("Write failed: %s", err.Error())
+		}
+	}
+
+	for name, expected := range map[string]string{path: "fourth", path + ".1": "third", path + ".2": "second"} {
+		messages := readMessages(t, name)
+		if len(messages) != 1 || !strings.HasPrefix(messages[0], expected) {
+			t.Errorf("expected %s in %s, got %v", expected, filepath.Base(name), messages)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, got %v", err)
+	}
+}
+
+func TestFileSinkKeepsLoggingWhenRotationFails(t *testing.T) {
+	s, path := newTestFileSink(t, 150, 1)
+
+	// non-empty directory can't be removed nor replaced by file
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	long := strings.Repeat(".", 100)
+
+	if err := s.Write(Entry{Level: InfoSeverity, Message: "first" + long}); err != nil {
+		t.Fatalf("Write failed: %s", err.Error())
+	}
+
+	if err := s.Write(Entry{Level: InfoSeverity, Message: "second" + long}); err == nil {
+		t.Error("expected rotation error")
+	}
+
+	if err := s.Write(Entry{Level: InfoSeverity, Message: "third" + long}); err == nil {
+		t.Error("expected rotation to be tried again")
+	}
+
+	if messages := readMessages(t, path); len(messages) != 3 {
+		t.Fatalf("expected all entries in current file, got %v", messages)
+	}
+
+	// rotation succeeds once the obstacle is gone
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Write(Entry{Level: InfoSeverity, Message: "fourth"}); err != nil {
+		t.Fatalf("Write failed: %s", err.Error())
+	}
+
+	if messages := readMessages(t, path); len(messages) != 1 || messages[0] != "fourth" {
+		t.Errorf("expected only fourth entry in current file, got %v", messages)
+	}
+
+	if messages := readMessages(t, path+".1"); len(messages) != 3 {
+		t.Errorf("expected 3 entries in backup, got %v", messages)
+	}
+}
@@ -0,0 +1,25 @@
+package entity
+
+import "errors"
+
+type Airport struct {
+	ID int
+	// AirportID identifies airport in imported airport data
+	AirportID int
+	Name      string
+	CityID    int
+}
+
+// Route is direct flight between airports with its price
+type Route struct {
+	ID            int
+	SourceID      int
+	DestinationID int
+	Price         float64
+}
+
+var (
+	ErrAirportNotFound = errors.New("airport not found")
+	ErrAirportExists   = errors.New("airport with same airport ID already exists")
+	ErrRouteNotFound   = errors.New("route not found")
+)
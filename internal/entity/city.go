@@ -6,9 +6,12 @@ type City struct {
 	ID      int
 	Name    string
 	Country string
+	// Version starts at 1 and grows with every update
+	Version int
 }
 
 var (
 	ErrCityNotFound = errors.New("city not found")
 	ErrCityExists   = errors.New("city with same name in same country already exists")
+	ErrCityChanged  = errors.New("city was changed in the meantime")
 )
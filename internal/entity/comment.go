@@ -1,6 +1,9 @@
 package entity
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 type Comment struct {
 	ID       int
@@ -25,3 +28,9 @@ type CommentWithPosterName struct {
 	Comment    Comment
 	PosterName string
 }
+
+var (
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrNotCommentPoster is returned when user changes comment posted by someone else
+	ErrNotCommentPoster = errors.New("comment was posted by other user")
+)
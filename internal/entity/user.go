@@ -23,4 +23,5 @@ type User struct {
 var (
 	ErrUsernameNotFound = errors.New("username not found")
 	ErrUsernameTaken    = errors.New("username is already taken")
+	ErrIncorrectRole    = errors.New("incorrect role")
 )
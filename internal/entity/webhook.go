@@ -0,0 +1,75 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// OutboxEvent is domain event stored in the same transaction as change which caused it
+type OutboxEvent struct {
+	ID    int
+	Topic string
+	Type  string
+	// Payload is JSON sent as data of webhook
+	Payload []byte
+	Created time.Time
+}
+
+// WebhookSubscription receives events of Topics, all topics when empty
+type WebhookSubscription struct {
+	ID      int
+	URL     string
+	Secret  string
+	Topics  []string
+	Created time.Time
+}
+
+// Wants tells if events of topic are delivered to subscription
+func (s WebhookSubscription) Wants(topic string) bool {
+	if len(s.Topics) == 0 {
+		return true
+	}
+
+	for _, t := range s.Topics {
+		if t == topic {
+			return true
+		}
+	}
+
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead is not retried any more until it is replayed
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// WebhookDelivery is one event sent to one subscription
+type WebhookDelivery struct {
+	ID             int
+	EventID        int
+	SubscriptionID int
+	Status         DeliveryStatus
+	Attempts       int
+	NextAttempt    time.Time
+	LastError      string
+	Updated        time.Time
+}
+
+// DueDelivery is pending delivery with everything needed to send it
+type DueDelivery struct {
+	Delivery WebhookDelivery
+	Event    OutboxEvent
+	URL      string
+	Secret   string
+}
+
+var (
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound     = errors.New("webhook delivery not found")
+	ErrDeliveryNotDead      = errors.New("only dead deliveries can be replayed")
+)
@@ -0,0 +1,217 @@
+// Package events delivers changes of entities to subscribers within one process
+package events
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Topics clients may subscribe to, events are published by services writing these entities
+const (
+	TopicCities   = "cities"
+	TopicComments = "comments"
+	TopicRoutes   = "routes"
+	TopicPrices   = "prices"
+)
+
+var Topics = []string{TopicCities, TopicComments, TopicRoutes, TopicPrices}
+
+// Event types
+const (
+	Created = "created"
+	Updated = "updated"
+	Deleted = "deleted"
+)
+
+// subscriberBuffer is number of live events subscriber may fall behind before it is dropped
+const subscriberBuffer = 64
+
+type Event struct {
+	// ID is unique within process and grows with every event, see Bus.Subscribe
+	ID    string      `json:"id"`
+	Topic string      `json:"topic"`
+	Type  string      `json:"type"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+// Bus keeps last published events so that subscribers can resume after reconnecting.
+// Publishing never waits for subscribers, subscriber which falls behind is dropped and has to resume.
+type Bus struct {
+	mu sync.Mutex
+	// epoch tells apart IDs of events published before restart
+	epoch       string
+	seq         uint64
+	buffer      []Event
+	size        int
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+func NewBus(bufferSize int) *Bus {
+	return &Bus{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:        bufferSize,
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Publish sends event to subscribers of topic, kind is one of Created, Updated or Deleted
+func (b *Bus) Publish(topic, kind string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.seq++
+
+	event := Event{
+		ID:    b.epoch + "-" + strconv.FormatUint(b.seq, 10),
+		Topic: topic,
+		Type:  kind,
+		Time:  time.Now().UTC(),
+		Data:  data,
+	}
+
+	if b.size > 0 {
+		if len(b.buffer) == b.size {
+			b.buffer = append(b.buffer[:0], b.buffer[1:]...)
+		}
+
+		b.buffer = append(b.buffer, event)
+	}
+
+	for s := range b.subscribers {
+		if !s.wants(topic) {
+			continue
+		}
+
+		select {
+		case s.events <- event:
+		default:
+			b.drop(s)
+		}
+	}
+}
+
+// Subscription receives events of its topics until it is closed or dropped, then channel is closed
+type Subscription struct {
+	// Replay are buffered events published after requested ID, they precede events from C
+	Replay []Event
+	// Resumed is false when requested ID is no longer buffered or comes from before restart,
+	// such subscriber missed events and should reload state
+	Resumed bool
+	C       <-chan Event
+
+	bus    *Bus
+	topics []string
+	events chan Event
+}
+
+func (s *Subscription) wants(topic string) bool {
+	if len(s.topics) == 0 {
+		return true
+	}
+
+	for _, t := range s.topics {
+		if t == topic {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Close stops delivery, it is safe to call after subscription was dropped
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, ok := s.bus.subscribers[s]; ok {
+		s.bus.drop(s)
+	}
+}
+
+// drop has to be called with lock held
+func (b *Bus) drop(s *Subscription) {
+	delete(b.subscribers, s)
+	close(s.events)
+}
+
+// Subscribe delivers events of topics, all topics when empty. Empty lastEventID subscribes to new events only,
+// otherwise buffered events after it are replayed.
+func (b *Bus) Subscribe(topics []string, lastEventID string) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &Subscription{
+		Resumed: true,
+		bus:     b,
+		topics:  topics,
+		events:  make(chan Event, subscriberBuffer),
+	}
+	s.C = s.events
+
+	if b.closed {
+		close(s.events)
+		return s
+	}
+
+	if lastEventID != "" {
+		s.Replay, s.Resumed = b.after(lastEventID)
+
+		filtered := s.Replay[:0]
+
+		for _, e := range s.Replay {
+			if s.wants(e.Topic) {
+				filtered = append(filtered, e)
+			}
+		}
+
+		s.Replay = filtered
+	}
+
+	b.subscribers[s] = struct{}{}
+
+	return s
+}
+
+// after returns copy of buffered events following id and whether nothing was missed since id
+func (b *Bus) after(id string) ([]Event, bool) {
+	epoch, seqPart, ok := strings.Cut(id, "-")
+	if !ok || epoch != b.epoch {
+		return nil, false
+	}
+
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil || seq > b.seq {
+		return nil, false
+	}
+
+	missing := b.seq - seq
+	if missing == 0 {
+		return nil, true
+	}
+
+	if missing > uint64(len(b.buffer)) {
+		return nil, false
+	}
+
+	return append([]Event(nil), b.buffer[uint64(len(b.buffer))-missing:]...), true
+}
+
+// Close ends all subscriptions, e.g. when server shuts down, and ignores later events
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	for s := range b.subscribers {
+		b.drop(s)
+	}
+}
@@ -0,0 +1,187 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ids(events []Event) []string {
+	var result []string
+
+	for _, e := range events {
+		result = append(result, e.ID)
+	}
+
+	return result
+}
+
+func receive(t *testing.T, s *Subscription) Event {
+	t.Helper()
+
+	select {
+	case e, ok := <-s.C:
+		if !ok {
+			t.Fatal("subscription was closed")
+		}
+
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event was delivered")
+	}
+
+	return Event{}
+}
+
+func TestSubscribeResumesAfterLastEventID(t *testing.T) {
+	bus := NewBus(10)
+	defer bus.Close()
+
+	first := bus.Subscribe(nil, "")
+	defer first.Close()
+
+	bus.Publish(TopicCities, Created, 1)
+	bus.Publish(TopicComments, Created, 2)
+	bus.Publish(TopicCities, Updated, 1)
+
+	var published []Event
+	for i := 0; i < 3; i++ {
+		published = append(published, receive(t, first))
+	}
+
+	tests := []struct {
+		name        string
+		topics      []string
+		lastEventID string
+		replay      []string
+	}{
+		{name: "new events only", replay: nil},
+		{name: "after first", lastEventID: published[0].ID, replay: ids(published[1:])},
+		{name: "after last", lastEventID: published[2].ID, replay: nil},
+		{name: "after first of topic", topics: []string{TopicCities}, lastEventID: published[0].ID, replay: []string{published[2].ID}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := bus.Subscribe(tt.topics, tt.lastEventID)
+			defer s.Close()
+
+			if !s.Resumed {
+				t.Error("subscription was not resumed")
+			}
+
+			if got := ids(s.Replay); !reflect.DeepEqual(got, tt.replay) {
+				t.Errorf("expected replay %v, got %v", tt.replay, got)
+			}
+		})
+	}
+
+	// live events follow replay
+	s := bus.Subscribe(nil, published[2].ID)
+	defer s.Close()
+
+	bus.Publish(TopicCities, Deleted, 1)
+
+	if e := receive(t, s); e.Type != Deleted {
+		t.Errorf("unexpected live event %+v", e)
+	}
+}
+
+func TestSubscribeFromEvictedID(t *testing.T) {
+	bus := NewBus(2)
+	defer bus.Close()
+
+	s := bus.Subscribe(nil, "")
+	defer s.Close()
+
+	for i := 0; i < 4; i++ {
+		bus.Publish(TopicCities, Created, i)
+	}
+
+	var published []Event
+	for i := 0; i < 4; i++ {
+		published = append(published, receive(t, s))
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		resumed     bool
+		replay      int
+	}{
+		{name: "evicted", lastEventID: published[0].ID, resumed: false},
+		{name: "just before buffer", lastEventID: published[1].ID, resumed: true, replay: 2},
+		{name: "before restart", lastEventID: "old-3", resumed: false},
+		{name: "from future", lastEventID: published[3].ID[:len(published[3].ID)-1] + "9", resumed: false},
+		{name: "malformed", lastEventID: "nonsense", resumed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resumed := bus.Subscribe(nil, tt.lastEventID)
+			defer resumed.Close()
+
+			if resumed.Resumed != tt.resumed || len(resumed.Replay) != tt.replay {
+				t.Errorf("expected resumed %t with %d events, got %t with %v", tt.resumed, tt.replay, resumed.Resumed, ids(resumed.Replay))
+			}
+		})
+	}
+}
+
+func TestSlowSubscriberIsClosed(t *testing.T) {
+	bus := NewBus(0)
+	defer bus.Close()
+
+	slow := bus.Subscribe(nil, "")
+	fast := bus.Subscribe([]string{TopicCities}, "")
+	other := bus.Subscribe([]string{TopicComments}, "")
+
+	defer fast.Close()
+	defer other.Close()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		bus.Publish(TopicCities, Created, i)
+
+		if i < subscriberBuffer {
+			receive(t, fast)
+		}
+	}
+
+	for i := 0; i < subscriberBuffer; i++ {
+		receive(t, slow)
+	}
+
+	if _, ok := <-slow.C; ok {
+		t.Fatal("subscriber which fell behind was not closed")
+	}
+
+	// closing dropped subscription is safe
+	slow.Close()
+
+	if e := receive(t, fast); e.Data != subscriberBuffer {
+		t.Errorf("subscriber which kept up missed events, got %+v", e)
+	}
+
+	bus.Publish(TopicComments, Created, 1)
+
+	if e := receive(t, other); e.Topic != TopicComments {
+		t.Errorf("subscriber of other topic got %+v", e)
+	}
+}
+
+func TestCloseEndsSubscriptions(t *testing.T) {
+	bus := NewBus(10)
+	s := bus.Subscribe(nil, "")
+
+	bus.Close()
+
+	if _, ok := <-s.C; ok {
+		t.Error("subscription was not closed")
+	}
+
+	bus.Publish(TopicCities, Created, 1)
+
+	if _, ok := <-bus.Subscribe(nil, "").C; ok {
+		t.Error("subscription to closed bus was not closed")
+	}
+}
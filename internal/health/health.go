@@ -0,0 +1,147 @@
+// Package health keeps dependency checks used by readiness probe
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	defaultTimeout = 2 * time.Second
+)
+
+// Check returns error when dependency is not usable
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Registry runs registered checks concurrently, each one with its own timeout
+type Registry struct {
+	mu       sync.RWMutex
+	checks   []namedCheck
+	timeout  atomic.Int64
+	draining atomic.Bool
+}
+
+// NewRegistry creates registry, timeout applies to every check and defaults to 2s
+func NewRegistry(timeout time.Duration) *Registry {
+	r := &Registry{}
+	r.SetTimeout(timeout)
+
+	return r
+}
+
+// SetTimeout changes timeout of checks which are started afterwards
+func (r *Registry) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	r.timeout.Store(int64(timeout))
+}
+
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks = append(r.checks, namedCheck{name: name, check: check})
+}
+
+// SetDraining makes readiness fail so load balancer stops sending traffic before shutdown
+func (r *Registry) SetDraining() {
+	r.draining.Store(true)
+}
+
+// CheckResult is outcome of one check
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is ready when service is not draining and every check passed
+type Report struct {
+	Status   string                 `json:"status"`
+	Draining bool                   `json:"draining,omitempty"`
+	Checks   map[string]CheckResult `json:"checks"`
+}
+
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Run executes all checks and waits for them to finish
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]namedCheck(nil), r.checks...)
+	r.mu.RUnlock()
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].name < checks[j].name
+	})
+
+	results := make([]CheckResult, len(checks))
+
+	var wg sync.WaitGroup
+
+	for i, c := range checks {
+		wg.Add(1)
+
+		go func(i int, c namedCheck) {
+			defer wg.Done()
+
+			results[i] = r.run(ctx, c.check)
+		}(i, c)
+	}
+
+	wg.Wait()
+
+	report := Report{
+		Status:   StatusOK,
+		Draining: r.draining.Load(),
+		Checks:   make(map[string]CheckResult, len(checks)),
+	}
+
+	if report.Draining {
+		report.Status = StatusFail
+	}
+
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(r.timeout.Load()))
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+
+	result := CheckResult{
+		Status:    StatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
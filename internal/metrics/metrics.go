@@ -0,0 +1,148 @@
+// Package metrics holds application collectors and serves them in Prometheus text format
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/reactivex/rxgo/v2"
+)
+
+const namespace = "gotravel"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of handled HTTP requests.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "logins_total",
+		Help:      "Number of login attempts by result.",
+	}, []string{"result"})
+
+	PipelineStageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "pipeline",
+		Name:      "stage_duration_seconds",
+		Help:      "Duration of reactive pipeline stages.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"pipeline", "stage", "result"})
+
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhooks",
+		Name:      "deliveries_total",
+		Help:      "Number of webhook delivery attempts by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		Logins,
+		PipelineStageDuration,
+		WebhookDeliveries,
+	)
+}
+
+// Handler serves every registered collector
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Pipeline returns function which wraps stages of named pipeline so their durations are observed
+func Pipeline(pipeline string) func(stage string, fn rxgo.Func) rxgo.Func {
+	return func(stage string, fn rxgo.Func) rxgo.Func {
+		return func(ctx context.Context, item interface{}) (interface{}, error) {
+			start := time.Now()
+			result, err := fn(ctx, item)
+
+			outcome := "success"
+			if err != nil {
+				outcome = "error"
+			}
+
+			PipelineStageDuration.WithLabelValues(pipeline, stage, outcome).Observe(time.Since(start).Seconds())
+
+			return result, err
+		}
+	}
+}
+
+type statsProvider interface {
+	Stats() sql.DBStats
+}
+
+// RegisterDBStats exposes connection pool statistics of provider
+func RegisterDBStats(provider statsProvider) error {
+	return registry.Register(&dbStatsCollector{provider: provider})
+}
+
+func dbDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", name), help, nil, nil)
+}
+
+var (
+	dbMaxOpenDesc      = dbDesc("max_open_connections", "Maximum number of open connections to the database.")
+	dbOpenDesc         = dbDesc("open_connections", "Number of established connections both in use and idle.")
+	dbInUseDesc        = dbDesc("in_use_connections", "Number of connections currently in use.")
+	dbIdleDesc         = dbDesc("idle_connections", "Number of idle connections.")
+	dbWaitCountDesc    = dbDesc("wait_count_total", "Total number of connections waited for.")
+	dbWaitDurationDesc = dbDesc("wait_duration_seconds_total", "Total time blocked waiting for a new connection.")
+	dbMaxIdleDesc      = dbDesc("max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns.")
+	dbMaxIdleTimeDesc  = dbDesc("max_idle_time_closed_total", "Total number of connections closed due to SetConnMaxIdleTime.")
+	dbMaxLifetimeDesc  = dbDesc("max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime.")
+)
+
+type dbStatsCollector struct {
+	provider statsProvider
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbMaxOpenDesc
+	ch <- dbOpenDesc
+	ch <- dbInUseDesc
+	ch <- dbIdleDesc
+	ch <- dbWaitCountDesc
+	ch <- dbWaitDurationDesc
+	ch <- dbMaxIdleDesc
+	ch <- dbMaxIdleTimeDesc
+	ch <- dbMaxLifetimeDesc
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.provider.Stats()
+
+	ch <- prometheus.MustNewConstMetric(dbMaxOpenDesc, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbOpenDesc, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbInUseDesc, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(dbIdleDesc, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(dbMaxIdleDesc, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(dbMaxIdleTimeDesc, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed))
+	ch <- prometheus.MustNewConstMetric(dbMaxLifetimeDesc, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
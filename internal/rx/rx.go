@@ -0,0 +1,87 @@
+// Package rx adapts strongly typed functions to rxgo operators
+package rx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/reactivex/rxgo/v2"
+)
+
+type ErrUnexpectedType struct {
+	expected interface{}
+	actual   interface{}
+}
+
+func (e ErrUnexpectedType) Error() string {
+	return fmt.Sprintf("expected item of type %T but got %T", e.expected, e.actual)
+}
+
+func cast[T any](item interface{}) (T, error) {
+	value, ok := item.(T)
+	if !ok {
+		var zero T
+		return zero, ErrUnexpectedType{expected: zero, actual: item}
+	}
+
+	return value, nil
+}
+
+// Func adapts fn to rxgo.Func, item of wrong type results in error instead of panic
+func Func[T, R any](fn func(ctx context.Context, in T) (R, error)) rxgo.Func {
+	return func(ctx context.Context, item interface{}) (interface{}, error) {
+		in, err := cast[T](item)
+		if err != nil {
+			return nil, err
+		}
+
+		return fn(ctx, in)
+	}
+}
+
+// Supplier adapts fn which takes no input to rxgo.Func, item is ignored
+func Supplier[R any](fn func(ctx context.Context) (R, error)) rxgo.Func {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return fn(ctx)
+	}
+}
+
+// Action adapts fn to rxgo.Func which passes item through when fn succeeds
+func Action[T any](fn func(ctx context.Context, in T) error) rxgo.Func {
+	return func(ctx context.Context, item interface{}) (interface{}, error) {
+		in, err := cast[T](item)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = fn(ctx, in); err != nil {
+			return nil, err
+		}
+
+		return in, nil
+	}
+}
+
+// StageWrapper decorates named stage of a pipeline
+type StageWrapper func(stage string, fn rxgo.Func) rxgo.Func
+
+// Chain applies wrappers to every stage, first wrapper is the outermost
+func Chain(wrappers ...StageWrapper) StageWrapper {
+	return func(stage string, fn rxgo.Func) rxgo.Func {
+		for i := len(wrappers) - 1; i >= 0; i-- {
+			fn = wrappers[i](stage, fn)
+		}
+
+		return fn
+	}
+}
+
+// Get returns value of item, item error or ErrUnexpectedType
+func Get[T any](item rxgo.Item) (T, error) {
+	if item.Error() {
+		var zero T
+		return zero, item.E
+	}
+
+	return cast[T](item.V)
+}
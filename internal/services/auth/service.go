@@ -6,35 +6,58 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/reactivex/rxgo/v2"
 	"github.com/strax84mb/go-travel-reactive/internal/app"
 	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/metrics"
+	"github.com/strax84mb/go-travel-reactive/internal/rx"
+	"github.com/strax84mb/go-travel-reactive/internal/tracing"
 )
 
 type repository interface {
-	GetUserByUsername(ctx context.Context, username interface{}) (interface{}, error)
-	SaveUser(ctx context.Context, user interface{}) (interface{}, error)
+	GetUserByUsername(ctx context.Context, username string) (entity.User, error)
+	SaveUser(ctx context.Context, user entity.User) (int, error)
 }
 
+// pipeline traces and measures every stage of named pipeline
+func pipeline(name string) rx.StageWrapper {
+	return rx.Chain(tracing.Pipeline(name), metrics.Pipeline(name))
+}
+
+var (
+	loginStage    = pipeline("authService.Login")
+	saveUserStage = pipeline("authService.SaveUser")
+)
+
 type authService struct {
-	repo   repository
-	logger app.Logger
+	repo     repository
+	logger   app.Logger
+	tokenTTL atomic.Int64
 }
 
-func NewAuthService(repo repository, logger app.Logger) *authService {
-	return &authService{
+func NewAuthService(repo repository, logger app.Logger, tokenTTL time.Duration) *authService {
+	a := &authService{
 		repo:   repo,
 		logger: logger,
 	}
+
+	a.SetTokenTTL(tokenTTL)
+
+	return a
+}
+
+// SetTokenTTL changes validity of tokens issued afterwards
+func (a *authService) SetTokenTTL(ttl time.Duration) {
+	a.tokenTTL.Store(int64(ttl))
 }
 
-func generateJwt(ctx context.Context, item interface{}) (interface{}, error) {
-	user := item.(entity.User)
+func (a *authService) generateJwt(ctx context.Context, user entity.User) (string, error) {
 	now := time.Now()
-	exp := now.Add(3600 * 1000000000)
+	exp := now.Add(time.Duration(a.tokenTTL.Load()))
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub":  user.Username,
@@ -52,8 +75,8 @@ func generateJwt(ctx context.Context, item interface{}) (interface{}, error) {
 	return tokenString, nil
 }
 
-// ValidateJwt returns username
-func (a *authService) ValidateJwt(ctx context.Context, r *http.Request, expectedRole entity.UserRole) (string, error) {
+// bearerToken returns token from Authorization header
+func bearerToken(r *http.Request) (string, error) {
 	header := r.Header.Get("Authorization")
 
 	if header == "" {
@@ -64,18 +87,39 @@ func (a *authService) ValidateJwt(ctx context.Context, r *http.Request, expected
 		return "", errors.New("missing authentication token")
 	}
 
+	return strings.TrimPrefix(header, "Bearer "), nil
+}
+
+// TokenSubject returns username from token after its signature is verified with salt of user
+func (a *authService) TokenSubject(ctx context.Context, r *http.Request) (string, error) {
+	return a.ValidateJwt(ctx, r, entity.AnyUserRole)
+}
+
+// ValidateJwt returns username
+func (a *authService) ValidateJwt(ctx context.Context, r *http.Request, expectedRole entity.UserRole) (string, error) {
+	tokenString, err := bearerToken(r)
+	if err != nil {
+		return "", err
+	}
+
 	var roleFromDb entity.UserRole
 
-	token, err := jwt.Parse(strings.TrimPrefix(header, "Bearer "), func(token *jwt.Token) (interface{}, error) {
-		claims := token.Claims.(jwt.MapClaims)
-		username := claims["sub"].(string)
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return nil, errors.New("unexpected claims")
+		}
+
+		username, ok := claims["sub"].(string)
+		if !ok {
+			return nil, errors.New("token has no subject")
+		}
 
-		userItem, err := a.repo.GetUserByUsername(ctx, username)
+		user, err := a.repo.GetUserByUsername(ctx, username)
 		if err != nil {
 			return []byte{}, fmt.Errorf("can't load user data: %w", err)
 		}
 
-		user := userItem.(entity.User)
 		roleFromDb = user.Role
 
 		return user.Salt, nil
@@ -84,42 +128,61 @@ func (a *authService) ValidateJwt(ctx context.Context, r *http.Request, expected
 		return "", fmt.Errorf("error while parsing JWT: %w", err)
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
-	username := claims["sub"].(string)
-	role := entity.UserRole(claims["role"].(string))
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", errors.New("unexpected claims")
+	}
+
+	username, ok := claims["sub"].(string)
+	if !ok {
+		return "", errors.New("token has no subject")
+	}
 
-	if !validRole(expectedRole, role, roleFromDb) {
-		return "", errors.New("incorrect role")
+	roleName, ok := claims["role"].(string)
+	if !ok {
+		return "", entity.ErrIncorrectRole
 	}
+
+	if !validRole(expectedRole, entity.UserRole(roleName), roleFromDb) {
+		return "", entity.ErrIncorrectRole
+	}
+
 	return username, nil
 }
 
-func validatePassword(ctx context.Context, item interface{}) (interface{}, error) {
-	user := item.(entity.User)
+func validatePassword(ctx context.Context, user entity.User) (entity.User, error) {
 	encodedPassword := encodePassword(ctx.Value(ctxPasswordIdx).(string), user.Salt)
 
 	if encodedPassword != user.Password {
-		return "", errors.New("wrong password")
+		return entity.User{}, errors.New("wrong password")
 	}
 
-	return item, nil
+	return user, nil
 }
 
 // Login returns JWT
 func (a *authService) Login(ctx context.Context, username, password string) (string, error) {
+	ctx, span := tracing.Start(ctx, "authService.Login")
+	defer span.End()
+
 	ctx = app.ContextWithValue(ctx, "function", "authService.Login")
 
-	item := <-rxgo.JustItem(username).
-		Map(a.repo.GetUserByUsername).
-		Map(validatePassword, rxgo.WithContext(context.WithValue(ctx, ctxPasswordIdx, password))).
-		Map(generateJwt).
-		Observe()
-	if item.Error() {
-		a.logger.Error(app.ContextWithError(ctx, item.E), "login failed for username %s", username)
-		return "", fmt.Errorf("login failed: %w", item.E)
+	token, err := rx.Get[string](<-rxgo.JustItem(username).
+		Map(loginStage("getUserByUsername", rx.Func(a.repo.GetUserByUsername)), rxgo.WithContext(ctx)).
+		Map(loginStage("validatePassword", rx.Func(validatePassword)),
+			rxgo.WithContext(context.WithValue(ctx, ctxPasswordIdx, password))).
+		Map(loginStage("generateJwt", rx.Func(a.generateJwt)), rxgo.WithContext(ctx)).
+		Observe())
+	if err != nil {
+		tracing.Fail(span, err)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		a.logger.Error(app.ContextWithError(ctx, err), "login failed for username %s", username)
+		return "", fmt.Errorf("login failed: %w", err)
 	}
 
-	return item.V.(string), nil
+	metrics.Logins.WithLabelValues("success").Inc()
+
+	return token, nil
 }
 
 type usernameAndPassword struct {
@@ -157,6 +220,9 @@ func currentTime(_ interface{}) time.Time {
 }
 
 func (a *authService) SaveUser(ctx context.Context, username, password string) (int, error) {
+	ctx, span := tracing.Start(ctx, "authService.SaveUser")
+	defer span.End()
+
 	ctx = app.ContextWithValue(ctx, "function", "authService.SaveUser")
 	ctx = app.ContextWithValue(ctx, "username", username)
 	unp := usernameAndPassword{
@@ -164,19 +230,20 @@ func (a *authService) SaveUser(ctx context.Context, username, password string) (
 		Password: password,
 	}
 
-	item := <-rxgo.Just(username)().
-		Map(a.repo.GetUserByUsername).
+	id, err := rx.Get[int](<-rxgo.Just(username)().
+		Map(saveUserStage("getUserByUsername", rx.Func(a.repo.GetUserByUsername)), rxgo.WithContext(ctx)).
 		OnErrorReturn(func(err error) interface{} {
 			return err
 		}).
-		Map(checkIfUserExists).
+		Map(saveUserStage("checkIfUserExists", checkIfUserExists), rxgo.WithContext(ctx)).
 		Join(createAndEncodeUser, rxgo.Just(unp)(), currentTime, rxgo.WithDuration(5*time.Second)).
-		Map(a.repo.SaveUser).
-		Observe()
-	if item.Error() {
-		a.logger.Error(app.ContextWithError(ctx, item.E), "failed to save new user")
-		return 0, fmt.Errorf("failed to save new user: %w", item.E)
+		Map(saveUserStage("saveUser", rx.Func(a.repo.SaveUser)), rxgo.WithContext(ctx)).
+		Observe())
+	if err != nil {
+		tracing.Fail(span, err)
+		a.logger.Error(app.ContextWithError(ctx, err), "failed to save new user")
+		return 0, fmt.Errorf("failed to save new user: %w", err)
 	}
 
-	return item.V.(int), nil
+	return id, nil
 }
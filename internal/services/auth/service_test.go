@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+)
+
+// users holds one user
+type users struct {
+	user entity.User
+}
+
+func (u *users) GetUserByUsername(_ context.Context, username string) (entity.User, error) {
+	if username != u.user.Username {
+		return entity.User{}, entity.ErrUsernameNotFound
+	}
+
+	return u.user, nil
+}
+
+func (u *users) SaveUser(context.Context, entity.User) (int, error) {
+	return 0, errors.New("not supported")
+}
+
+func newTestService() (*authService, *users) {
+	repo := &users{user: entity.User{Username: "traveler", Salt: []byte("salt"), Role: entity.CommonUserRole}}
+
+	return NewAuthService(repo, app.NewLogger(app.ErrorSeverity, app.NewMemorySink()), time.Hour), repo
+}
+
+func sign(t *testing.T, claims jwt.MapClaims, key []byte) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestValidateJwt(t *testing.T) {
+	service, repo := newTestService()
+
+	token, err := service.generateJwt(context.Background(), repo.user)
+	if err != nil {
+		t.Fatalf("generateJwt failed: %s", err.Error())
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	if username, err := service.ValidateJwt(context.Background(), req, entity.CommonUserRole); err != nil || username != "traveler" {
+		t.Errorf("expected traveler, got %q, %v", username, err)
+	}
+
+	if _, err = service.ValidateJwt(context.Background(), req, entity.AdminUserRole); !errors.Is(err, entity.ErrIncorrectRole) {
+		t.Errorf("expected %v, got %v", entity.ErrIncorrectRole, err)
+	}
+}
+
+func TestValidateJwtRejectsMalformedClaims(t *testing.T) {
+	service, repo := newTestService()
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := map[string]jwt.MapClaims{
+		"missing sub":  {"role": "USER", "exp": exp},
+		"numeric sub":  {"sub": 7, "role": "USER", "exp": exp},
+		"missing role": {"sub": "traveler", "exp": exp},
+		"numeric role": {"sub": "traveler", "role": 1, "exp": exp},
+	}
+
+	for name, claims := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+sign(t, claims, repo.user.Salt))
+
+			if _, err := service.ValidateJwt(context.Background(), req, entity.AnyUserRole); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestTokenSubject(t *testing.T) {
+	service, repo := newTestService()
+	exp := time.Now().Add(time.Hour).Unix()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+sign(t, jwt.MapClaims{"sub": "traveler", "role": "USER", "exp": exp}, repo.user.Salt))
+
+	if subject, err := service.TokenSubject(context.Background(), req); err != nil || subject != "traveler" {
+		t.Errorf("expected traveler, got %q, %v", subject, err)
+	}
+
+	for _, header := range []string{
+		"",
+		"Basic abc",
+		"Bearer not-a-token",
+		"Bearer " + sign(t, jwt.MapClaims{"sub": 1}, []byte("key")),
+		// forged tokens don't get subject of any user, whether it exists or not
+		"Bearer " + sign(t, jwt.MapClaims{"sub": "traveler", "role": "USER", "exp": exp}, []byte("unknown key")),
+		"Bearer " + sign(t, jwt.MapClaims{"sub": "someone", "role": "USER", "exp": exp}, []byte("unknown key")),
+	} {
+		req.Header.Set("Authorization", header)
+
+		if subject, err := service.TokenSubject(context.Background(), req); err == nil {
+			t.Errorf("%q: expected error, got %q", header, subject)
+		}
+	}
+}
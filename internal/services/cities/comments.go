@@ -0,0 +1,177 @@
+package cities
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/reactivex/rxgo/v2"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/rx"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+	"github.com/strax84mb/go-travel-reactive/internal/tracing"
+)
+
+func commentToEvent(comment entity.Comment, poster string) CommentEvent {
+	return CommentEvent{
+		ID:       comment.ID,
+		CityID:   comment.CityID,
+		PosterID: comment.PosterID,
+		Poster:   poster,
+		Text:     comment.Text,
+		Created:  comment.Created.Format(time.RFC3339),
+		Modified: comment.Modified.Format(time.RFC3339),
+	}
+}
+
+// commentOfUser returns comment if it was posted by user, admin gets any comment when anyForAdmin is set
+func (c *cityService) commentOfUser(ctx context.Context, stage rx.StageWrapper, id int, user entity.User, anyForAdmin bool) (entity.Comment, error) {
+	comment, err := rx.Get[entity.Comment](<-rxgo.JustItem(id).
+		Map(stage("getComment", rx.Func(c.repo.GetComment)), rxgo.WithContext(ctx)).
+		Observe())
+	if err != nil {
+		return entity.Comment{}, err
+	}
+
+	if comment.PosterID != user.ID && !(anyForAdmin && user.Role == entity.AdminUserRole) {
+		return entity.Comment{}, entity.ErrNotCommentPoster
+	}
+
+	return comment, nil
+}
+
+// AddComment posts comment of user to city and announces it on comments topic
+func (c *cityService) AddComment(ctx context.Context, cityID int, username, text string) (int, error) {
+	ctx, span := tracing.Start(ctx, "cityService.AddComment")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "function", "cityService.AddComment")
+	ctx = app.ContextWithValue(ctx, "cityId", cityID)
+
+	var event CommentEvent
+
+	err := c.repo.Transaction(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		user, err := rx.Get[entity.User](<-rxgo.JustItem(username).
+			Map(addCommentStage("getUserByUsername", rx.Func(c.repo.GetUserByUsername)), rxgo.WithContext(ctx)).
+			Observe())
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		comment := entity.Comment{
+			CityID:   cityID,
+			PosterID: user.ID,
+			Text:     text,
+			Created:  now,
+			Modified: now,
+		}
+
+		comment.ID, err = rx.Get[int](<-rxgo.JustItem(comment).
+			Map(addCommentStage("addComment", rx.Func(c.repo.AddComment)), rxgo.WithContext(ctx)).
+			Observe())
+		if err != nil {
+			return err
+		}
+
+		event = commentToEvent(comment, user.Username)
+
+		return c.record(ctx, events.TopicComments, events.Created, event)
+	})
+	if err != nil {
+		tracing.Fail(span, err)
+		c.logger.Error(app.ContextWithError(ctx, err), "could not add comment")
+		return 0, fmt.Errorf("could not add comment: %w", err)
+	}
+
+	c.bus.Publish(events.TopicComments, events.Created, event)
+
+	return event.ID, nil
+}
+
+// EditComment replaces text of comment, only poster may edit it
+func (c *cityService) EditComment(ctx context.Context, id int, username, text string) error {
+	ctx, span := tracing.Start(ctx, "cityService.EditComment")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "function", "cityService.EditComment")
+	ctx = app.ContextWithValue(ctx, "commentId", id)
+
+	var event CommentEvent
+
+	err := c.repo.Transaction(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		user, err := c.repo.GetUserByUsername(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		comment, err := c.commentOfUser(ctx, editCommentStage, id, user, false)
+		if err != nil {
+			return err
+		}
+
+		comment.Text = text
+		comment.Modified = time.Now().UTC()
+
+		item := <-rxgo.JustItem(comment).Map(editCommentStage("updateComment", rx.Action(c.repo.UpdateComment)), rxgo.WithContext(ctx)).Observe()
+		if item.Error() {
+			return item.E
+		}
+
+		event = commentToEvent(comment, user.Username)
+
+		return c.record(ctx, events.TopicComments, events.Updated, event)
+	})
+	if err != nil {
+		tracing.Fail(span, err)
+		c.logger.Error(app.ContextWithError(ctx, err), "could not edit comment")
+		return fmt.Errorf("could not edit comment: %w", err)
+	}
+
+	c.bus.Publish(events.TopicComments, events.Updated, event)
+
+	return nil
+}
+
+// DeleteComment removes comment, only poster and admins may delete it
+func (c *cityService) DeleteComment(ctx context.Context, id int, username string) error {
+	ctx, span := tracing.Start(ctx, "cityService.DeleteComment")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "function", "cityService.DeleteComment")
+	ctx = app.ContextWithValue(ctx, "commentId", id)
+
+	var event CommentEvent
+
+	err := c.repo.Transaction(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		user, err := c.repo.GetUserByUsername(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		comment, err := c.commentOfUser(ctx, deleteCommentStage, id, user, true)
+		if err != nil {
+			return err
+		}
+
+		item := <-rxgo.JustItem(id).Map(deleteCommentStage("deleteComment", rx.Action(c.repo.DeleteComment)), rxgo.WithContext(ctx)).Observe()
+		if item.Error() {
+			return item.E
+		}
+
+		event = CommentEvent{ID: id, CityID: comment.CityID}
+
+		return c.record(ctx, events.TopicComments, events.Deleted, event)
+	})
+	if err != nil {
+		tracing.Fail(span, err)
+		c.logger.Error(app.ContextWithError(ctx, err), "could not delete comment")
+		return fmt.Errorf("could not delete comment: %w", err)
+	}
+
+	c.bus.Publish(events.TopicComments, events.Deleted, event)
+
+	return nil
+}
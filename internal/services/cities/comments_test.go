@@ -0,0 +1,149 @@
+package cities
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+)
+
+func newTestService(t *testing.T) (*cityService, storage.Repository, *events.Subscription) {
+	t.Helper()
+
+	cfg := app.DefaultConfig()
+	cfg.API.DbDriver = storage.DriverMemory
+
+	repo, err := storage.NewRepository(context.Background(), &cfg)
+	if err != nil {
+		t.Fatalf("could not open repository: %s", err.Error())
+	}
+
+	t.Cleanup(func() { _ = repo.Close() })
+
+	bus := events.NewBus(16)
+	sub := bus.Subscribe([]string{events.TopicComments}, "")
+	t.Cleanup(sub.Close)
+
+	return NewCityService(repo, app.NewLogger(app.ErrorSeverity, app.NewMemorySink()), bus, true), repo, sub
+}
+
+func nextEvent(t *testing.T, sub *events.Subscription) events.Event {
+	t.Helper()
+
+	select {
+	case e := <-sub.C:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("event was not published")
+		return events.Event{}
+	}
+}
+
+func addUser(t *testing.T, repo storage.Repository, username string) {
+	t.Helper()
+
+	if _, err := repo.SaveUser(context.Background(), entity.User{Username: username, Password: "p", Salt: []byte{1}, Role: entity.CommonUserRole}); err != nil {
+		t.Fatalf("SaveUser failed: %s", err.Error())
+	}
+}
+
+func TestCommentLifecycle(t *testing.T) {
+	service, repo, sub := newTestService(t)
+	ctx := context.Background()
+
+	addUser(t, repo, "bob")
+	addUser(t, repo, "eve")
+
+	id, err := service.AddComment(ctx, 1, "bob", "Nice")
+	if err != nil {
+		t.Fatalf("AddComment failed: %s", err.Error())
+	}
+
+	e := nextEvent(t, sub)
+	if created, ok := e.Data.(CommentEvent); !ok || e.Type != events.Created || created.ID != id ||
+		created.CityID != 1 || created.Poster != "bob" || created.Text != "Nice" {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	city, err := service.GetCity(ctx, 1, 5)
+	if err != nil {
+		t.Fatalf("GetCity failed: %s", err.Error())
+	}
+
+	if len(city.Comments) != 1 || city.Comments[0].ID != id || city.Comments[0].Poster != "bob" {
+		t.Errorf("comment is missing from city: %+v", city.Comments)
+	}
+
+	if err = service.EditComment(ctx, id, "eve", "Mine now"); !errors.Is(err, entity.ErrNotCommentPoster) {
+		t.Errorf("expected %v when other user edits, got %v", entity.ErrNotCommentPoster, err)
+	}
+
+	if err = service.EditComment(ctx, id, "admin", "Moderated"); !errors.Is(err, entity.ErrNotCommentPoster) {
+		t.Errorf("expected %v when admin edits, got %v", entity.ErrNotCommentPoster, err)
+	}
+
+	if err = service.EditComment(ctx, id, "bob", "Nicer"); err != nil {
+		t.Fatalf("EditComment failed: %s", err.Error())
+	}
+
+	if e = nextEvent(t, sub); e.Type != events.Updated || e.Data.(CommentEvent).Text != "Nicer" {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	if err = service.DeleteComment(ctx, id, "eve"); !errors.Is(err, entity.ErrNotCommentPoster) {
+		t.Errorf("expected %v when other user deletes, got %v", entity.ErrNotCommentPoster, err)
+	}
+
+	if err = service.DeleteComment(ctx, id, "admin"); err != nil {
+		t.Fatalf("DeleteComment failed: %s", err.Error())
+	}
+
+	if e = nextEvent(t, sub); e.Type != events.Deleted || e.Data != (CommentEvent{ID: id, CityID: 1}) {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	if err = service.DeleteComment(ctx, id, "bob"); !errors.Is(err, entity.ErrCommentNotFound) {
+		t.Errorf("expected %v, got %v", entity.ErrCommentNotFound, err)
+	}
+
+	// rejected changes publish nothing
+	select {
+	case e = <-sub.C:
+		t.Errorf("unexpected event %+v", e)
+	default:
+	}
+}
+
+func TestCommentChangesAreRecorded(t *testing.T) {
+	service, repo, _ := newTestService(t)
+	ctx := context.Background()
+
+	addUser(t, repo, "bob")
+
+	if _, err := service.AddComment(ctx, 404, "bob", "Lost"); !errors.Is(err, entity.ErrCityNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCityNotFound, err)
+	}
+
+	id, err := service.AddComment(ctx, 2, "bob", "Big apple")
+	if err != nil {
+		t.Fatalf("AddComment failed: %s", err.Error())
+	}
+
+	if err = service.DeleteComment(ctx, id, "bob"); err != nil {
+		t.Fatalf("DeleteComment failed: %s", err.Error())
+	}
+
+	list, err := repo.GetUndispatchedEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("GetUndispatchedEvents failed: %s", err.Error())
+	}
+
+	if len(list) != 2 || list[0].Topic != events.TopicComments || list[0].Type != events.Created || list[1].Type != events.Deleted {
+		t.Errorf("unexpected outbox events %+v", list)
+	}
+}
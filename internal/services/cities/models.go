@@ -2,25 +2,64 @@ package cities
 
 import (
 	"context"
+
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
 )
 
 type repository interface {
-	GetCityByNameAndCountry(ctx context.Context, city interface{}) (interface{}, error)
-	AddCity(ctx context.Context, city interface{}) (interface{}, error)
-	UpdateCity(ctx context.Context, city interface{}) (interface{}, error)
-	GetCity(ctx context.Context, id interface{}) (interface{}, error)
-	GetAllCities(ctx context.Context, nothing interface{}) (interface{}, error)
-	DeleteCity(ctx context.Context, id interface{}) (interface{}, error)
+	GetCityByNameAndCountry(ctx context.Context, city entity.City) (entity.City, error)
+	AddCity(ctx context.Context, city entity.City) (int, error)
+	UpdateCity(ctx context.Context, city entity.City) error
+	GetCity(ctx context.Context, id int) (entity.City, error)
+	GetAllCities(ctx context.Context) ([]entity.City, error)
+	ForEachCity(ctx context.Context, fn func(city entity.City) error) error
+	DeleteCity(ctx context.Context, city entity.City) error
+	GetUserByUsername(ctx context.Context, username string) (entity.User, error)
+	AddComment(ctx context.Context, comment entity.Comment) (int, error)
+	GetComment(ctx context.Context, id int) (entity.Comment, error)
+	UpdateComment(ctx context.Context, comment entity.Comment) error
+	DeleteComment(ctx context.Context, id int) error
+	GetCityComments(ctx context.Context, input entity.GetCityCommentsInput) (entity.GetCityCommentsOutput, error)
+	AddOutboxEvent(ctx context.Context, event entity.OutboxEvent) (int, error)
+	Transaction(ctx context.Context, opts storage.TxOptions, fn func(ctx context.Context) error) error
+}
+
+// publisher announces changes after they are stored
+type publisher interface {
+	Publish(topic, kind string, data interface{})
+}
+
+// CityEvent is payload of events about changed city, deleted city has only ID
+type CityEvent struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+// CommentEvent is payload of events about comments of city, deleted comment has only ID and CityID
+type CommentEvent struct {
+	ID       int    `json:"id"`
+	CityID   int    `json:"cityId"`
+	PosterID int    `json:"posterId,omitempty"`
+	Poster   string `json:"posterUsername,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Created  string `json:"created,omitempty"`
+	Modified string `json:"modified,omitempty"`
 }
 
-type cityDto struct {
+// CityDto is city with its latest comments as returned by API
+type CityDto struct {
 	ID       int          `json:"id"`
 	Name     string       `json:"name"`
 	Country  string       `json:"country"`
-	Comments []commentDto `json:"comments"`
+	Comments []CommentDto `json:"comments"`
+	// Version of stored city is exposed only through ETag
+	Version int `json:"-"`
 }
 
-type commentDto struct {
+type CommentDto struct {
+	ID       int    `json:"id"`
 	PosterID int    `json:"posterId"`
 	Poster   string `json:"posterUsername"`
 	Text     string `json:"text"`
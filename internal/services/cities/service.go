@@ -2,6 +2,8 @@ package cities
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -9,31 +11,63 @@ import (
 	"github.com/reactivex/rxgo/v2"
 	"github.com/strax84mb/go-travel-reactive/internal/app"
 	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/metrics"
+	"github.com/strax84mb/go-travel-reactive/internal/rx"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+	"github.com/strax84mb/go-travel-reactive/internal/tracing"
+)
+
+var addCityTxOptions = storage.TxOptions{
+	Isolation:  sql.LevelSerializable,
+	MaxRetries: 3,
+}
+
+// pipeline traces and measures every stage of named pipeline
+func pipeline(name string) rx.StageWrapper {
+	return rx.Chain(tracing.Pipeline(name), metrics.Pipeline(name))
+}
+
+var (
+	getCityStage       = pipeline("cityService.GetCity")
+	listCitiesStage    = pipeline("cityService.StreamCities")
+	addCityStage       = pipeline("cityService.AddCity")
+	updateCityStage    = pipeline("cityService.UpdateCity")
+	deleteCityStage    = pipeline("cityService.DeleteCity")
+	addCommentStage    = pipeline("cityService.AddComment")
+	editCommentStage   = pipeline("cityService.EditComment")
+	deleteCommentStage = pipeline("cityService.DeleteComment")
 )
 
 type cityService struct {
 	repo   repository
 	logger app.Logger
+	bus    publisher
+	// recordEvents is set when webhooks are enabled, nothing reads outbox otherwise
+	recordEvents bool
 }
 
-func NewCityService(repo repository, logger app.Logger) *cityService {
+func NewCityService(repo repository, logger app.Logger, bus publisher, recordEvents bool) *cityService {
 	return &cityService{
-		repo:   repo,
-		logger: logger,
+		repo:         repo,
+		logger:       logger,
+		bus:          bus,
+		recordEvents: recordEvents,
 	}
 }
 
-func cityToDto(ctx context.Context, item interface{}) (interface{}, error) {
-	input := item.(entity.GetCityCommentsOutput)
-	city := cityDto{
+func cityToDto(ctx context.Context, input entity.GetCityCommentsOutput) (CityDto, error) {
+	city := CityDto{
 		ID:       input.City.ID,
 		Name:     input.City.Name,
 		Country:  input.City.Country,
-		Comments: make([]commentDto, len(input.Comments)),
+		Comments: make([]CommentDto, len(input.Comments)),
+		Version:  input.City.Version,
 	}
 
 	for i, v := range input.Comments {
-		city.Comments[i] = commentDto{
+		city.Comments[i] = CommentDto{
+			ID:       v.Comment.ID,
 			PosterID: v.Comment.PosterID,
 			Poster:   v.PosterName,
 			Text:     v.Comment.Text,
@@ -45,72 +79,117 @@ func cityToDto(ctx context.Context, item interface{}) (interface{}, error) {
 	return city, nil
 }
 
-// TODO replace this with call to repository
-func addCommentsToCity(_ context.Context, item interface{}) (interface{}, error) {
-	return entity.GetCityCommentsOutput{
-		City:     item.(entity.GetCityCommentsInput).City,
-		Comments: []entity.CommentWithPosterName{},
+func toCityCommentsInput(ctx context.Context, city entity.City) (entity.GetCityCommentsInput, error) {
+	return entity.GetCityCommentsInput{
+		City:             city,
+		NumberOfComments: ctx.Value(ctxCommentNumIdx).(int),
 	}, nil
 }
 
-func (c *cityService) GetCity(ctx context.Context, id, numberOfComments int) (cityDto, error) {
+func (c *cityService) GetCity(ctx context.Context, id, numberOfComments int) (CityDto, error) {
+	ctx, span := tracing.Start(ctx, "cityService.GetCity")
+	defer span.End()
+
 	ctx = app.ContextWithValue(ctx, "function", "cityService.GetCity")
+	// every stage gets the same context since rxgo propagates options of later stages to earlier ones
+	ctx = context.WithValue(ctx, ctxCommentNumIdx, numberOfComments)
+
+	city, err := rx.Get[CityDto](<-rxgo.JustItem(id).
+		Map(getCityStage("getCity", rx.Func(c.repo.GetCity)), rxgo.WithContext(ctx)).
+		Map(getCityStage("toCityCommentsInput", rx.Func(toCityCommentsInput)), rxgo.WithContext(ctx)).
+		Map(getCityStage("addCommentsToCity", rx.Func(c.repo.GetCityComments)), rxgo.WithContext(ctx)).
+		Map(getCityStage("cityToDto", rx.Func(cityToDto)), rxgo.WithContext(ctx)).
+		Observe())
+	if err != nil {
+		tracing.Fail(span, err)
+		c.logger.Error(app.ContextWithError(ctx, err), "could not get city with ID %d", id)
+		return CityDto{}, fmt.Errorf("get city failed: %w", err)
+	}
+
+	return city, nil
+}
 
-	item := <-rxgo.JustItem(id).
-		Map(c.repo.GetCity).
-		Map(func(ctx context.Context, city interface{}) (interface{}, error) {
-			return entity.GetCityCommentsInput{
-				City:             city.(entity.City),
-				NumberOfComments: ctx.Value(ctxCommentNumIdx).(int),
-			}, nil
-		}, rxgo.WithContext(context.WithValue(ctx, ctxCommentNumIdx, numberOfComments))).
-		Map(addCommentsToCity).
-		Map(cityToDto).
-		Observe()
-	if item.Error() {
-		c.logger.Error(app.ContextWithError(ctx, item.E), "could not get city with ID %d", id)
-		return cityDto{}, fmt.Errorf("get city failed: %w", item.E)
+func (c *cityService) ListAllCities(ctx context.Context, numberOfComments int) ([]CityDto, error) {
+	var list []CityDto
+
+	err := c.StreamCities(ctx, numberOfComments, func(city CityDto) error {
+		list = append(list, city)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list all cities: %w", err)
 	}
 
-	return item.V.(cityDto), nil
+	return list, nil
 }
 
-func (c *cityService) ListAllCities(ctx context.Context, numberOfComments int) ([]cityDto, error) {
-	ctx = app.ContextWithValue(ctx, "function", "cityService.ListAllCities")
+// StreamCities passes cities to fn one by one as rows are read. Rows are read only as fast as fn
+// consumes them and reading stops when fn fails or ctx is canceled.
+func (c *cityService) StreamCities(ctx context.Context, numberOfComments int, fn func(city CityDto) error) error {
+	ctx, span := tracing.Start(ctx, "cityService.StreamCities")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "function", "cityService.StreamCities")
+	// every stage gets the same context since rxgo propagates options of later stages to earlier ones
+	ctx = context.WithValue(ctx, ctxCommentNumIdx, numberOfComments)
+
+	// stops producer and stages when fn fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	obs := rxgo.Defer([]rxgo.Producer{c.produceCities}, rxgo.WithContext(ctx)).
+		Map(listCitiesStage("toCityCommentsInput", rx.Func(toCityCommentsInput)), rxgo.WithContext(ctx)).
+		Map(listCitiesStage("addCommentsToCity", rx.Func(c.repo.GetCityComments)), rxgo.WithContext(ctx)).
+		Map(listCitiesStage("cityToDto", rx.Func(cityToDto)), rxgo.WithContext(ctx))
+
+	for item := range obs.Observe(rxgo.WithContext(ctx)) {
+		dto, err := rx.Get[CityDto](item)
+		if err == nil {
+			err = fn(dto)
+		}
 
-	obs := rxgo.Just(true)().
-		Map(c.repo.GetAllCities).
-		FlatMap(func(i rxgo.Item) rxgo.Observable {
-			cities := i.V.([]entity.City)
-			result := make([]interface{}, len(cities))
+		if err != nil {
+			tracing.Fail(span, err)
+			c.logger.Error(app.ContextWithError(ctx, err), "could not stream cities")
 
-			for i, v := range cities {
-				result[i] = v
-			}
+			return err
+		}
+	}
 
-			return rxgo.Just(result...)()
-		}).
-		Map(func(ctx context.Context, city interface{}) (interface{}, error) {
-			return entity.GetCityCommentsInput{
-				City:             city.(entity.City),
-				NumberOfComments: ctx.Value(ctxCommentNumIdx).(int),
-			}, nil
-		}, rxgo.WithContext(context.WithValue(ctx, ctxCommentNumIdx, numberOfComments))).
-		Map(addCommentsToCity).
-		Map(cityToDto)
-
-	var list []cityDto
-
-	for dto := range obs.Observe() {
-		if dto.Error() {
-			c.logger.Error(app.ContextWithError(ctx, dto.E), "could not list all cities")
-			return nil, fmt.Errorf("could not list all cities: %w", dto.E)
+	return ctx.Err()
+}
+
+// produceCities emits cities while they are read, unbuffered channel makes reading wait for consumers.
+// When comments are requested all cities are read first, since rows would otherwise hold connection
+// which loading of comments needs and SQLite has only one.
+func (c *cityService) produceCities(ctx context.Context, next chan<- rxgo.Item) {
+	emit := func(city entity.City) error {
+		if !rxgo.Of(city).SendContext(ctx, next) {
+			return ctx.Err()
 		}
 
-		list = append(list, dto.V.(cityDto))
+		return nil
 	}
 
-	return list, nil
+	var err error
+
+	if n, _ := ctx.Value(ctxCommentNumIdx).(int); n > 0 {
+		var list []entity.City
+
+		if list, err = c.repo.GetAllCities(ctx); err == nil {
+			for _, city := range list {
+				if err = emit(city); err != nil {
+					break
+				}
+			}
+		}
+	} else {
+		err = c.repo.ForEachCity(ctx, emit)
+	}
+
+	if err != nil {
+		rxgo.Error(err).SendContext(ctx, next)
+	}
 }
 
 func checkIfCityExists(_ context.Context, item interface{}, city interface{}) (interface{}, error) {
@@ -129,54 +208,131 @@ func currentTime(_ interface{}) time.Time {
 	return time.Now()
 }
 
+// record adds event to outbox, ctx has to carry transaction of the change so that both are stored or neither is
+func (c *cityService) record(ctx context.Context, topic, kind string, data interface{}) error {
+	if !c.recordEvents {
+		return nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.repo.AddOutboxEvent(ctx, entity.OutboxEvent{
+		Topic:   topic,
+		Type:    kind,
+		Payload: payload,
+		Created: time.Now().UTC(),
+	})
+
+	return err
+}
+
 func (c *cityService) AddCity(ctx context.Context, name, country string) (int, error) {
+	ctx, span := tracing.Start(ctx, "cityService.AddCity")
+	defer span.End()
+
 	ctx = app.ContextWithValue(ctx, "function", "cityService.AddCity")
 	city := entity.City{
 		Name:    name,
 		Country: country,
 	}
 
-	item := <-rxgo.Just(city)().
-		Map(c.repo.GetCityByNameAndCountry).
-		OnErrorReturn(func(err error) interface{} {
+	var id int
+
+	// check and insert run in one transaction so concurrent requests can't add the same city twice
+	err := c.repo.Transaction(ctx, addCityTxOptions, func(ctx context.Context) error {
+		var err error
+
+		id, err = rx.Get[int](<-rxgo.Just(city)().
+			Map(addCityStage("getCityByNameAndCountry", rx.Func(c.repo.GetCityByNameAndCountry)), rxgo.WithContext(ctx)).
+			OnErrorReturn(func(err error) interface{} {
+				return err
+			}).
+			Join(checkIfCityExists, rxgo.Just(city)(), currentTime, rxgo.WithDuration(5*time.Second)).
+			Map(addCityStage("addCity", rx.Func(c.repo.AddCity)), rxgo.WithContext(ctx)).
+			Observe())
+		if err != nil {
 			return err
-		}).
-		Join(checkIfCityExists, rxgo.Just(city)(), currentTime, rxgo.WithDuration(5*time.Second)).
-		Map(c.repo.AddCity).
-		Observe()
-	if item.Error() {
-		c.logger.Error(app.ContextWithError(ctx, item.E), "could not add city")
-		return 0, fmt.Errorf("could not add city: %w", item.E)
+		}
+
+		return c.record(ctx, events.TopicCities, events.Created, CityEvent{ID: id, Name: name, Country: country})
+	})
+	if err != nil {
+		tracing.Fail(span, err)
+		c.logger.Error(app.ContextWithError(ctx, err), "could not add city")
+		return 0, fmt.Errorf("could not add city: %w", err)
 	}
 
-	return item.V.(int), nil
+	c.bus.Publish(events.TopicCities, events.Created, CityEvent{ID: id, Name: name, Country: country})
+
+	return id, nil
 }
 
-func (c *cityService) UpdateCity(ctx context.Context, id int, name, country string) error {
+// UpdateCity changes city only if it still has version, zero version updates any version
+func (c *cityService) UpdateCity(ctx context.Context, id, version int, name, country string) error {
+	ctx, span := tracing.Start(ctx, "cityService.UpdateCity")
+	defer span.End()
+
 	ctx = app.ContextWithValue(ctx, "function", "cityService.UpdateCity")
 	city := entity.City{
 		ID:      id,
 		Name:    name,
 		Country: country,
+		Version: version,
 	}
 
-	item := <-rxgo.JustItem(city).Map(c.repo.UpdateCity).Observe()
-	if item.Error() {
-		c.logger.Error(app.ContextWithError(ctx, item.E), "could not update city")
-		return fmt.Errorf("could not update city: %w", item.E)
+	event := CityEvent{ID: id, Name: name, Country: country}
+
+	err := c.repo.Transaction(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		item := <-rxgo.JustItem(city).Map(updateCityStage("updateCity", rx.Action(c.repo.UpdateCity)), rxgo.WithContext(ctx)).Observe()
+		if item.Error() {
+			return item.E
+		}
+
+		return c.record(ctx, events.TopicCities, events.Updated, event)
+	})
+	if err != nil {
+		tracing.Fail(span, err)
+		c.logger.Error(app.ContextWithError(ctx, err), "could not update city")
+		return fmt.Errorf("could not update city: %w", err)
 	}
 
+	c.bus.Publish(events.TopicCities, events.Updated, event)
+
 	return nil
 }
 
-func (c *cityService) DeleteCity(ctx context.Context, id int) error {
+// DeleteCity removes city only if it still has version, zero version deletes any version
+func (c *cityService) DeleteCity(ctx context.Context, id, version int) error {
+	ctx, span := tracing.Start(ctx, "cityService.DeleteCity")
+	defer span.End()
+
 	ctx = app.ContextWithValue(ctx, "function", "cityService.DeleteCity")
 
-	item := <-rxgo.JustItem(id).Map(c.repo.DeleteCity).Observe()
-	if item.Error() {
-		c.logger.Error(app.ContextWithError(ctx, item.E), "could not delete city")
-		return fmt.Errorf("could not delete city: %w", item.E)
+	city := entity.City{
+		ID:      id,
+		Version: version,
 	}
 
+	event := CityEvent{ID: id}
+
+	err := c.repo.Transaction(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		item := <-rxgo.JustItem(city).Map(deleteCityStage("deleteCity", rx.Action(c.repo.DeleteCity)), rxgo.WithContext(ctx)).Observe()
+		if item.Error() {
+			return item.E
+		}
+
+		return c.record(ctx, events.TopicCities, events.Deleted, event)
+	})
+	if err != nil {
+		tracing.Fail(span, err)
+		c.logger.Error(app.ContextWithError(ctx, err), "could not delete city")
+		return fmt.Errorf("could not delete city: %w", err)
+	}
+
+	c.bus.Publish(events.TopicCities, events.Deleted, event)
+
 	return nil
 }
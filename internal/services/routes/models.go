@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"context"
+
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+)
+
+type repository interface {
+	AddRoute(ctx context.Context, route entity.Route) (int, error)
+	GetRoute(ctx context.Context, id int) (entity.Route, error)
+	UpdateRoutePrice(ctx context.Context, id int, price float64) error
+	AddOutboxEvent(ctx context.Context, event entity.OutboxEvent) (int, error)
+	Transaction(ctx context.Context, opts storage.TxOptions, fn func(ctx context.Context) error) error
+}
+
+// publisher announces changes after they are stored
+type publisher interface {
+	Publish(topic, kind string, data interface{})
+}
+
+// RouteDto is direct flight between airports with its price
+type RouteDto struct {
+	ID            int     `json:"id"`
+	SourceID      int     `json:"sourceId"`
+	DestinationID int     `json:"destinationId"`
+	Price         float64 `json:"price"`
+}
+
+// PriceEvent is payload of events about changed price of route
+type PriceEvent struct {
+	RouteID       int     `json:"routeId"`
+	SourceID      int     `json:"sourceId"`
+	DestinationID int     `json:"destinationId"`
+	OldPrice      float64 `json:"oldPrice"`
+	Price         float64 `json:"price"`
+}
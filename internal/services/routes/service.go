@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/reactivex/rxgo/v2"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/metrics"
+	"github.com/strax84mb/go-travel-reactive/internal/rx"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+	"github.com/strax84mb/go-travel-reactive/internal/tracing"
+)
+
+// pipeline traces and measures every stage of named pipeline
+func pipeline(name string) rx.StageWrapper {
+	return rx.Chain(tracing.Pipeline(name), metrics.Pipeline(name))
+}
+
+var (
+	addRouteStage    = pipeline("routeService.AddRoute")
+	updatePriceStage = pipeline("routeService.UpdatePrice")
+)
+
+type routeService struct {
+	repo   repository
+	logger app.Logger
+	bus    publisher
+	// recordEvents is set when webhooks are enabled, nothing reads outbox otherwise
+	recordEvents bool
+}
+
+func NewRouteService(repo repository, logger app.Logger, bus publisher, recordEvents bool) *routeService {
+	return &routeService{
+		repo:         repo,
+		logger:       logger,
+		bus:          bus,
+		recordEvents: recordEvents,
+	}
+}
+
+func routeToDto(route entity.Route) RouteDto {
+	return RouteDto{
+		ID:            route.ID,
+		SourceID:      route.SourceID,
+		DestinationID: route.DestinationID,
+		Price:         route.Price,
+	}
+}
+
+// record adds event to outbox, ctx has to carry transaction of the change so that both are stored or neither is
+func (s *routeService) record(ctx context.Context, topic, kind string, data interface{}) error {
+	if !s.recordEvents {
+		return nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.AddOutboxEvent(ctx, entity.OutboxEvent{
+		Topic:   topic,
+		Type:    kind,
+		Payload: payload,
+		Created: time.Now().UTC(),
+	})
+
+	return err
+}
+
+// AddRoute adds direct flight between airports and announces it on routes topic
+func (s *routeService) AddRoute(ctx context.Context, sourceID, destinationID int, price float64) (RouteDto, error) {
+	ctx, span := tracing.Start(ctx, "routeService.AddRoute")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "function", "routeService.AddRoute")
+	route := entity.Route{
+		SourceID:      sourceID,
+		DestinationID: destinationID,
+		Price:         price,
+	}
+
+	err := s.repo.Transaction(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		var err error
+
+		route.ID, err = rx.Get[int](<-rxgo.JustItem(route).
+			Map(addRouteStage("addRoute", rx.Func(s.repo.AddRoute)), rxgo.WithContext(ctx)).
+			Observe())
+		if err != nil {
+			return err
+		}
+
+		return s.record(ctx, events.TopicRoutes, events.Created, routeToDto(route))
+	})
+	if err != nil {
+		tracing.Fail(span, err)
+		s.logger.Error(app.ContextWithError(ctx, err), "could not add route")
+		return RouteDto{}, fmt.Errorf("could not add route: %w", err)
+	}
+
+	s.bus.Publish(events.TopicRoutes, events.Created, routeToDto(route))
+
+	return routeToDto(route), nil
+}
+
+// UpdatePrice changes price of route and announces old and new price on prices topic
+func (s *routeService) UpdatePrice(ctx context.Context, id int, price float64) error {
+	ctx, span := tracing.Start(ctx, "routeService.UpdatePrice")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "function", "routeService.UpdatePrice")
+	ctx = app.ContextWithValue(ctx, "routeId", id)
+
+	var event PriceEvent
+
+	err := s.repo.Transaction(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		route, err := rx.Get[entity.Route](<-rxgo.JustItem(id).
+			Map(updatePriceStage("getRoute", rx.Func(s.repo.GetRoute)), rxgo.WithContext(ctx)).
+			Observe())
+		if err != nil {
+			return err
+		}
+
+		if err = s.repo.UpdateRoutePrice(ctx, id, price); err != nil {
+			return err
+		}
+
+		event = PriceEvent{
+			RouteID:       id,
+			SourceID:      route.SourceID,
+			DestinationID: route.DestinationID,
+			OldPrice:      route.Price,
+			Price:         price,
+		}
+
+		return s.record(ctx, events.TopicPrices, events.Updated, event)
+	})
+	if err != nil {
+		tracing.Fail(span, err)
+		s.logger.Error(app.ContextWithError(ctx, err), "could not update price")
+		return fmt.Errorf("could not update price: %w", err)
+	}
+
+	s.bus.Publish(events.TopicPrices, events.Updated, event)
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+)
+
+func TestPriceChangeIsPublished(t *testing.T) {
+	ctx := context.Background()
+	cfg := app.DefaultConfig()
+	cfg.API.DbDriver = storage.DriverMemory
+
+	repo, err := storage.NewRepository(ctx, &cfg)
+	if err != nil {
+		t.Fatalf("could not open repository: %s", err.Error())
+	}
+
+	defer repo.Close()
+
+	bus := events.NewBus(16)
+	defer bus.Close()
+
+	sub := bus.Subscribe([]string{events.TopicPrices}, "")
+
+	// outbox stays empty while webhooks are disabled
+	service := NewRouteService(repo, app.NewLogger(app.ErrorSeverity, app.NewMemorySink()), bus, false)
+
+	source, _ := repo.AddAirport(ctx, entity.Airport{AirportID: 1, Name: "source", CityID: 1})
+	destination, _ := repo.AddAirport(ctx, entity.Airport{AirportID: 2, Name: "destination", CityID: 2})
+
+	route, err := service.AddRoute(ctx, source, destination, 50)
+	if err != nil {
+		t.Fatalf("AddRoute failed: %s", err.Error())
+	}
+
+	if err = service.UpdatePrice(ctx, route.ID, 75); err != nil {
+		t.Fatalf("UpdatePrice failed: %s", err.Error())
+	}
+
+	select {
+	case e := <-sub.C:
+		expected := PriceEvent{RouteID: route.ID, SourceID: source, DestinationID: destination, OldPrice: 50, Price: 75}
+		if e.Type != events.Updated || e.Data != expected {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("price change was not published")
+	}
+
+	if list, err := repo.GetUndispatchedEvents(ctx, 10); err != nil || len(list) != 0 {
+		t.Errorf("expected empty outbox, got %+v, %v", list, err)
+	}
+}
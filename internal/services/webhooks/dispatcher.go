@@ -0,0 +1,291 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/metrics"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+	"github.com/strax84mb/go-travel-reactive/internal/tracing"
+)
+
+// Headers of webhook requests
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	IDHeader        = "X-Webhook-ID"
+	EventHeader     = "X-Webhook-Event"
+)
+
+// maxResponseBytes of receiver response are read so that connection can be reused
+const maxResponseBytes = 64 << 10
+
+// Dispatcher turns outbox events into deliveries of subscriptions and sends them
+// until they are delivered or dead. Several dispatchers may share one database.
+type Dispatcher struct {
+	repo   dispatchRepository
+	logger app.Logger
+	cfg    app.WebhooksConfig
+	client *http.Client
+}
+
+func NewDispatcher(repo dispatchRepository, logger app.Logger, cfg app.WebhooksConfig) *Dispatcher {
+	return &Dispatcher{
+		repo:   repo,
+		logger: logger,
+		cfg:    cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// receiver has to answer on subscribed URL
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Run polls outbox and due deliveries until ctx is done. Interrupted deliveries stay
+// claimed until their lease ends and are sent again afterwards.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.fanOut(ctx)
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fanOut adds delivery of every undispatched event for each subscription which wants it,
+// event is claimed in the same transaction so that it is fanned out only once
+func (d *Dispatcher) fanOut(ctx context.Context) {
+	ctx = app.ContextWithValue(ctx, "function", "Dispatcher.fanOut")
+
+	list, err := d.repo.GetUndispatchedEvents(ctx, d.cfg.BatchSize)
+	if err != nil || len(list) == 0 {
+		d.fail(ctx, err, "could not get outbox events")
+		return
+	}
+
+	subscriptions, err := d.repo.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		d.fail(ctx, err, "could not get webhook subscriptions")
+		return
+	}
+
+	for _, event := range list {
+		err = d.repo.Transaction(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+			now := time.Now().UTC()
+
+			claimed, err := d.repo.ClaimOutboxEvent(ctx, event.ID, now)
+			if err != nil || !claimed {
+				return err
+			}
+
+			for _, s := range subscriptions {
+				if !s.Wants(event.Topic) {
+					continue
+				}
+
+				_, err = d.repo.AddWebhookDelivery(ctx, entity.WebhookDelivery{
+					EventID:        event.ID,
+					SubscriptionID: s.ID,
+					Status:         entity.DeliveryPending,
+					NextAttempt:    now,
+					Updated:        now,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			d.fail(app.ContextWithValue(ctx, "eventId", event.ID), err, "could not dispatch outbox event")
+			return
+		}
+	}
+}
+
+// deliverDue sends due deliveries with at most Workers requests at once
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	ctx = app.ContextWithValue(ctx, "function", "Dispatcher.deliverDue")
+
+	due, err := d.repo.GetDueDeliveries(ctx, time.Now().UTC(), d.cfg.BatchSize)
+	if err != nil || len(due) == 0 {
+		d.fail(ctx, err, "could not get due webhook deliveries")
+		return
+	}
+
+	jobs := make(chan entity.DueDelivery)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < d.cfg.Workers && i < len(due); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				d.deliver(ctx, job)
+			}
+		}()
+	}
+
+	for _, job := range due {
+		if ctx.Err() != nil {
+			break
+		}
+
+		jobs <- job
+	}
+
+	close(jobs)
+	wg.Wait()
+}
+
+// deliver claims delivery, sends it and stores outcome
+func (d *Dispatcher) deliver(ctx context.Context, due entity.DueDelivery) {
+	ctx, span := tracing.Start(ctx, "Dispatcher.deliver")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "deliveryId", due.Delivery.ID)
+
+	// lease outlasts request so that nobody else sends delivery in the meantime
+	now := time.Now().UTC()
+
+	claimed, err := d.repo.ClaimDelivery(ctx, due.Delivery.ID, now, now.Add(2*d.cfg.Timeout))
+	if err != nil || !claimed {
+		d.fail(ctx, err, "could not claim webhook delivery")
+		return
+	}
+
+	err = d.send(ctx, due)
+	if err != nil && ctx.Err() != nil {
+		// shutting down, delivery is sent again when lease ends
+		return
+	}
+
+	delivery := due.Delivery
+	delivery.Attempts++
+	delivery.Updated = time.Now().UTC()
+	delivery.LastError = ""
+
+	switch {
+	case err == nil:
+		delivery.Status = entity.DeliveryDelivered
+		metrics.WebhookDeliveries.WithLabelValues("delivered").Inc()
+	case delivery.Attempts >= d.cfg.MaxAttempts:
+		tracing.Fail(span, err)
+		delivery.Status = entity.DeliveryDead
+		delivery.LastError = err.Error()
+		metrics.WebhookDeliveries.WithLabelValues("dead").Inc()
+		d.logger.Warn(app.ContextWithError(ctx, err), "webhook delivery is dead after %d attempts", delivery.Attempts)
+	default:
+		tracing.Fail(span, err)
+		delivery.NextAttempt = delivery.Updated.Add(d.backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+		metrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+		d.logger.Debug(app.ContextWithError(ctx, err), "webhook delivery failed, retrying at %s", delivery.NextAttempt.Format(time.RFC3339))
+	}
+
+	// outcome of sent request is stored even when shutdown started meanwhile
+	if err = d.repo.UpdateDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		d.fail(ctx, err, "could not update webhook delivery")
+	}
+}
+
+// backoff is wait after failed attempt, it doubles with every attempt up to MaxBackoff
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.cfg.InitialBackoff
+
+	for i := 1; i < attempts && wait < d.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > d.cfg.MaxBackoff {
+		return d.cfg.MaxBackoff
+	}
+
+	return wait
+}
+
+// send posts signed event, only 2xx response counts as delivered
+func (d *Dispatcher) send(ctx context.Context, due entity.DueDelivery) error {
+	body, err := json.Marshal(payload{
+		ID:    due.Event.ID,
+		Topic: due.Event.Topic,
+		Type:  due.Event.Type,
+		Time:  due.Event.Created.Format(time.RFC3339Nano),
+		Data:  due.Event.Payload,
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, due.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, strconv.Itoa(due.Event.ID))
+	req.Header.Set(EventHeader, due.Event.Topic+"."+due.Event.Type)
+	req.Header.Set(SignatureHeader, Sign(due.Secret, time.Now().Unix(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns value of X-Webhook-Signature header, t is unix time of sending and v1 is
+// hex encoded HMAC-SHA256 of t, dot and body with subscription secret as key
+func Sign(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// fail logs error unless it is nil or caused by shutdown
+func (d *Dispatcher) fail(ctx context.Context, err error, message string) {
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+
+	d.logger.Error(app.ContextWithError(ctx, err), message)
+}
@@ -0,0 +1,353 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/services/routes"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+)
+
+// receiver answers webhook requests with statuses in order, the last one is repeated
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.requests = append(rc.requests, receivedRequest{header: r.Header.Clone(), body: body})
+
+	status := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() []receivedRequest {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return append([]receivedRequest(nil), rc.requests...)
+}
+
+type fixture struct {
+	repo       storage.Repository
+	service    *webhookService
+	dispatcher *Dispatcher
+	receiver   *receiver
+	url        string
+}
+
+func newFixture(t *testing.T, statuses ...int) *fixture {
+	t.Helper()
+
+	cfg := app.DefaultConfig()
+	cfg.API.DbDriver = storage.DriverMemory
+
+	repo, err := storage.NewRepository(context.Background(), &cfg)
+	if err != nil {
+		t.Fatalf("could not open repository: %s", err.Error())
+	}
+
+	t.Cleanup(func() { _ = repo.Close() })
+
+	rc := &receiver{statuses: statuses}
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	logger := app.NewLogger(app.ErrorSeverity, app.NewMemorySink())
+
+	return &fixture{
+		repo:    repo,
+		service: NewWebhookService(repo, logger),
+		dispatcher: NewDispatcher(repo, logger, app.WebhooksConfig{
+			PollInterval:   time.Millisecond,
+			BatchSize:      10,
+			Timeout:        time.Second,
+			Workers:        2,
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     2 * time.Millisecond,
+		}),
+		receiver: rc,
+		url:      server.URL + "/hook",
+	}
+}
+
+func (f *fixture) subscribe(t *testing.T, topics ...string) SubscriptionDto {
+	t.Helper()
+
+	subscription, err := f.service.AddSubscription(context.Background(), f.url, topics)
+	if err != nil {
+		t.Fatalf("AddSubscription failed: %s", err.Error())
+	}
+
+	return subscription
+}
+
+func (f *fixture) addEvent(t *testing.T, topic string) int {
+	t.Helper()
+
+	id, err := f.repo.AddOutboxEvent(context.Background(), entity.OutboxEvent{
+		Topic:   topic,
+		Type:    events.Updated,
+		Payload: []byte(`{"id":1,"name":"Paris","country":"France"}`),
+		Created: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("AddOutboxEvent failed: %s", err.Error())
+	}
+
+	return id
+}
+
+// dispatchUntil runs dispatcher rounds until only deliveries with status are left
+func (f *fixture) dispatchUntil(t *testing.T, subscriptionID int, status entity.DeliveryStatus) []DeliveryDto {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		f.dispatcher.fanOut(context.Background())
+		f.dispatcher.deliverDue(context.Background())
+
+		deliveries, err := f.service.ListDeliveries(context.Background(), subscriptionID, "")
+		if err != nil {
+			t.Fatalf("ListDeliveries failed: %s", err.Error())
+		}
+
+		done := len(deliveries) > 0
+		for _, d := range deliveries {
+			done = done && d.Status == string(status)
+		}
+
+		if done {
+			return deliveries
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries did not become %s: %+v", status, deliveries)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcherSignsDelivery(t *testing.T) {
+	f := newFixture(t, http.StatusNoContent)
+	subscription := f.subscribe(t, events.TopicCities)
+	eventID := f.addEvent(t, events.TopicCities)
+
+	// event of topic which subscription doesn't want is not delivered
+	f.addEvent(t, "other")
+
+	deliveries := f.dispatchUntil(t, subscription.ID, entity.DeliveryDelivered)
+	if len(deliveries) != 1 || deliveries[0].EventID != eventID || deliveries[0].Attempts != 1 {
+		t.Fatalf("unexpected deliveries %+v", deliveries)
+	}
+
+	requests := f.receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("expected one request, got %d", len(requests))
+	}
+
+	req := requests[0]
+
+	if got := req.header.Get(IDHeader); got != strconv.Itoa(eventID) {
+		t.Errorf("unexpected %s %q", IDHeader, got)
+	}
+
+	if got := req.header.Get(EventHeader); got != "cities.updated" {
+		t.Errorf("unexpected %s %q", EventHeader, got)
+	}
+
+	// signature is verified the way docs/webhooks.md tells receivers to
+	signature := req.header.Get(SignatureHeader)
+
+	t.Run("signature", func(t *testing.T) {
+		parts := strings.Split(signature, ",")
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "t=") {
+			t.Fatalf("malformed signature %q", signature)
+		}
+
+		timestamp, err := strconv.ParseInt(strings.TrimPrefix(parts[0], "t="), 10, 64)
+		if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+			t.Fatalf("invalid signature time %q", parts[0])
+		}
+
+		if expected := Sign(subscription.Secret, timestamp, req.body); !hmac.Equal([]byte(expected), []byte(signature)) {
+			t.Errorf("signature %q doesn't match body, expected %q", signature, expected)
+		}
+
+		if Sign("other secret", timestamp, req.body) == signature {
+			t.Error("signature doesn't depend on secret")
+		}
+	})
+
+	var body payload
+	if err := json.Unmarshal(req.body, &body); err != nil {
+		t.Fatalf("invalid body: %s", err.Error())
+	}
+
+	if body.ID != eventID || body.Topic != events.TopicCities || body.Type != events.Updated ||
+		string(body.Data) != `{"id":1,"name":"Paris","country":"France"}` {
+		t.Errorf("unexpected body %s", req.body)
+	}
+}
+
+func TestDispatcherRetriesFailedDelivery(t *testing.T) {
+	f := newFixture(t, http.StatusInternalServerError, http.StatusFound, http.StatusOK)
+	subscription := f.subscribe(t, events.TopicCities)
+	f.addEvent(t, events.TopicCities)
+
+	deliveries := f.dispatchUntil(t, subscription.ID, entity.DeliveryDelivered)
+	if deliveries[0].Attempts != 3 || deliveries[0].LastError != "" {
+		t.Errorf("unexpected delivery %+v", deliveries[0])
+	}
+
+	requests := f.receiver.received()
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+
+	for _, req := range requests[1:] {
+		if req.header.Get(IDHeader) != requests[0].header.Get(IDHeader) {
+			t.Errorf("retry has different %s", IDHeader)
+		}
+	}
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	f := newFixture(t, http.StatusServiceUnavailable)
+	subscription := f.subscribe(t, events.TopicCities)
+	f.addEvent(t, events.TopicCities)
+
+	deliveries := f.dispatchUntil(t, subscription.ID, entity.DeliveryDead)
+	if deliveries[0].Attempts != 3 || deliveries[0].LastError != "receiver responded with 503" {
+		t.Errorf("unexpected delivery %+v", deliveries[0])
+	}
+
+	// dead delivery waits for replay
+	f.dispatcher.deliverDue(context.Background())
+
+	if requests := f.receiver.received(); len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+
+	f.receiver.mu.Lock()
+	f.receiver.statuses = []int{http.StatusOK}
+	f.receiver.mu.Unlock()
+
+	if err := f.service.ReplayDelivery(context.Background(), subscription.ID, deliveries[0].ID); err != nil {
+		t.Fatalf("ReplayDelivery failed: %s", err.Error())
+	}
+
+	f.dispatchUntil(t, subscription.ID, entity.DeliveryDelivered)
+
+	if err := f.service.ReplayDelivery(context.Background(), subscription.ID, deliveries[0].ID); err == nil {
+		t.Error("expected error when replaying delivered delivery")
+	}
+}
+
+func TestDispatcherDeliversCommittedChangesOnly(t *testing.T) {
+	f := newFixture(t, http.StatusNoContent)
+	subscription := f.subscribe(t, events.TopicRoutes, events.TopicPrices)
+	ctx := context.Background()
+	service := routes.NewRouteService(f.repo, app.NewLogger(app.ErrorSeverity, app.NewMemorySink()), events.NewBus(16), true)
+
+	var airports []int
+
+	for i, cityID := range []int{1, 2} {
+		id, err := f.repo.AddAirport(ctx, entity.Airport{AirportID: 100 + i, Name: "airport", CityID: cityID})
+		if err != nil {
+			t.Fatalf("AddAirport failed: %s", err.Error())
+		}
+
+		airports = append(airports, id)
+	}
+
+	route, err := service.AddRoute(ctx, airports[0], airports[1], 99.5)
+	if err != nil {
+		t.Fatalf("AddRoute failed: %s", err.Error())
+	}
+
+	// failed changes are rolled back together with their events
+	if _, err = service.AddRoute(ctx, airports[0], airports[1]+100, 10); !errors.Is(err, entity.ErrAirportNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrAirportNotFound, err)
+	}
+
+	if err = service.UpdatePrice(ctx, route.ID+100, 10); !errors.Is(err, entity.ErrRouteNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrRouteNotFound, err)
+	}
+
+	errRollback := errors.New("rollback")
+
+	err = f.repo.Transaction(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		if _, err := f.repo.AddOutboxEvent(ctx, entity.OutboxEvent{Topic: events.TopicPrices, Type: events.Updated, Payload: []byte(`{}`), Created: time.Now().UTC()}); err != nil {
+			return err
+		}
+
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("expected %v, got %v", errRollback, err)
+	}
+
+	if err = service.UpdatePrice(ctx, route.ID, 120); err != nil {
+		t.Fatalf("UpdatePrice failed: %s", err.Error())
+	}
+
+	deliveries := f.dispatchUntil(t, subscription.ID, entity.DeliveryDelivered)
+
+	// events are fanned out once however many rounds run
+	f.dispatcher.fanOut(ctx)
+	f.dispatcher.deliverDue(ctx)
+
+	if deliveries, err = f.service.ListDeliveries(ctx, subscription.ID, ""); err != nil || len(deliveries) != 2 {
+		t.Fatalf("expected 2 deliveries, got %+v, %v", deliveries, err)
+	}
+
+	requests := f.receiver.received()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+
+	kinds := map[string]string{}
+	for _, req := range requests {
+		kinds[req.header.Get(EventHeader)] = string(req.body)
+	}
+
+	if _, ok := kinds["routes.created"]; !ok {
+		t.Errorf("route was not delivered: %v", kinds)
+	}
+
+	if body := kinds["prices.updated"]; !strings.Contains(body, `"oldPrice":99.5,"price":120`) {
+		t.Errorf("unexpected price change %s", body)
+	}
+}
@@ -0,0 +1,59 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+)
+
+type repository interface {
+	AddWebhookSubscription(ctx context.Context, s entity.WebhookSubscription) (int, error)
+	GetWebhookSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, id int) error
+	GetWebhookDeliveries(ctx context.Context, subscriptionID int, status entity.DeliveryStatus) ([]entity.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, subscriptionID, deliveryID int, now time.Time) error
+}
+
+// dispatchRepository is used by Dispatcher
+type dispatchRepository interface {
+	GetUndispatchedEvents(ctx context.Context, limit int) ([]entity.OutboxEvent, error)
+	ClaimOutboxEvent(ctx context.Context, id int, at time.Time) (bool, error)
+	GetWebhookSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error)
+	AddWebhookDelivery(ctx context.Context, d entity.WebhookDelivery) (int, error)
+	GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]entity.DueDelivery, error)
+	ClaimDelivery(ctx context.Context, id int, now, until time.Time) (bool, error)
+	UpdateDelivery(ctx context.Context, d entity.WebhookDelivery) error
+	Transaction(ctx context.Context, opts storage.TxOptions, fn func(ctx context.Context) error) error
+}
+
+// SubscriptionDto is webhook subscription as returned by API, secret is returned only when subscription is added
+type SubscriptionDto struct {
+	ID      int      `json:"id"`
+	URL     string   `json:"url"`
+	Topics  []string `json:"topics"`
+	Secret  string   `json:"secret,omitempty"`
+	Created string   `json:"created"`
+}
+
+type DeliveryDto struct {
+	ID          int    `json:"id"`
+	EventID     int    `json:"eventId"`
+	Status      string `json:"status"`
+	Attempts    int    `json:"attempts"`
+	NextAttempt string `json:"nextAttempt"`
+	LastError   string `json:"lastError,omitempty"`
+	Updated     string `json:"updated"`
+}
+
+// payload is body of webhook request, signed as described in docs/webhooks.md
+type payload struct {
+	ID    int    `json:"id"`
+	Topic string `json:"topic"`
+	Type  string `json:"type"`
+	Time  string `json:"time"`
+	// Data is payload of outbox event
+	Data json.RawMessage `json:"data"`
+}
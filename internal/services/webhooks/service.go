@@ -0,0 +1,213 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/tracing"
+)
+
+// secretBytes is length of generated signing secrets
+const secretBytes = 32
+
+var (
+	ErrInvalidURL   = errors.New("url has to be absolute http or https URL")
+	ErrUnknownTopic = errors.New("unknown topic")
+)
+
+type webhookService struct {
+	repo   repository
+	logger app.Logger
+}
+
+func NewWebhookService(repo repository, logger app.Logger) *webhookService {
+	return &webhookService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func subscriptionToDto(s entity.WebhookSubscription) SubscriptionDto {
+	topics := s.Topics
+	if topics == nil {
+		topics = []string{}
+	}
+
+	return SubscriptionDto{
+		ID:      s.ID,
+		URL:     s.URL,
+		Topics:  topics,
+		Created: s.Created.Format(time.RFC3339),
+	}
+}
+
+func deliveryToDto(d entity.WebhookDelivery) DeliveryDto {
+	return DeliveryDto{
+		ID:          d.ID,
+		EventID:     d.EventID,
+		Status:      string(d.Status),
+		Attempts:    d.Attempts,
+		NextAttempt: d.NextAttempt.Format(time.RFC3339),
+		LastError:   d.LastError,
+		Updated:     d.Updated.Format(time.RFC3339),
+	}
+}
+
+func validateSubscription(target string, topics []string) error {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+
+	for _, topic := range topics {
+		known := false
+
+		for _, t := range events.Topics {
+			known = known || t == topic
+		}
+
+		if !known {
+			return fmt.Errorf("%w %q", ErrUnknownTopic, topic)
+		}
+	}
+
+	return nil
+}
+
+// AddSubscription stores subscription to topics, all topics when empty. Returned secret signs
+// requests to url and can't be read again.
+func (s *webhookService) AddSubscription(ctx context.Context, target string, topics []string) (SubscriptionDto, error) {
+	ctx, span := tracing.Start(ctx, "webhookService.AddSubscription")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "function", "webhookService.AddSubscription")
+
+	if err := validateSubscription(target, topics); err != nil {
+		return SubscriptionDto{}, err
+	}
+
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		tracing.Fail(span, err)
+		return SubscriptionDto{}, fmt.Errorf("could not generate secret: %w", err)
+	}
+
+	subscription := entity.WebhookSubscription{
+		URL:     target,
+		Secret:  hex.EncodeToString(secret),
+		Topics:  topics,
+		Created: time.Now().UTC(),
+	}
+
+	id, err := s.repo.AddWebhookSubscription(ctx, subscription)
+	if err != nil {
+		tracing.Fail(span, err)
+		s.logger.Error(app.ContextWithError(ctx, err), "could not add webhook subscription")
+		return SubscriptionDto{}, fmt.Errorf("could not add webhook subscription: %w", err)
+	}
+
+	subscription.ID = id
+	dto := subscriptionToDto(subscription)
+	dto.Secret = subscription.Secret
+
+	return dto, nil
+}
+
+func (s *webhookService) ListSubscriptions(ctx context.Context) ([]SubscriptionDto, error) {
+	ctx, span := tracing.Start(ctx, "webhookService.ListSubscriptions")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "function", "webhookService.ListSubscriptions")
+
+	list, err := s.repo.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		tracing.Fail(span, err)
+		s.logger.Error(app.ContextWithError(ctx, err), "could not list webhook subscriptions")
+		return nil, fmt.Errorf("could not list webhook subscriptions: %w", err)
+	}
+
+	result := make([]SubscriptionDto, len(list))
+	for i, v := range list {
+		result[i] = subscriptionToDto(v)
+	}
+
+	return result, nil
+}
+
+// DeleteSubscription removes subscription, its pending deliveries are not sent
+func (s *webhookService) DeleteSubscription(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "webhookService.DeleteSubscription")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "function", "webhookService.DeleteSubscription")
+
+	if err := s.repo.DeleteWebhookSubscription(ctx, id); err != nil {
+		tracing.Fail(span, err)
+		s.logger.Error(app.ContextWithError(ctx, err), "could not delete webhook subscription")
+		return fmt.Errorf("could not delete webhook subscription: %w", err)
+	}
+
+	return nil
+}
+
+// ListDeliveries returns deliveries of subscription, all statuses when status is empty
+func (s *webhookService) ListDeliveries(ctx context.Context, subscriptionID int, status entity.DeliveryStatus) ([]DeliveryDto, error) {
+	ctx, span := tracing.Start(ctx, "webhookService.ListDeliveries")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "function", "webhookService.ListDeliveries")
+
+	subscriptions, err := s.repo.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		tracing.Fail(span, err)
+		s.logger.Error(app.ContextWithError(ctx, err), "could not list webhook subscriptions")
+		return nil, fmt.Errorf("could not list webhook deliveries: %w", err)
+	}
+
+	found := false
+	for _, v := range subscriptions {
+		found = found || v.ID == subscriptionID
+	}
+
+	if !found {
+		return nil, entity.ErrSubscriptionNotFound
+	}
+
+	list, err := s.repo.GetWebhookDeliveries(ctx, subscriptionID, status)
+	if err != nil {
+		tracing.Fail(span, err)
+		s.logger.Error(app.ContextWithError(ctx, err), "could not list webhook deliveries")
+		return nil, fmt.Errorf("could not list webhook deliveries: %w", err)
+	}
+
+	result := make([]DeliveryDto, len(list))
+	for i, v := range list {
+		result[i] = deliveryToDto(v)
+	}
+
+	return result, nil
+}
+
+// ReplayDelivery sends dead delivery again with fresh attempts
+func (s *webhookService) ReplayDelivery(ctx context.Context, subscriptionID, deliveryID int) error {
+	ctx, span := tracing.Start(ctx, "webhookService.ReplayDelivery")
+	defer span.End()
+
+	ctx = app.ContextWithValue(ctx, "function", "webhookService.ReplayDelivery")
+
+	if err := s.repo.ReplayDelivery(ctx, subscriptionID, deliveryID, time.Now().UTC()); err != nil {
+		tracing.Fail(span, err)
+		s.logger.Error(app.ContextWithError(ctx, err), "could not replay webhook delivery")
+		return fmt.Errorf("could not replay webhook delivery: %w", err)
+	}
+
+	return nil
+}
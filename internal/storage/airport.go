@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+)
+
+// AddAirport fails with entity.ErrCityNotFound when city is missing
+func (r *sqlRepository) AddAirport(ctx context.Context, airport entity.Airport) (int, error) {
+	var id int
+
+	err := r.Transaction(ctx, TxOptions{}, func(ctx context.Context) error {
+		if _, err := r.GetCity(ctx, airport.CityID); err != nil {
+			return err
+		}
+
+		var err error
+
+		id, err = r.insert(ctx, `INSERT INTO airports (airport_id, name, city_id) VALUES (?, ?, ?)`,
+			airport.AirportID, airport.Name, airport.CityID)
+		if err != nil && r.uniqueViolation(err) {
+			return entity.ErrAirportExists
+		}
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *sqlRepository) GetAirport(ctx context.Context, id int) (entity.Airport, error) {
+	stmt, err := r.prepare(ctx, `SELECT airport_id, name, city_id FROM airports WHERE id=?`)
+	if err != nil {
+		return entity.Airport{}, err
+	}
+
+	airport := entity.Airport{ID: id}
+
+	if err = stmt.QueryRowContext(ctx, id).Scan(&airport.AirportID, &airport.Name, &airport.CityID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Airport{}, entity.ErrAirportNotFound
+		}
+
+		return entity.Airport{}, ErrScanning{cause: err}
+	}
+
+	return airport, nil
+}
+
+func (r *sqlRepository) GetCityAirports(ctx context.Context, cityID int) ([]entity.Airport, error) {
+	stmt, err := r.prepare(ctx, `SELECT id, airport_id, name, city_id FROM airports WHERE city_id=? ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, cityID)
+	if err != nil {
+		return nil, ErrQuerying{cause: err}
+	}
+
+	defer rows.Close()
+
+	var result []entity.Airport
+
+	for rows.Next() {
+		var airport entity.Airport
+
+		if err = rows.Scan(&airport.ID, &airport.AirportID, &airport.Name, &airport.CityID); err != nil {
+			return nil, ErrScanning{cause: err}
+		}
+
+		result = append(result, airport)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, ErrIteration{cause: err}
+	}
+
+	return result, nil
+}
+
+// AddRoute fails with entity.ErrAirportNotFound when either airport is missing
+func (r *sqlRepository) AddRoute(ctx context.Context, route entity.Route) (int, error) {
+	var id int
+
+	err := r.Transaction(ctx, TxOptions{}, func(ctx context.Context) error {
+		for _, airportID := range []int{route.SourceID, route.DestinationID} {
+			if _, err := r.GetAirport(ctx, airportID); err != nil {
+				return err
+			}
+		}
+
+		var err error
+
+		id, err = r.insert(ctx, `INSERT INTO routes (source_id, destination_id, price) VALUES (?, ?, ?)`,
+			route.SourceID, route.DestinationID, route.Price)
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdateRoutePrice fails with entity.ErrRouteNotFound when route is missing
+func (r *sqlRepository) UpdateRoutePrice(ctx context.Context, id int, price float64) error {
+	// MySQL doesn't count rows which keep their value as affected, so route is looked up first
+	return r.Transaction(ctx, TxOptions{}, func(ctx context.Context) error {
+		if _, err := r.GetRoute(ctx, id); err != nil {
+			return err
+		}
+
+		return r.exec(ctx, `UPDATE routes SET price=? WHERE id=?`, price, id)
+	})
+}
+
+func (r *sqlRepository) GetRoute(ctx context.Context, id int) (entity.Route, error) {
+	stmt, err := r.prepare(ctx, `SELECT source_id, destination_id, price FROM routes WHERE id=?`)
+	if err != nil {
+		return entity.Route{}, err
+	}
+
+	route := entity.Route{ID: id}
+
+	if err = stmt.QueryRowContext(ctx, id).Scan(&route.SourceID, &route.DestinationID, &route.Price); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Route{}, entity.ErrRouteNotFound
+		}
+
+		return entity.Route{}, ErrScanning{cause: err}
+	}
+
+	return route, nil
+}
+
+func (r *sqlRepository) GetRoutesFrom(ctx context.Context, sourceID int) ([]entity.Route, error) {
+	stmt, err := r.prepare(ctx, `SELECT id, source_id, destination_id, price FROM routes WHERE source_id=? ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, sourceID)
+	if err != nil {
+		return nil, ErrQuerying{cause: err}
+	}
+
+	defer rows.Close()
+
+	var result []entity.Route
+
+	for rows.Next() {
+		var route entity.Route
+
+		if err = rows.Scan(&route.ID, &route.SourceID, &route.DestinationID, &route.Price); err != nil {
+			return nil, ErrScanning{cause: err}
+		}
+
+		result = append(result, route)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, ErrIteration{cause: err}
+	}
+
+	return result, nil
+}
@@ -9,18 +9,17 @@ import (
 	"github.com/strax84mb/go-travel-reactive/internal/entity"
 )
 
-func (r *repository) GetCityByNameAndCountry(ctx context.Context, cityItem interface{}) (interface{}, error) {
-	city := cityItem.(entity.City)
-	query := `SELECT id, name, country FROM cities WHERE LOWER(name) = LOWER(?) AND LOWER(country) = LOWER(?)`
+func (r *sqlRepository) GetCityByNameAndCountry(ctx context.Context, city entity.City) (entity.City, error) {
+	query := `SELECT id, name, country, version FROM cities WHERE LOWER(name) = LOWER(?) AND LOWER(country) = LOWER(?)`
 
-	stmt, err := r.db.PrepareContext(ctx, query)
+	stmt, err := r.prepare(ctx, query)
 	if err != nil {
-		return entity.City{}, makeErrPreparingStatement(query, err)
+		return entity.City{}, err
 	}
 
 	result := entity.City{}
 
-	err = stmt.QueryRowContext(ctx, city.Name, city.Country).Scan(&result.ID, &result.Name, &result.Country)
+	err = stmt.QueryRowContext(ctx, city.Name, city.Country).Scan(&result.ID, &result.Name, &result.Country, &result.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return entity.City{}, entity.ErrCityNotFound
@@ -32,89 +31,100 @@ func (r *repository) GetCityByNameAndCountry(ctx context.Context, cityItem inter
 	return result, nil
 }
 
-func (r *repository) AddCity(ctx context.Context, cityItem interface{}) (interface{}, error) {
-	city := cityItem.(entity.City)
+func (r *sqlRepository) AddCity(ctx context.Context, city entity.City) (int, error) {
+	var id int
 
-	tx, err := r.db.Begin()
-	if err != nil {
-		return 0, ErrBeginTx{cause: err}
-	}
+	err := r.Transaction(ctx, TxOptions{}, func(ctx context.Context) error {
+		query := `SELECT count(id) FROM cities WHERE LOWER(name) = LOWER(?) AND LOWER(country) = LOWER(?)`
 
-	query := `SELECT count(id) FROM cities WHERE LOWER(name) = LOWER(?) AND LOWER(country) = LOWER(?)`
+		checkStmt, err := r.prepare(ctx, query)
+		if err != nil {
+			return err
+		}
 
-	checkStmt, err := tx.PrepareContext(ctx, query)
-	if err != nil {
-		return 0, makeErrPreparingStatement(query, err)
-	}
+		var count int
 
-	defer checkStmt.Close()
+		if err = checkStmt.QueryRowContext(ctx, city.Name, city.Country).Scan(&count); err != nil {
+			return ErrQuerying{cause: err}
+		} else if count > 0 {
+			return entity.ErrCityExists
+		}
 
-	var count int
+		id, err = r.insert(ctx, `INSERT INTO cities (name, country) VALUES (?, ?)`, city.Name, city.Country)
+		if err != nil {
+			if r.uniqueViolation(err) {
+				return entity.ErrCityExists
+			}
 
-	if err = checkStmt.QueryRowContext(ctx, city.Name, city.Country).Scan(&count); err != nil {
-		return 0, ErrQuerying{cause: err}
-	}
+			return err
+		}
 
-	stmt, err := tx.PrepareContext(ctx, `INSERT INTO cities (name, country) VALUES (?, ?)`)
+		return nil
+	})
 	if err != nil {
-		return 0, makeErrPreparingStatement(`INSERT INTO users (name, country) VALUES (?, ?)`, err)
+		return 0, err
 	}
 
-	defer stmt.Close()
+	return id, nil
+}
+
+// UpdateCity changes city only if it still has city.Version, zero version updates any version
+func (r *sqlRepository) UpdateCity(ctx context.Context, city entity.City) error {
+	// version always changes so MySQL counts row as affected even when values are the same
+	statement := `UPDATE cities SET name=?, country=?, version=version+1 WHERE id=? AND (? = 0 OR version=?)`
 
-	result, err := stmt.ExecContext(ctx, city.Name, city.Country)
+	stmt, err := r.prepare(ctx, statement)
 	if err != nil {
-		return 0, ErrQuerying{cause: err}
+		return err
 	}
 
-	id, err := result.LastInsertId()
+	result, err := stmt.ExecContext(ctx, city.Name, city.Country, city.ID, city.Version, city.Version)
 	if err != nil {
-		return 0, fmt.Errorf("could not get last inserted ID: %w", err)
+		if r.uniqueViolation(err) {
+			return entity.ErrCityExists
+		}
+
+		return ErrQuerying{cause: err}
 	}
 
-	if err = tx.Commit(); err != nil {
-		return 0, ErrCommitTx{cause: err}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get number of affected rows: %w", err)
+	} else if affected == 0 {
+		return r.missingOrChanged(ctx, city.ID)
 	}
 
-	return int(id), nil
+	return nil
 }
 
-func (r *repository) UpdateCity(ctx context.Context, cityItem interface{}) (interface{}, error) {
-	city := cityItem.(entity.City)
-	statement := `UPDATE cities SET name=?, country=? WHERE id=?`
-
-	stmt, err := r.db.PrepareContext(ctx, statement)
+// missingOrChanged tells why conditional change of city affected no rows
+func (r *sqlRepository) missingOrChanged(ctx context.Context, id int) error {
+	stmt, err := r.prepare(ctx, `SELECT count(id) FROM cities WHERE id=?`)
 	if err != nil {
-		return false, makeErrPreparingStatement(statement, err)
+		return err
 	}
 
-	result, err := stmt.ExecContext(ctx, city.Name, city.Country, city.ID)
-	if err != nil {
-		return false, ErrQuerying{cause: err}
-	}
+	var count int
 
-	affected, err := result.RowsAffected()
-	if err != nil {
-		return false, fmt.Errorf("could not get number of affected rows: %w", err)
-	} else if affected == 0 {
-		return false, entity.ErrCityNotFound
+	if err = stmt.QueryRowContext(ctx, id).Scan(&count); err != nil {
+		return ErrQuerying{cause: err}
+	} else if count == 0 {
+		return entity.ErrCityNotFound
 	}
 
-	return true, nil
+	return entity.ErrCityChanged
 }
 
-func (r *repository) GetCity(ctx context.Context, id interface{}) (interface{}, error) {
-	query := `SELECT name, country FROM cities WHERE id=?`
+func (r *sqlRepository) GetCity(ctx context.Context, id int) (entity.City, error) {
+	query := `SELECT name, country, version FROM cities WHERE id=?`
 
-	stmt, err := r.db.PrepareContext(ctx, query)
+	stmt, err := r.prepare(ctx, query)
 	if err != nil {
-		return entity.City{}, makeErrPreparingStatement(query, err)
+		return entity.City{}, err
 	}
 
-	defer stmt.Close()
-
-	city := entity.City{ID: id.(int)}
-	if err = stmt.QueryRowContext(ctx, id).Scan(&city.Name, &city.Country); err != nil {
+	city := entity.City{ID: id}
+	if err = stmt.QueryRowContext(ctx, id).Scan(&city.Name, &city.Country, &city.Version); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return entity.City{}, entity.ErrCityNotFound
 		}
@@ -125,125 +135,110 @@ func (r *repository) GetCity(ctx context.Context, id interface{}) (interface{},
 	return city, nil
 }
 
-func (r *repository) GetAllCities(ctx context.Context, _ interface{}) (interface{}, error) {
-	query := `SELECT id, name, country FROM cities`
-
-	stmt, err := r.db.PrepareContext(ctx, query)
-	if err != nil {
-		return nil, makeErrPreparingStatement(query, err)
-	}
-
-	defer stmt.Close()
-
-	rows, err := stmt.QueryContext(ctx)
-	if err != nil {
-		return nil, ErrQuerying{cause: err}
-	}
-
-	var (
-		result []entity.City
-		city   entity.City
-	)
-
-	for rows.Next() {
-		if err = rows.Scan(&city.ID, &city.Name, &city.Country); err != nil {
-			return nil, ErrScanning{cause: err}
-		}
+func (r *sqlRepository) GetAllCities(ctx context.Context) ([]entity.City, error) {
+	var result []entity.City
 
+	err := r.ForEachCity(ctx, func(city entity.City) error {
 		result = append(result, city)
-
-		if rows.Err() != nil {
-			return nil, ErrIteration{cause: err}
-		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return result, nil
 }
 
-func (r *repository) DeleteCity(ctx context.Context, idItem interface{}) (interface{}, error) {
-	id := idItem.(int)
+// ForEachCity calls fn for each row as it is read, so connection is held until fn is done with the last city.
+// Iteration stops at first error of fn or when ctx is canceled.
+func (r *sqlRepository) ForEachCity(ctx context.Context, fn func(city entity.City) error) error {
+	query := `SELECT id, name, country, version FROM cities ORDER BY id`
 
-	tx, err := r.db.Begin()
+	stmt, err := r.prepare(ctx, query)
 	if err != nil {
-		return 0, ErrBeginTx{cause: err}
+		return err
 	}
 
-	// delete routes
-	query := `DELETE FROM routes WHERE 
-		source_id IN (SELECT id FROM airports WHERE city_id=?) OR 
-		destination_id IN (SELECT id FROM airports WHERE city_id=?)`
-
-	stmt, err := tx.PrepareContext(ctx, query)
+	rows, err := stmt.QueryContext(ctx)
 	if err != nil {
-		return 0, makeErrPreparingStatement(query, err)
+		return ErrQuerying{cause: err}
 	}
 
-	if _, err = stmt.ExecContext(ctx, id, id); err != nil {
-		_ = stmt.Close()
-		return 0, ErrQuerying{cause: err}
-	}
+	defer rows.Close()
 
-	// delete airports
-	_ = stmt.Close()
-	query = `DELETE FROM airports WHERE city_id=?`
+	var city entity.City
 
-	stmt, err = tx.PrepareContext(ctx, query)
-	if err != nil {
-		_ = tx.Rollback()
-		return 0, makeErrPreparingStatement(query, err)
+	for rows.Next() {
+		if err = rows.Scan(&city.ID, &city.Name, &city.Country, &city.Version); err != nil {
+			return ErrScanning{cause: err}
+		}
+
+		if err = fn(city); err != nil {
+			return err
+		}
 	}
 
-	if _, err = stmt.ExecContext(ctx, id); err != nil {
-		_, _ = stmt.Close(), tx.Rollback()
-		return 0, ErrQuerying{cause: err}
+	if err = rows.Err(); err != nil {
+		return ErrIteration{cause: err}
 	}
 
-	// delete comments
-	_ = stmt.Close()
-	query = `DELETE FROM comments WHERE city_id=?`
+	return nil
+}
 
-	stmt, err = tx.PrepareContext(ctx, query)
-	if err != nil {
-		_ = tx.Rollback()
-		return 0, makeErrPreparingStatement(query, err)
-	}
+// DeleteCity removes city with its airports, routes and comments if city still has city.Version,
+// zero version deletes any version
+func (r *sqlRepository) DeleteCity(ctx context.Context, city entity.City) error {
+	id := city.ID
+
+	return r.Transaction(ctx, TxOptions{}, func(ctx context.Context) error {
+		// version is checked first so that nothing is deleted when city was changed
+		if city.Version != 0 {
+			current, err := r.GetCity(ctx, id)
+			if err != nil {
+				return err
+			} else if current.Version != city.Version {
+				return entity.ErrCityChanged
+			}
+		}
 
-	if _, err = stmt.ExecContext(ctx, id); err != nil {
-		_, _ = stmt.Close(), tx.Rollback()
-		return 0, ErrQuerying{cause: err}
-	}
+		// delete routes
+		err := r.exec(ctx, `DELETE FROM routes WHERE 
+			source_id IN (SELECT id FROM airports WHERE city_id=?) OR 
+			destination_id IN (SELECT id FROM airports WHERE city_id=?)`, id, id)
+		if err != nil {
+			return err
+		}
 
-	// delete city
-	_ = stmt.Close()
-	query = `DELETE FROM cities WHERE id=?`
+		// delete airports
+		if err = r.exec(ctx, `DELETE FROM airports WHERE city_id=?`, id); err != nil {
+			return err
+		}
 
-	stmt, err = tx.PrepareContext(ctx, query)
-	if err != nil {
-		_ = tx.Rollback()
-		return 0, makeErrPreparingStatement(query, err)
-	}
+		// delete comments
+		if err = r.exec(ctx, `DELETE FROM comments WHERE city_id=?`, id); err != nil {
+			return err
+		}
 
-	result, err := stmt.ExecContext(ctx, id)
-	if err != nil {
-		_, _ = stmt.Close(), tx.Rollback()
-		return 0, ErrQuerying{cause: err}
-	}
+		// delete city
+		query := `DELETE FROM cities WHERE id=? AND (? = 0 OR version=?)`
 
-	_ = stmt.Close()
+		stmt, err := r.prepare(ctx, query)
+		if err != nil {
+			return err
+		}
 
-	count, err := result.RowsAffected()
-	if err != nil {
-		_ = tx.Rollback()
-		return 0, fmt.Errorf("could not get number of affected rows: %w", err)
-	} else if count == 0 {
-		_ = tx.Rollback()
-		return 0, entity.ErrCityNotFound
-	}
+		result, err := stmt.ExecContext(ctx, id, city.Version, city.Version)
+		if err != nil {
+			return ErrQuerying{cause: err}
+		}
 
-	if err = tx.Commit(); err != nil {
-		_, _ = stmt.Close(), tx.Rollback()
-		return 0, ErrCommitTx{cause: err}
-	}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("could not get number of affected rows: %w", err)
+		} else if count == 0 {
+			return r.missingOrChanged(ctx, id)
+		}
 
-	return count, nil
+		return nil
+	})
 }
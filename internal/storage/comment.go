@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+)
+
+// AddComment fails with entity.ErrCityNotFound when city is missing
+func (r *sqlRepository) AddComment(ctx context.Context, comment entity.Comment) (int, error) {
+	var id int
+
+	err := r.Transaction(ctx, TxOptions{}, func(ctx context.Context) error {
+		if _, err := r.GetCity(ctx, comment.CityID); err != nil {
+			return err
+		}
+
+		var err error
+
+		id, err = r.insert(ctx, `INSERT INTO comments (city_id, poster_id, text, created, modified) VALUES (?, ?, ?, ?, ?)`,
+			comment.CityID, comment.PosterID, comment.Text, comment.Created.UTC(), comment.Modified.UTC())
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *sqlRepository) GetComment(ctx context.Context, id int) (entity.Comment, error) {
+	query := `SELECT city_id, poster_id, text, created, modified FROM comments WHERE id=?`
+
+	stmt, err := r.prepare(ctx, query)
+	if err != nil {
+		return entity.Comment{}, err
+	}
+
+	comment := entity.Comment{ID: id}
+
+	err = stmt.QueryRowContext(ctx, id).Scan(&comment.CityID, &comment.PosterID, &comment.Text, &comment.Created, &comment.Modified)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Comment{}, entity.ErrCommentNotFound
+		}
+
+		return entity.Comment{}, ErrScanning{cause: err}
+	}
+
+	comment.Created = comment.Created.UTC()
+	comment.Modified = comment.Modified.UTC()
+
+	return comment, nil
+}
+
+func (r *sqlRepository) UpdateComment(ctx context.Context, comment entity.Comment) error {
+	found, err := r.execAffected(ctx, `UPDATE comments SET text=?, modified=? WHERE id=?`,
+		comment.Text, comment.Modified.UTC(), comment.ID)
+	if err != nil {
+		return err
+	} else if !found {
+		return entity.ErrCommentNotFound
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) DeleteComment(ctx context.Context, id int) error {
+	deleted, err := r.execAffected(ctx, `DELETE FROM comments WHERE id=?`, id)
+	if err != nil {
+		return err
+	} else if !deleted {
+		return entity.ErrCommentNotFound
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) GetCityComments(ctx context.Context, input entity.GetCityCommentsInput) (entity.GetCityCommentsOutput, error) {
+	output := entity.GetCityCommentsOutput{
+		City:     input.City,
+		Comments: []entity.CommentWithPosterName{},
+	}
+
+	if input.NumberOfComments <= 0 {
+		return output, nil
+	}
+
+	query := `SELECT c.id, c.poster_id, c.text, c.created, c.modified, u.username
+		FROM comments c
+		JOIN users u ON u.id = c.poster_id
+		WHERE c.city_id = ?
+		ORDER BY c.created DESC, c.id DESC
+		LIMIT ?`
+
+	stmt, err := r.prepare(ctx, query)
+	if err != nil {
+		return output, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, input.City.ID, input.NumberOfComments)
+	if err != nil {
+		return output, ErrQuerying{cause: err}
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		item := entity.CommentWithPosterName{
+			Comment: entity.Comment{CityID: input.City.ID},
+		}
+
+		err = rows.Scan(&item.Comment.ID, &item.Comment.PosterID, &item.Comment.Text,
+			&item.Comment.Created, &item.Comment.Modified, &item.PosterName)
+		if err != nil {
+			return output, ErrScanning{cause: err}
+		}
+
+		item.Comment.Created = item.Comment.Created.UTC()
+		item.Comment.Modified = item.Comment.Modified.UTC()
+		output.Comments = append(output.Comments, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return output, ErrIteration{cause: err}
+	}
+
+	return output, nil
+}
@@ -0,0 +1,756 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+)
+
+// memoryRepository keeps everything in maps, data is lost on restart
+type memoryRepository struct {
+	mu            sync.RWMutex
+	users         map[int]entity.User
+	cities        map[int]entity.City
+	comments      map[int]entity.Comment
+	airports      map[int]entity.Airport
+	routes        map[int]entity.Route
+	outbox        map[int]memoryOutboxEvent
+	subscriptions map[int]entity.WebhookSubscription
+	deliveries    map[int]entity.WebhookDelivery
+	lastUserID    int
+	lastCityID    int
+	lastIDs       memoryIDs
+}
+
+type memorySnapshot struct {
+	users         map[int]entity.User
+	cities        map[int]entity.City
+	comments      map[int]entity.Comment
+	airports      map[int]entity.Airport
+	routes        map[int]entity.Route
+	outbox        map[int]memoryOutboxEvent
+	subscriptions map[int]entity.WebhookSubscription
+	deliveries    map[int]entity.WebhookDelivery
+	lastUserID    int
+	lastCityID    int
+	lastIDs       memoryIDs
+}
+
+func newMemoryRepository() *memoryRepository {
+	r := &memoryRepository{
+		users:         map[int]entity.User{},
+		cities:        map[int]entity.City{},
+		comments:      map[int]entity.Comment{},
+		airports:      map[int]entity.Airport{},
+		routes:        map[int]entity.Route{},
+		outbox:        map[int]memoryOutboxEvent{},
+		subscriptions: map[int]entity.WebhookSubscription{},
+		deliveries:    map[int]entity.WebhookDelivery{},
+	}
+
+	// same data as init.sql
+	salt, _ := hex.DecodeString("92766f4ade6d45666bd4c26798a39c97")
+	r.lastUserID++
+	r.users[r.lastUserID] = entity.User{
+		ID:       r.lastUserID,
+		Username: "admin",
+		Password: "92766f4ade6d45666bd4c26798a39c974874c118bd4d95815b62a548988fd7db33060246e2555bf93328d5dfabd3ffbd799efafbe4b9e775ca46d005fe0932072857d6e63173fa2c41ccd10d194bfef8",
+		Salt:     salt,
+		Role:     entity.AdminUserRole,
+	}
+
+	for _, c := range [][2]string{
+		{"Beograd", "Srbija"},
+		{"New York", "USA"},
+		{"Paris", "France"},
+		{"Berlin", "Deutchland"},
+		{"Zagreb", "Hrvatska"},
+	} {
+		r.lastCityID++
+		r.cities[r.lastCityID] = entity.City{ID: r.lastCityID, Name: c[0], Country: c[1], Version: 1}
+	}
+
+	return r
+}
+
+// snapshot is taken by transaction while it holds mu
+func (r *memoryRepository) snapshot() memorySnapshot {
+	return memorySnapshot{
+		users:         copyMap(r.users),
+		cities:        copyMap(r.cities),
+		comments:      copyMap(r.comments),
+		airports:      copyMap(r.airports),
+		routes:        copyMap(r.routes),
+		outbox:        copyMap(r.outbox),
+		subscriptions: copyMap(r.subscriptions),
+		deliveries:    copyMap(r.deliveries),
+		lastUserID:    r.lastUserID,
+		lastCityID:    r.lastCityID,
+		lastIDs:       r.lastIDs,
+	}
+}
+
+// restore rolls transaction back while it holds mu
+func (r *memoryRepository) restore(s memorySnapshot) {
+	r.users = s.users
+	r.cities = s.cities
+	r.comments = s.comments
+	r.airports = s.airports
+	r.routes = s.routes
+	r.outbox = s.outbox
+	r.subscriptions = s.subscriptions
+	r.deliveries = s.deliveries
+	r.lastUserID = s.lastUserID
+	r.lastCityID = s.lastCityID
+	r.lastIDs = s.lastIDs
+}
+
+// lock takes write lock for one call, calls made within transaction already hold it
+func (r *memoryRepository) lock(ctx context.Context) func() {
+	if r.inTransaction(ctx) {
+		return func() {}
+	}
+
+	r.mu.Lock()
+
+	return r.mu.Unlock
+}
+
+// rlock takes read lock for one call, calls made within transaction already hold write lock
+func (r *memoryRepository) rlock(ctx context.Context) func() {
+	if r.inTransaction(ctx) {
+		return func() {}
+	}
+
+	r.mu.RLock()
+
+	return r.mu.RUnlock
+}
+
+// copyMap is shallow, stored values are never changed in place
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	result := make(map[K]V, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+
+	return result
+}
+
+func (r *memoryRepository) Stats() sql.DBStats {
+	return sql.DBStats{}
+}
+
+func (r *memoryRepository) Ping(_ context.Context) error {
+	return nil
+}
+
+func (r *memoryRepository) CheckSchema(_ context.Context) error {
+	return nil
+}
+
+func (r *memoryRepository) SchemaVersion(_ context.Context) (int, error) {
+	return CurrentSchemaVersion, nil
+}
+
+func (r *memoryRepository) CheckRouteGraph(ctx context.Context) error {
+	defer r.rlock(ctx)()
+
+	dangling := 0
+
+	for _, route := range r.routes {
+		_, source := r.airports[route.SourceID]
+		_, destination := r.airports[route.DestinationID]
+
+		if !source || !destination {
+			dangling++
+		}
+	}
+
+	if dangling > 0 {
+		return fmt.Errorf("%d routes reference missing airports", dangling)
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) Close() error {
+	return nil
+}
+
+func (r *memoryRepository) GetUserByUsername(ctx context.Context, username string) (entity.User, error) {
+	defer r.rlock(ctx)()
+
+	for _, u := range r.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+
+	return entity.User{}, entity.ErrUsernameNotFound
+}
+
+// SaveUser returns last inserted ID
+func (r *memoryRepository) SaveUser(ctx context.Context, user entity.User) (int, error) {
+	defer r.lock(ctx)()
+
+	for _, u := range r.users {
+		if u.Username == user.Username {
+			return 0, entity.ErrUsernameTaken
+		}
+	}
+
+	r.lastUserID++
+	user.ID = r.lastUserID
+	user.Salt = append([]byte(nil), user.Salt...)
+	r.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+func (r *memoryRepository) findCity(name, country string) (entity.City, bool) {
+	for _, c := range r.cities {
+		if strings.EqualFold(c.Name, name) && strings.EqualFold(c.Country, country) {
+			return c, true
+		}
+	}
+
+	return entity.City{}, false
+}
+
+func (r *memoryRepository) GetCityByNameAndCountry(ctx context.Context, city entity.City) (entity.City, error) {
+	defer r.rlock(ctx)()
+
+	result, ok := r.findCity(city.Name, city.Country)
+	if !ok {
+		return entity.City{}, entity.ErrCityNotFound
+	}
+
+	return result, nil
+}
+
+func (r *memoryRepository) AddCity(ctx context.Context, city entity.City) (int, error) {
+	defer r.lock(ctx)()
+
+	if _, ok := r.findCity(city.Name, city.Country); ok {
+		return 0, entity.ErrCityExists
+	}
+
+	r.lastCityID++
+	city.ID = r.lastCityID
+	city.Version = 1
+	r.cities[city.ID] = city
+
+	return city.ID, nil
+}
+
+func (r *memoryRepository) UpdateCity(ctx context.Context, city entity.City) error {
+	defer r.lock(ctx)()
+
+	current, ok := r.cities[city.ID]
+	if !ok {
+		return entity.ErrCityNotFound
+	} else if city.Version != 0 && city.Version != current.Version {
+		return entity.ErrCityChanged
+	}
+
+	city.Version = current.Version + 1
+	r.cities[city.ID] = city
+
+	return nil
+}
+
+func (r *memoryRepository) GetCity(ctx context.Context, id int) (entity.City, error) {
+	defer r.rlock(ctx)()
+
+	city, ok := r.cities[id]
+	if !ok {
+		return entity.City{}, entity.ErrCityNotFound
+	}
+
+	return city, nil
+}
+
+func (r *memoryRepository) GetAllCities(ctx context.Context) ([]entity.City, error) {
+	defer r.rlock(ctx)()
+
+	var result []entity.City
+
+	for _, c := range r.cities {
+		result = append(result, c)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+// ForEachCity iterates over snapshot of cities, so fn may use repository
+func (r *memoryRepository) ForEachCity(ctx context.Context, fn func(city entity.City) error) error {
+	cities, _ := r.GetAllCities(ctx)
+
+	for _, city := range cities {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(city); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) DeleteCity(ctx context.Context, city entity.City) error {
+	defer r.lock(ctx)()
+
+	current, ok := r.cities[city.ID]
+	if !ok {
+		return entity.ErrCityNotFound
+	} else if city.Version != 0 && city.Version != current.Version {
+		return entity.ErrCityChanged
+	}
+
+	for id, route := range r.routes {
+		source, destination := r.airports[route.SourceID], r.airports[route.DestinationID]
+		if source.CityID == city.ID || destination.CityID == city.ID {
+			delete(r.routes, id)
+		}
+	}
+
+	for id, airport := range r.airports {
+		if airport.CityID == city.ID {
+			delete(r.airports, id)
+		}
+	}
+
+	for id, comment := range r.comments {
+		if comment.CityID == city.ID {
+			delete(r.comments, id)
+		}
+	}
+
+	delete(r.cities, city.ID)
+
+	return nil
+}
+
+// AddComment fails with entity.ErrCityNotFound when city is missing
+func (r *memoryRepository) AddComment(ctx context.Context, comment entity.Comment) (int, error) {
+	defer r.lock(ctx)()
+
+	if _, ok := r.cities[comment.CityID]; !ok {
+		return 0, entity.ErrCityNotFound
+	}
+
+	r.lastIDs.comment++
+	comment.ID = r.lastIDs.comment
+	r.comments[comment.ID] = comment
+
+	return comment.ID, nil
+}
+
+func (r *memoryRepository) GetComment(ctx context.Context, id int) (entity.Comment, error) {
+	defer r.rlock(ctx)()
+
+	comment, ok := r.comments[id]
+	if !ok {
+		return entity.Comment{}, entity.ErrCommentNotFound
+	}
+
+	return comment, nil
+}
+
+func (r *memoryRepository) UpdateComment(ctx context.Context, comment entity.Comment) error {
+	defer r.lock(ctx)()
+
+	current, ok := r.comments[comment.ID]
+	if !ok {
+		return entity.ErrCommentNotFound
+	}
+
+	current.Text = comment.Text
+	current.Modified = comment.Modified
+	r.comments[comment.ID] = current
+
+	return nil
+}
+
+func (r *memoryRepository) DeleteComment(ctx context.Context, id int) error {
+	defer r.lock(ctx)()
+
+	if _, ok := r.comments[id]; !ok {
+		return entity.ErrCommentNotFound
+	}
+
+	delete(r.comments, id)
+
+	return nil
+}
+
+func (r *memoryRepository) GetCityComments(ctx context.Context, input entity.GetCityCommentsInput) (entity.GetCityCommentsOutput, error) {
+	defer r.rlock(ctx)()
+
+	output := entity.GetCityCommentsOutput{
+		City:     input.City,
+		Comments: []entity.CommentWithPosterName{},
+	}
+
+	for _, c := range r.comments {
+		if c.CityID == input.City.ID {
+			output.Comments = append(output.Comments, entity.CommentWithPosterName{
+				Comment:    c,
+				PosterName: r.users[c.PosterID].Username,
+			})
+		}
+	}
+
+	sort.Slice(output.Comments, func(i, j int) bool {
+		a, b := output.Comments[i].Comment, output.Comments[j].Comment
+		if a.Created.Equal(b.Created) {
+			return a.ID > b.ID
+		}
+
+		return a.Created.After(b.Created)
+	})
+
+	if input.NumberOfComments < len(output.Comments) {
+		output.Comments = output.Comments[:max(input.NumberOfComments, 0)]
+	}
+
+	return output, nil
+}
+
+// AddAirport fails with entity.ErrCityNotFound when city is missing
+func (r *memoryRepository) AddAirport(ctx context.Context, airport entity.Airport) (int, error) {
+	defer r.lock(ctx)()
+
+	if _, ok := r.cities[airport.CityID]; !ok {
+		return 0, entity.ErrCityNotFound
+	}
+
+	for _, a := range r.airports {
+		if a.AirportID == airport.AirportID {
+			return 0, entity.ErrAirportExists
+		}
+	}
+
+	r.lastIDs.airport++
+	airport.ID = r.lastIDs.airport
+	r.airports[airport.ID] = airport
+
+	return airport.ID, nil
+}
+
+func (r *memoryRepository) GetAirport(ctx context.Context, id int) (entity.Airport, error) {
+	defer r.rlock(ctx)()
+
+	airport, ok := r.airports[id]
+	if !ok {
+		return entity.Airport{}, entity.ErrAirportNotFound
+	}
+
+	return airport, nil
+}
+
+func (r *memoryRepository) GetCityAirports(ctx context.Context, cityID int) ([]entity.Airport, error) {
+	defer r.rlock(ctx)()
+
+	var result []entity.Airport
+
+	for _, a := range r.airports {
+		if a.CityID == cityID {
+			result = append(result, a)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+// AddRoute fails with entity.ErrAirportNotFound when either airport is missing
+func (r *memoryRepository) AddRoute(ctx context.Context, route entity.Route) (int, error) {
+	defer r.lock(ctx)()
+
+	for _, airportID := range []int{route.SourceID, route.DestinationID} {
+		if _, ok := r.airports[airportID]; !ok {
+			return 0, entity.ErrAirportNotFound
+		}
+	}
+
+	r.lastIDs.route++
+	route.ID = r.lastIDs.route
+	r.routes[route.ID] = route
+
+	return route.ID, nil
+}
+
+func (r *memoryRepository) UpdateRoutePrice(ctx context.Context, id int, price float64) error {
+	defer r.lock(ctx)()
+
+	route, ok := r.routes[id]
+	if !ok {
+		return entity.ErrRouteNotFound
+	}
+
+	route.Price = price
+	r.routes[id] = route
+
+	return nil
+}
+
+func (r *memoryRepository) GetRoute(ctx context.Context, id int) (entity.Route, error) {
+	defer r.rlock(ctx)()
+
+	route, ok := r.routes[id]
+	if !ok {
+		return entity.Route{}, entity.ErrRouteNotFound
+	}
+
+	return route, nil
+}
+
+func (r *memoryRepository) GetRoutesFrom(ctx context.Context, sourceID int) ([]entity.Route, error) {
+	defer r.rlock(ctx)()
+
+	var result []entity.Route
+
+	for _, route := range r.routes {
+		if route.SourceID == sourceID {
+			result = append(result, route)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+// memoryIDs are last IDs of entities added after users and cities
+type memoryIDs struct {
+	comment      int
+	airport      int
+	route        int
+	event        int
+	subscription int
+	delivery     int
+}
+
+type memoryOutboxEvent struct {
+	event      entity.OutboxEvent
+	dispatched bool
+}
+
+func (r *memoryRepository) AddOutboxEvent(ctx context.Context, event entity.OutboxEvent) (int, error) {
+	defer r.lock(ctx)()
+
+	r.lastIDs.event++
+	event.ID = r.lastIDs.event
+	event.Payload = append([]byte(nil), event.Payload...)
+	r.outbox[event.ID] = memoryOutboxEvent{event: event}
+
+	return event.ID, nil
+}
+
+func (r *memoryRepository) GetUndispatchedEvents(ctx context.Context, limit int) ([]entity.OutboxEvent, error) {
+	defer r.rlock(ctx)()
+
+	var result []entity.OutboxEvent
+
+	for _, e := range r.outbox {
+		if !e.dispatched {
+			result = append(result, e.event)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+func (r *memoryRepository) ClaimOutboxEvent(ctx context.Context, id int, _ time.Time) (bool, error) {
+	defer r.lock(ctx)()
+
+	e, ok := r.outbox[id]
+	if !ok || e.dispatched {
+		return false, nil
+	}
+
+	e.dispatched = true
+	r.outbox[id] = e
+
+	return true, nil
+}
+
+func (r *memoryRepository) AddWebhookSubscription(ctx context.Context, s entity.WebhookSubscription) (int, error) {
+	defer r.lock(ctx)()
+
+	r.lastIDs.subscription++
+	s.ID = r.lastIDs.subscription
+	s.Topics = append([]string(nil), s.Topics...)
+	r.subscriptions[s.ID] = s
+
+	return s.ID, nil
+}
+
+func (r *memoryRepository) GetWebhookSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	defer r.rlock(ctx)()
+
+	var result []entity.WebhookSubscription
+
+	for _, s := range r.subscriptions {
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+func (r *memoryRepository) DeleteWebhookSubscription(ctx context.Context, id int) error {
+	defer r.lock(ctx)()
+
+	if _, ok := r.subscriptions[id]; !ok {
+		return entity.ErrSubscriptionNotFound
+	}
+
+	delete(r.subscriptions, id)
+
+	for deliveryID, d := range r.deliveries {
+		if d.SubscriptionID == id {
+			delete(r.deliveries, deliveryID)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) AddWebhookDelivery(ctx context.Context, d entity.WebhookDelivery) (int, error) {
+	defer r.lock(ctx)()
+
+	r.lastIDs.delivery++
+	d.ID = r.lastIDs.delivery
+	r.deliveries[d.ID] = d
+
+	return d.ID, nil
+}
+
+func (r *memoryRepository) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]entity.DueDelivery, error) {
+	defer r.rlock(ctx)()
+
+	var result []entity.DueDelivery
+
+	for _, d := range r.deliveries {
+		if d.Status != entity.DeliveryPending || d.NextAttempt.After(now) {
+			continue
+		}
+
+		s := r.subscriptions[d.SubscriptionID]
+		result = append(result, entity.DueDelivery{
+			Delivery: d,
+			Event:    r.outbox[d.EventID].event,
+			URL:      s.URL,
+			Secret:   s.Secret,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].Delivery, result[j].Delivery
+		if a.NextAttempt.Equal(b.NextAttempt) {
+			return a.ID < b.ID
+		}
+
+		return a.NextAttempt.Before(b.NextAttempt)
+	})
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+func (r *memoryRepository) ClaimDelivery(ctx context.Context, id int, now, until time.Time) (bool, error) {
+	defer r.lock(ctx)()
+
+	d, ok := r.deliveries[id]
+	if !ok || d.Status != entity.DeliveryPending || d.NextAttempt.After(now) {
+		return false, nil
+	}
+
+	d.NextAttempt = until
+	r.deliveries[id] = d
+
+	return true, nil
+}
+
+func (r *memoryRepository) UpdateDelivery(ctx context.Context, d entity.WebhookDelivery) error {
+	defer r.lock(ctx)()
+
+	if _, ok := r.deliveries[d.ID]; ok {
+		r.deliveries[d.ID] = d
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) GetWebhookDeliveries(ctx context.Context, subscriptionID int, status entity.DeliveryStatus) ([]entity.WebhookDelivery, error) {
+	defer r.rlock(ctx)()
+
+	var result []entity.WebhookDelivery
+
+	for _, d := range r.deliveries {
+		if d.SubscriptionID == subscriptionID && (status == "" || d.Status == status) {
+			result = append(result, d)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+func (r *memoryRepository) ReplayDelivery(ctx context.Context, subscriptionID, deliveryID int, now time.Time) error {
+	defer r.lock(ctx)()
+
+	d, ok := r.deliveries[deliveryID]
+	if !ok || d.SubscriptionID != subscriptionID {
+		return entity.ErrDeliveryNotFound
+	} else if d.Status != entity.DeliveryDead {
+		return entity.ErrDeliveryNotDead
+	}
+
+	d.Status = entity.DeliveryPending
+	d.Attempts = 0
+	d.NextAttempt = now
+	d.LastError = ""
+	d.Updated = now
+	r.deliveries[deliveryID] = d
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+)
+
+const (
+	mysqlDuplicateEntry   = 1062
+	mysqlLockWaitTimeout  = 1205
+	mysqlDeadlockDetected = 1213
+)
+
+func newMySQLRepository(ctx context.Context, dsn string, pool app.DbPool) (*sqlRepository, error) {
+	// comment times are scanned into time.Time and stored as UTC
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN: %w", err)
+	}
+
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+
+	db, err := openDB(ctx, "mysql", cfg.FormatDSN(), pool)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = migrateMySQL(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not migrate schema: %w", err)
+	}
+
+	return newSQLRepository(db, dialect{
+		isUniqueViolation: isMySQLUniqueViolation,
+		isRetryable:       isMySQLRetryable,
+	}), nil
+}
+
+// mysqlWebhookSchema creates tables of outbox and webhooks in databases created by init.sql before they existed
+var mysqlWebhookSchema = []string{
+	`CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER NOT NULL AUTO_INCREMENT,
+		topic VARCHAR(50) NOT NULL,
+		event_type VARCHAR(20) NOT NULL,
+		payload TEXT NOT NULL,
+		created BIGINT NOT NULL,
+		dispatched BIGINT NULL,
+		PRIMARY KEY (id),
+		INDEX idx_outbox_dispatched (dispatched, id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+		id INTEGER NOT NULL AUTO_INCREMENT,
+		url VARCHAR(500) NOT NULL,
+		secret VARCHAR(100) NOT NULL,
+		topics VARCHAR(255) NOT NULL DEFAULT '',
+		created BIGINT NOT NULL,
+		PRIMARY KEY (id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER NOT NULL AUTO_INCREMENT,
+		event_id INTEGER NOT NULL,
+		subscription_id INTEGER NOT NULL,
+		status VARCHAR(15) NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt BIGINT NOT NULL,
+		last_error VARCHAR(255) NOT NULL DEFAULT '',
+		updated BIGINT NOT NULL,
+		FOREIGN KEY (event_id) REFERENCES outbox(id),
+		FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+		PRIMARY KEY (id),
+		INDEX idx_webhook_deliveries_due (status, next_attempt)
+	)`,
+}
+
+// migrateMySQL brings schema of databases created by older init.sql up to date
+func migrateMySQL(ctx context.Context, db *sql.DB) error {
+	if err := addMySQLCityVersion(ctx, db); err != nil {
+		return err
+	}
+
+	if err := execAll(ctx, db, mysqlWebhookSchema); err != nil {
+		return err
+	}
+
+	return setSchemaVersion(ctx, db)
+}
+
+// addMySQLCityVersion adds version column to cities of databases created before it existed
+func addMySQLCityVersion(ctx context.Context, db *sql.DB) error {
+	var count int
+
+	query := `SELECT count(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = 'cities' AND column_name = 'version'`
+
+	err := db.QueryRowContext(ctx, query).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `ALTER TABLE cities ADD COLUMN version INTEGER NOT NULL DEFAULT 1`)
+
+	return err
+}
+
+func isMySQLUniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
+
+func isMySQLRetryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+
+	return errors.As(err, &mysqlErr) &&
+		(mysqlErr.Number == mysqlDeadlockDetected || mysqlErr.Number == mysqlLockWaitTimeout)
+}
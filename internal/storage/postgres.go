@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+)
+
+const (
+	postgresUniqueViolation      = "23505"
+	postgresSerializationFailure = "40001"
+	postgresDeadlockDetected     = "40P01"
+)
+
+// newPostgresRepository expects schema from init_postgres.sql, columns added later are migrated
+func newPostgresRepository(ctx context.Context, dsn string, pool app.DbPool) (*sqlRepository, error) {
+	db, err := openDB(ctx, "postgres", dsn, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = migratePostgres(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not migrate schema: %w", err)
+	}
+
+	return newSQLRepository(db, dialect{
+		numberedPlaceholders: true,
+		returningID:          true,
+		isUniqueViolation:    isPostgresUniqueViolation,
+		isRetryable:          isPostgresRetryable,
+	}), nil
+}
+
+// postgresWebhookSchema creates tables of outbox and webhooks in databases created by init_postgres.sql
+// before they existed
+var postgresWebhookSchema = []string{
+	`CREATE TABLE IF NOT EXISTS outbox (
+		id SERIAL PRIMARY KEY,
+		topic VARCHAR(50) NOT NULL,
+		event_type VARCHAR(20) NOT NULL,
+		payload TEXT NOT NULL,
+		created BIGINT NOT NULL,
+		dispatched BIGINT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_outbox_dispatched ON outbox (dispatched, id)`,
+	`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+		id SERIAL PRIMARY KEY,
+		url VARCHAR(500) NOT NULL,
+		secret VARCHAR(100) NOT NULL,
+		topics VARCHAR(255) NOT NULL DEFAULT '',
+		created BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id SERIAL PRIMARY KEY,
+		event_id INTEGER NOT NULL REFERENCES outbox(id),
+		subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+		status VARCHAR(15) NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt BIGINT NOT NULL,
+		last_error VARCHAR(255) NOT NULL DEFAULT '',
+		updated BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt)`,
+}
+
+// migratePostgres brings schema of databases created by older init_postgres.sql up to date
+func migratePostgres(ctx context.Context, db *sql.DB) error {
+	if err := addPostgresCityVersion(ctx, db); err != nil {
+		return err
+	}
+
+	if err := execAll(ctx, db, postgresWebhookSchema); err != nil {
+		return err
+	}
+
+	return setSchemaVersion(ctx, db)
+}
+
+// addPostgresCityVersion adds version column to cities of databases created before it existed
+func addPostgresCityVersion(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `ALTER TABLE cities ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1`)
+
+	return err
+}
+
+func isPostgresUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == postgresUniqueViolation
+}
+
+func isPostgresRetryable(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) &&
+		(pqErr.Code == postgresSerializationFailure || pqErr.Code == postgresDeadlockDetected)
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+type UserRepository interface {
+	GetUserByUsername(ctx context.Context, username string) (entity.User, error)
+	SaveUser(ctx context.Context, user entity.User) (int, error)
+}
+
+type CityRepository interface {
+	GetCityByNameAndCountry(ctx context.Context, city entity.City) (entity.City, error)
+	AddCity(ctx context.Context, city entity.City) (int, error)
+	UpdateCity(ctx context.Context, city entity.City) error
+	GetCity(ctx context.Context, id int) (entity.City, error)
+	GetAllCities(ctx context.Context) ([]entity.City, error)
+	ForEachCity(ctx context.Context, fn func(city entity.City) error) error
+	DeleteCity(ctx context.Context, city entity.City) error
+}
+
+type CommentRepository interface {
+	AddComment(ctx context.Context, comment entity.Comment) (int, error)
+	GetComment(ctx context.Context, id int) (entity.Comment, error)
+	// UpdateComment changes text and modified time of comment
+	UpdateComment(ctx context.Context, comment entity.Comment) error
+	DeleteComment(ctx context.Context, id int) error
+	// GetCityComments returns latest input.NumberOfComments comments of city, newest first
+	GetCityComments(ctx context.Context, input entity.GetCityCommentsInput) (entity.GetCityCommentsOutput, error)
+}
+
+type AirportRepository interface {
+	AddAirport(ctx context.Context, airport entity.Airport) (int, error)
+	GetAirport(ctx context.Context, id int) (entity.Airport, error)
+	GetCityAirports(ctx context.Context, cityID int) ([]entity.Airport, error)
+}
+
+type RouteRepository interface {
+	AddRoute(ctx context.Context, route entity.Route) (int, error)
+	UpdateRoutePrice(ctx context.Context, id int, price float64) error
+	GetRoute(ctx context.Context, id int) (entity.Route, error)
+	// GetRoutesFrom returns routes starting at airport
+	GetRoutesFrom(ctx context.Context, sourceID int) ([]entity.Route, error)
+}
+
+// OutboxRepository stores domain events, they are added in the same transaction as change
+// and later dispatched to webhook deliveries
+type OutboxRepository interface {
+	AddOutboxEvent(ctx context.Context, event entity.OutboxEvent) (int, error)
+	GetUndispatchedEvents(ctx context.Context, limit int) ([]entity.OutboxEvent, error)
+	ClaimOutboxEvent(ctx context.Context, id int, at time.Time) (bool, error)
+}
+
+type WebhookRepository interface {
+	AddWebhookSubscription(ctx context.Context, s entity.WebhookSubscription) (int, error)
+	GetWebhookSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, id int) error
+	AddWebhookDelivery(ctx context.Context, d entity.WebhookDelivery) (int, error)
+	GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]entity.DueDelivery, error)
+	ClaimDelivery(ctx context.Context, id int, now, until time.Time) (bool, error)
+	UpdateDelivery(ctx context.Context, d entity.WebhookDelivery) error
+	GetWebhookDeliveries(ctx context.Context, subscriptionID int, status entity.DeliveryStatus) ([]entity.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, subscriptionID, deliveryID int, now time.Time) error
+}
+
+// Repository is implemented by every storage backend
+type Repository interface {
+	UserRepository
+	CityRepository
+	CommentRepository
+	AirportRepository
+	RouteRepository
+	OutboxRepository
+	WebhookRepository
+	// Transaction runs fn atomically, repository calls made with ctx passed to fn are part of it
+	Transaction(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error
+	// Stats returns connection pool statistics, backends without a pool return zero values
+	Stats() sql.DBStats
+	// Ping checks that database is reachable
+	Ping(ctx context.Context) error
+	// CheckSchema checks that every table used by repository exists
+	CheckSchema(ctx context.Context) error
+	// SchemaVersion returns version written by last finished migration, 0 when there was none
+	SchemaVersion(ctx context.Context) (int, error)
+	// CheckRouteGraph checks that airports and routes are readable and every route connects existing airports
+	CheckRouteGraph(ctx context.Context) error
+	Close() error
+}
+
+// NewRepository opens the backend selected by api.dbDriver,
+// when driver is not set it is detected from DSN scheme and defaults to MySQL
+func NewRepository(ctx context.Context, cfg *app.Config) (Repository, error) {
+	driver := cfg.API.DbDriver
+	if driver == "" {
+		driver = driverFromDsn(cfg.API.DbDsn)
+	}
+
+	var (
+		repo *sqlRepository
+		err  error
+	)
+
+	switch driver {
+	case DriverMySQL:
+		repo, err = newMySQLRepository(ctx, cfg.API.DbDsn, cfg.API.DbPool)
+	case DriverPostgres:
+		repo, err = newPostgresRepository(ctx, cfg.API.DbDsn, cfg.API.DbPool)
+	case DriverSQLite:
+		repo, err = newSQLiteRepository(ctx, cfg.API.DbDsn, cfg.API.DbPool)
+	case DriverMemory:
+		return newMemoryRepository(), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+
+	// nil *sqlRepository must not be returned as non-nil Repository
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func driverFromDsn(dsn string) string {
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return DriverPostgres
+	default:
+		return DriverMySQL
+	}
+}
@@ -0,0 +1,104 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+	"github.com/strax84mb/go-travel-reactive/internal/storage/storagetest"
+)
+
+// newRepository returns factory of repositories for the conformance suite
+func newRepository(driver string, dsn func(t *testing.T) string) func(t *testing.T) storage.Repository {
+	return func(t *testing.T) storage.Repository {
+		cfg := app.DefaultConfig()
+		cfg.API.DbDriver = driver
+		cfg.API.DbDsn = dsn(t)
+
+		repo, err := storage.NewRepository(context.Background(), &cfg)
+		if err != nil {
+			t.Fatalf("could not open %s repository: %s", driver, err.Error())
+		}
+
+		return repo
+	}
+}
+
+func TestMemoryRepository(t *testing.T) {
+	storagetest.Run(t, newRepository(storage.DriverMemory, func(*testing.T) string {
+		return ""
+	}))
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	storagetest.Run(t, newRepository(storage.DriverSQLite, func(t *testing.T) string {
+		return "file:" + filepath.Join(t.TempDir(), "gotravel.sqlite")
+	}))
+}
+
+// servers are not started by tests, DSN of database created with init scripts is given in environment
+func TestMySQLRepository(t *testing.T) {
+	dsn := os.Getenv("GOTRAVEL_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("GOTRAVEL_TEST_MYSQL_DSN is not set")
+	}
+
+	storagetest.Run(t, newRepository(storage.DriverMySQL, func(*testing.T) string {
+		return dsn
+	}))
+}
+
+func TestPostgresRepository(t *testing.T) {
+	dsn := os.Getenv("GOTRAVEL_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("GOTRAVEL_TEST_POSTGRES_DSN is not set")
+	}
+
+	storagetest.Run(t, newRepository(storage.DriverPostgres, func(*testing.T) string {
+		return dsn
+	}))
+}
+
+func TestSQLiteSchemaVersion(t *testing.T) {
+	ctx := context.Background()
+	dsn := "file:" + filepath.Join(t.TempDir(), "gotravel.sqlite")
+
+	open := func() storage.Repository {
+		cfg := app.DefaultConfig()
+		cfg.API.DbDriver = storage.DriverSQLite
+		cfg.API.DbDsn = dsn
+
+		repo, err := storage.NewRepository(ctx, &cfg)
+		if err != nil {
+			t.Fatalf("could not open repository: %s", err.Error())
+		}
+
+		return repo
+	}
+
+	repo := open()
+
+	// database migrated by newer build keeps its version and older build is not ready
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("could not open database: %s", err.Error())
+	}
+
+	if _, err = db.Exec(`UPDATE schema_version SET version = ?`, storage.CurrentSchemaVersion+1); err != nil {
+		t.Fatalf("could not update version: %s", err.Error())
+	}
+
+	_ = db.Close()
+	_ = repo.Close()
+
+	repo = open()
+	defer repo.Close()
+
+	if version, err := repo.SchemaVersion(ctx); err != nil || version != storage.CurrentSchemaVersion+1 {
+		t.Errorf("expected schema version %d, got %d, %v", storage.CurrentSchemaVersion+1, version, err)
+	}
+}
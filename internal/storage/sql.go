@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	defaultMaxOpenConns = 10
+	defaultMaxIdleConns = 10
+	defaultPingTimeout  = 30 * time.Second
+)
+
+// dialect covers differences between databases behind sqlRepository,
+// all queries are written with ? placeholders
+type dialect struct {
+	// numberedPlaceholders replaces ? with $1, $2...
+	numberedPlaceholders bool
+	// returningID appends RETURNING id to inserts since LastInsertId is not supported
+	returningID bool
+	// defaultIsolationOnly ignores requested isolation level for drivers which can't set it
+	defaultIsolationOnly bool
+	isUniqueViolation    func(err error) bool
+	// isRetryable reports deadlocks and serialization failures after which transaction can be repeated
+	isRetryable func(err error) bool
+}
+
+type sqlRepository struct {
+	db      *sql.DB
+	dialect dialect
+
+	// stmts caches prepared statements by rebound query, they are closed with repository
+	mu    sync.RWMutex
+	stmts map[string]*sql.Stmt
+}
+
+func newSQLRepository(db *sql.DB, d dialect) *sqlRepository {
+	return &sqlRepository{
+		db:      db,
+		dialect: d,
+		stmts:   map[string]*sql.Stmt{},
+	}
+}
+
+// dbSystem returns semantic convention value for driver registered as driverName
+func dbSystem(driverName string) attribute.KeyValue {
+	switch driverName {
+	case "mysql":
+		return semconv.DBSystemMySQL
+	case "postgres":
+		return semconv.DBSystemPostgreSQL
+	default:
+		return semconv.DBSystemSqlite
+	}
+}
+
+// openDB applies pool settings and waits for database to become reachable,
+// statements are traced as children of span found in ctx
+func openDB(ctx context.Context, driverName, dsn string, pool app.DbPool) (*sql.DB, error) {
+	db, err := otelsql.Open(driverName, dsn,
+		otelsql.WithAttributes(dbSystem(driverName)),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitRows:             true,
+			OmitConnResetSession: true,
+			OmitConnectorConnect: true,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect: %w", err)
+	}
+
+	db.SetMaxOpenConns(defaultMaxOpenConns)
+	db.SetMaxIdleConns(defaultMaxIdleConns)
+
+	if pool.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+
+	if pool.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = defaultPingTimeout
+
+	if pool.PingTimeout > 0 {
+		b.MaxElapsedTime = pool.PingTimeout
+	}
+
+	err = backoff.Retry(func() error {
+		return db.PingContext(ctx)
+	}, backoff.WithContext(b, ctx))
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not ping database: %w", err)
+	}
+
+	return db, nil
+}
+
+// execAll runs statements one by one since MySQL driver rejects several statements in one call
+func execAll(ctx context.Context, db *sql.DB, statements []string) error {
+	for _, statement := range statements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CurrentSchemaVersion is written by migrations of this build,
+// 1 is schema of init scripts and 2 adds city versions, outbox and webhooks
+const CurrentSchemaVersion = 2
+
+// setSchemaVersion records that migrations finished, newer version written by other build is kept
+func setSchemaVersion(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	version, err := readSchemaVersion(ctx, db)
+	if err != nil || version >= CurrentSchemaVersion {
+		return err
+	}
+
+	return execAll(ctx, db, []string{
+		`DELETE FROM schema_version`,
+		`INSERT INTO schema_version (version) VALUES (` + strconv.Itoa(CurrentSchemaVersion) + `)`,
+	})
+}
+
+// readSchemaVersion returns 0 when migrations never finished
+func readSchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version sql.NullInt64
+
+	if err := db.QueryRowContext(ctx, `SELECT max(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return int(version.Int64), nil
+}
+
+func (r *sqlRepository) Stats() sql.DBStats {
+	return r.db.Stats()
+}
+
+func (r *sqlRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// schemaTables are created by init.sql, init_postgres.sql and sqliteSchema
+var schemaTables = []string{"users", "cities", "comments", "airports", "routes", "outbox", "webhook_subscriptions", "webhook_deliveries", "schema_version"}
+
+func (r *sqlRepository) CheckSchema(ctx context.Context) error {
+	for _, table := range schemaTables {
+		rows, err := r.db.QueryContext(ctx, "SELECT 1 FROM "+table+" WHERE 1 = 0")
+		if err != nil {
+			return fmt.Errorf("table %s is not usable: %w", table, err)
+		}
+
+		_ = rows.Close()
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) SchemaVersion(ctx context.Context) (int, error) {
+	return readSchemaVersion(ctx, r.db)
+}
+
+func (r *sqlRepository) CheckRouteGraph(ctx context.Context) error {
+	var dangling int
+
+	query := `SELECT count(*) FROM routes r
+		LEFT JOIN airports s ON s.id = r.source_id
+		LEFT JOIN airports d ON d.id = r.destination_id
+		WHERE s.id IS NULL OR d.id IS NULL`
+
+	if err := r.db.QueryRowContext(ctx, query).Scan(&dangling); err != nil {
+		return fmt.Errorf("could not read route graph: %w", err)
+	}
+
+	if dangling > 0 {
+		return fmt.Errorf("%d routes reference missing airports", dangling)
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for query, stmt := range r.stmts {
+		_ = stmt.Close()
+		delete(r.stmts, query)
+	}
+
+	return r.db.Close()
+}
+
+// rebind numbers placeholders for dialects which need it, ? inside quoted literals and identifiers is kept
+func (r *sqlRepository) rebind(query string) string {
+	if !r.dialect.numberedPlaceholders {
+		return query
+	}
+
+	var (
+		sb strings.Builder
+		n  int
+		// quote is ' or " while inside quoted section, doubled quote stays inside
+		quote rune
+	)
+
+	for _, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+
+			continue
+		}
+
+		sb.WriteRune(c)
+	}
+
+	return sb.String()
+}
+
+// prepare returns cached statement for query, bound to transaction from ctx if there is one.
+// Statement must not be closed by caller.
+func (r *sqlRepository) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if tx := r.txFromContext(ctx); tx != nil {
+		return r.prepareTx(ctx, tx, query)
+	}
+
+	query = r.rebind(query)
+
+	r.mu.RLock()
+	stmt, ok := r.stmts[query]
+	r.mu.RUnlock()
+
+	if ok {
+		return stmt, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stmt, ok = r.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, makeErrPreparingStatement(query, err)
+	}
+
+	r.stmts[query] = stmt
+
+	return stmt, nil
+}
+
+// prepareTx returns cached statement bound to tx, it is closed when tx ends.
+// Statements missing from cache are prepared on tx itself since preparing on
+// DB would need a second connection which SQLite backend does not have.
+func (r *sqlRepository) prepareTx(ctx context.Context, tx *sql.Tx, query string) (*sql.Stmt, error) {
+	query = r.rebind(query)
+
+	r.mu.RLock()
+	stmt, ok := r.stmts[query]
+	r.mu.RUnlock()
+
+	if ok {
+		return tx.StmtContext(ctx, stmt), nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, makeErrPreparingStatement(query, err)
+	}
+
+	return stmt, nil
+}
+
+// insert executes INSERT statement and returns ID of inserted row
+func (r *sqlRepository) insert(ctx context.Context, query string, args ...interface{}) (int, error) {
+	if r.dialect.returningID {
+		query += " RETURNING id"
+	}
+
+	stmt, err := r.prepare(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	if r.dialect.returningID {
+		var id int
+
+		if err = stmt.QueryRowContext(ctx, args...).Scan(&id); err != nil {
+			return 0, ErrQuerying{cause: err}
+		}
+
+		return id, nil
+	}
+
+	result, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return 0, ErrQuerying{cause: err}
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("could not get last inserted ID: %w", err)
+	}
+
+	return int(id), nil
+}
+
+// exec executes statement which result is not needed
+func (r *sqlRepository) exec(ctx context.Context, query string, args ...interface{}) error {
+	stmt, err := r.prepare(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	if _, err = stmt.ExecContext(ctx, args...); err != nil {
+		return ErrQuerying{cause: err}
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) uniqueViolation(err error) bool {
+	return r.dialect.isUniqueViolation != nil && r.dialect.isUniqueViolation(err)
+}
@@ -0,0 +1,46 @@
+package storage
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "placeholders",
+			query:    `SELECT id FROM cities WHERE name=? AND country=?`,
+			expected: `SELECT id FROM cities WHERE name=$1 AND country=$2`,
+		},
+		{
+			name:     "string literal",
+			query:    `SELECT id FROM comments WHERE text <> 'why?' AND city_id=?`,
+			expected: `SELECT id FROM comments WHERE text <> 'why?' AND city_id=$1`,
+		},
+		{
+			name:     "escaped quote",
+			query:    `UPDATE comments SET text='it''s ?' WHERE id=?`,
+			expected: `UPDATE comments SET text='it''s ?' WHERE id=$1`,
+		},
+		{
+			name:     "quoted identifier",
+			query:    `SELECT "what?" FROM cities WHERE id=?`,
+			expected: `SELECT "what?" FROM cities WHERE id=$1`,
+		},
+	}
+
+	r := &sqlRepository{dialect: dialect{numberedPlaceholders: true}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := r.rebind(tt.query); actual != tt.expected {
+				t.Fatalf("expected %s, got %s", tt.expected, actual)
+			}
+		})
+	}
+
+	if query := `SELECT ?`; (&sqlRepository{}).rebind(query) != query {
+		t.Fatal("query changed for dialect with ? placeholders")
+	}
+}
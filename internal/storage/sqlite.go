@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteSchema mirrors init.sql, tables are created only if missing so existing files are kept
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username VARCHAR(30) UNIQUE NOT NULL,
+	password VARCHAR(200) NOT NULL,
+	salt VARCHAR(100) NOT NULL,
+	role VARCHAR(15) NOT NULL
+);
+
+INSERT OR IGNORE INTO users (username, password, salt, role) VALUES
+('admin',
+ '92766f4ade6d45666bd4c26798a39c974874c118bd4d95815b62a548988fd7db33060246e2555bf93328d5dfabd3ffbd799efafbe4b9e775ca46d005fe0932072857d6e63173fa2c41ccd10d194bfef8',
+ '92766f4ade6d45666bd4c26798a39c97',
+ 'ADMIN');
+
+CREATE TABLE IF NOT EXISTS cities (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(100) NOT NULL,
+	country VARCHAR(100) NOT NULL,
+	version INTEGER NOT NULL DEFAULT 1
+);
+
+INSERT OR IGNORE INTO cities (id, name, country) VALUES
+(1, 'Beograd', 'Srbija'),
+(2, 'New York', 'USA'),
+(3, 'Paris', 'France'),
+(4, 'Berlin', 'Deutchland'),
+(5, 'Zagreb', 'Hrvatska');
+
+CREATE TABLE IF NOT EXISTS comments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	city_id INTEGER NOT NULL REFERENCES cities(id) ON DELETE CASCADE,
+	poster_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	text VARCHAR(255) NOT NULL,
+	created DATETIME NOT NULL,
+	modified DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS airports (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	airport_id INTEGER UNIQUE NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	city_id INTEGER NOT NULL REFERENCES cities(id)
+);
+
+CREATE TABLE IF NOT EXISTS routes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	source_id INTEGER NOT NULL REFERENCES airports(id),
+	destination_id INTEGER NOT NULL REFERENCES airports(id),
+	price REAL NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	topic VARCHAR(50) NOT NULL,
+	event_type VARCHAR(20) NOT NULL,
+	payload TEXT NOT NULL,
+	created INTEGER NOT NULL,
+	dispatched INTEGER NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_dispatched ON outbox (dispatched, id);
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url VARCHAR(500) NOT NULL,
+	secret VARCHAR(100) NOT NULL,
+	topics VARCHAR(255) NOT NULL DEFAULT '',
+	created INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event_id INTEGER NOT NULL REFERENCES outbox(id),
+	subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+	status VARCHAR(15) NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt INTEGER NOT NULL,
+	last_error VARCHAR(255) NOT NULL DEFAULT '',
+	updated INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt);
+`
+
+func newSQLiteRepository(ctx context.Context, dsn string, pool app.DbPool) (*sqlRepository, error) {
+	db, err := openDB(ctx, "sqlite", dsn, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows one writer at a time and every connection to ":memory:" opens a separate database,
+	// so the single connection is also kept open regardless of configured lifetime
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	if _, err = db.ExecContext(ctx, `PRAGMA foreign_keys = ON`); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not enable foreign keys: %w", err)
+	}
+
+	if _, err = db.ExecContext(ctx, sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not create schema: %w", err)
+	}
+
+	if err = addCityVersion(ctx, db); err == nil {
+		err = setSchemaVersion(ctx, db)
+	}
+
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not migrate schema: %w", err)
+	}
+
+	return newSQLRepository(db, dialect{
+		// transactions in SQLite are always serializable
+		defaultIsolationOnly: true,
+		isUniqueViolation:    isSQLiteUniqueViolation,
+		isRetryable:          isSQLiteRetryable,
+	}), nil
+}
+
+// addCityVersion adds version column to cities of files created before it existed
+func addCityVersion(ctx context.Context, db *sql.DB) error {
+	var count int
+
+	err := db.QueryRowContext(ctx, `SELECT count(*) FROM pragma_table_info('cities') WHERE name = 'version'`).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `ALTER TABLE cities ADD COLUMN version INTEGER NOT NULL DEFAULT 1`)
+
+	return err
+}
+
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+func isSQLiteRetryable(err error) bool {
+	var sqliteErr *sqlite.Error
+
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	// extended result codes keep primary code in the lowest byte
+	code := sqliteErr.Code() & 0xff
+
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
@@ -0,0 +1,529 @@
+// Package storagetest holds the conformance suite every storage backend has to pass
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+)
+
+// Run executes the suite against repositories returned by newRepository,
+// each subtest gets its own repository which is closed when the subtest ends
+func Run(t *testing.T, newRepository func(t *testing.T) storage.Repository) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo storage.Repository)
+	}{
+		{name: "SaveAndGetUser", fn: testSaveAndGetUser},
+		{name: "GetMissingUser", fn: testGetMissingUser},
+		{name: "SaveDuplicateUser", fn: testSaveDuplicateUser},
+		{name: "AddAndGetCity", fn: testAddAndGetCity},
+		{name: "GetCityByNameAndCountry", fn: testGetCityByNameAndCountry},
+		{name: "UpdateCity", fn: testUpdateCity},
+		{name: "GetAllCities", fn: testGetAllCities},
+		{name: "DeleteCity", fn: testDeleteCity},
+		{name: "TransactionRollback", fn: testTransactionRollback},
+		{name: "CommentLifecycle", fn: testCommentLifecycle},
+		{name: "GetCityComments", fn: testGetCityComments},
+		{name: "AirportsAndRoutes", fn: testAirportsAndRoutes},
+		{name: "DeleteCityWithDependents", fn: testDeleteCityWithDependents},
+		{name: "ReadinessChecks", fn: testReadinessChecks},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newRepository(t)
+			defer repo.Close()
+
+			tt.fn(t, repo)
+		})
+	}
+}
+
+func unique(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
+}
+
+func saveUser(t *testing.T, repo storage.Repository) entity.User {
+	user := entity.User{
+		Username: unique("user"),
+		Password: "encoded-password",
+		Salt:     []byte{1, 2, 3, 4},
+		Role:     entity.CommonUserRole,
+	}
+
+	id, err := repo.SaveUser(context.Background(), user)
+	if err != nil {
+		t.Fatalf("SaveUser failed: %s", err.Error())
+	}
+
+	user.ID = id
+
+	return user
+}
+
+func addCity(t *testing.T, repo storage.Repository) entity.City {
+	city := entity.City{
+		Name:    unique("city"),
+		Country: unique("country"),
+	}
+
+	id, err := repo.AddCity(context.Background(), city)
+	if err != nil {
+		t.Fatalf("AddCity failed: %s", err.Error())
+	}
+
+	city.ID = id
+	city.Version = 1
+
+	return city
+}
+
+// uniqueNumber is used where column is numeric and unique
+func uniqueNumber() int {
+	return int(time.Now().UnixNano() % 1000000000)
+}
+
+func addComment(t *testing.T, repo storage.Repository, city entity.City, poster entity.User, created time.Time) entity.Comment {
+	comment := entity.Comment{
+		CityID:   city.ID,
+		PosterID: poster.ID,
+		Text:     unique("text"),
+		Created:  created,
+		Modified: created,
+	}
+
+	id, err := repo.AddComment(context.Background(), comment)
+	if err != nil {
+		t.Fatalf("AddComment failed: %s", err.Error())
+	}
+
+	comment.ID = id
+
+	return comment
+}
+
+func addAirport(t *testing.T, repo storage.Repository, city entity.City) entity.Airport {
+	airport := entity.Airport{
+		AirportID: uniqueNumber(),
+		Name:      unique("airport"),
+		CityID:    city.ID,
+	}
+
+	id, err := repo.AddAirport(context.Background(), airport)
+	if err != nil {
+		t.Fatalf("AddAirport failed: %s", err.Error())
+	}
+
+	airport.ID = id
+
+	return airport
+}
+
+func testSaveAndGetUser(t *testing.T, repo storage.Repository) {
+	saved := saveUser(t, repo)
+
+	user, err := repo.GetUserByUsername(context.Background(), saved.Username)
+	if err != nil {
+		t.Fatalf("GetUserByUsername failed: %s", err.Error())
+	}
+
+	if user.ID != saved.ID || user.Username != saved.Username || user.Password != saved.Password ||
+		user.Role != saved.Role || string(user.Salt) != string(saved.Salt) {
+		t.Fatalf("expected %+v, got %+v", saved, user)
+	}
+}
+
+func testGetMissingUser(t *testing.T, repo storage.Repository) {
+	_, err := repo.GetUserByUsername(context.Background(), unique("missing"))
+	if !errors.Is(err, entity.ErrUsernameNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrUsernameNotFound, err)
+	}
+}
+
+func testSaveDuplicateUser(t *testing.T, repo storage.Repository) {
+	saved := saveUser(t, repo)
+
+	if _, err := repo.SaveUser(context.Background(), saved); !errors.Is(err, entity.ErrUsernameTaken) {
+		t.Fatalf("expected %v, got %v", entity.ErrUsernameTaken, err)
+	}
+}
+
+func testAddAndGetCity(t *testing.T, repo storage.Repository) {
+	added := addCity(t, repo)
+
+	city, err := repo.GetCity(context.Background(), added.ID)
+	if err != nil {
+		t.Fatalf("GetCity failed: %s", err.Error())
+	}
+
+	if city != added {
+		t.Fatalf("expected %+v, got %+v", added, city)
+	}
+
+	if _, err = repo.GetCity(context.Background(), added.ID+1000000); !errors.Is(err, entity.ErrCityNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCityNotFound, err)
+	}
+}
+
+func testGetCityByNameAndCountry(t *testing.T, repo storage.Repository) {
+	added := addCity(t, repo)
+
+	city, err := repo.GetCityByNameAndCountry(context.Background(), entity.City{
+		Name:    added.Name,
+		Country: added.Country,
+	})
+	if err != nil {
+		t.Fatalf("GetCityByNameAndCountry failed: %s", err.Error())
+	}
+
+	if city != added {
+		t.Fatalf("expected %+v, got %+v", added, city)
+	}
+
+	_, err = repo.GetCityByNameAndCountry(context.Background(), entity.City{
+		Name:    added.Name,
+		Country: unique("other"),
+	})
+	if !errors.Is(err, entity.ErrCityNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCityNotFound, err)
+	}
+}
+
+func testUpdateCity(t *testing.T, repo storage.Repository) {
+	city := addCity(t, repo)
+	city.Name = unique("renamed")
+
+	if err := repo.UpdateCity(context.Background(), city); err != nil {
+		t.Fatalf("UpdateCity failed: %s", err.Error())
+	}
+
+	updated, err := repo.GetCity(context.Background(), city.ID)
+	if err != nil {
+		t.Fatalf("GetCity failed: %s", err.Error())
+	}
+
+	city.Version++
+	if updated != city {
+		t.Fatalf("expected %+v, got %+v", city, updated)
+	}
+
+	stale := city
+	stale.Version--
+
+	if err = repo.UpdateCity(context.Background(), stale); !errors.Is(err, entity.ErrCityChanged) {
+		t.Fatalf("expected %v, got %v", entity.ErrCityChanged, err)
+	}
+
+	city.ID += 1000000
+	if err = repo.UpdateCity(context.Background(), city); !errors.Is(err, entity.ErrCityNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCityNotFound, err)
+	}
+}
+
+func testGetAllCities(t *testing.T, repo storage.Repository) {
+	first := addCity(t, repo)
+	second := addCity(t, repo)
+
+	cities, err := repo.GetAllCities(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllCities failed: %s", err.Error())
+	}
+
+	found := 0
+
+	for _, c := range cities {
+		if c == first || c == second {
+			found++
+		}
+	}
+
+	if found != 2 {
+		t.Fatalf("expected both added cities in %+v", cities)
+	}
+}
+
+func testDeleteCity(t *testing.T, repo storage.Repository) {
+	city := addCity(t, repo)
+
+	stale := city
+	stale.Version++
+
+	if err := repo.DeleteCity(context.Background(), stale); !errors.Is(err, entity.ErrCityChanged) {
+		t.Fatalf("expected %v, got %v", entity.ErrCityChanged, err)
+	}
+
+	if err := repo.DeleteCity(context.Background(), city); err != nil {
+		t.Fatalf("DeleteCity failed: %s", err.Error())
+	}
+
+	if _, err := repo.GetCity(context.Background(), city.ID); !errors.Is(err, entity.ErrCityNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCityNotFound, err)
+	}
+
+	if err := repo.DeleteCity(context.Background(), city); !errors.Is(err, entity.ErrCityNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCityNotFound, err)
+	}
+}
+
+var errRollback = errors.New("rollback")
+
+// testTransactionRollback checks that rollback drops changes of transaction but keeps
+// changes made outside of it in the meantime
+func testTransactionRollback(t *testing.T, repo storage.Repository) {
+	var (
+		city  entity.City
+		saved = make(chan error, 1)
+		user  = entity.User{Username: unique("user"), Password: "encoded-password", Salt: []byte{1}, Role: entity.CommonUserRole}
+	)
+
+	err := repo.Transaction(context.Background(), storage.TxOptions{}, func(ctx context.Context) error {
+		city = entity.City{Name: unique("city"), Country: unique("country")}
+
+		var err error
+		if city.ID, err = repo.AddCity(ctx, city); err != nil {
+			return err
+		}
+
+		go func() {
+			_, err := repo.SaveUser(context.Background(), user)
+			saved <- err
+		}()
+
+		// backends may make concurrent writes wait until transaction ends
+		select {
+		case err = <-saved:
+			saved <- err
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("expected %v, got %v", errRollback, err)
+	}
+
+	if err = <-saved; err != nil {
+		t.Fatalf("SaveUser failed: %s", err.Error())
+	}
+
+	if _, err = repo.GetCity(context.Background(), city.ID); !errors.Is(err, entity.ErrCityNotFound) {
+		t.Fatalf("city added in rolled back transaction was kept: %v", err)
+	}
+
+	if _, err = repo.GetUserByUsername(context.Background(), user.Username); err != nil {
+		t.Fatalf("user saved outside of transaction was lost: %v", err)
+	}
+}
+
+// second is precision of comment times in every backend
+var commentTime = time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+func testCommentLifecycle(t *testing.T, repo storage.Repository) {
+	ctx := context.Background()
+	city := addCity(t, repo)
+	comment := addComment(t, repo, city, saveUser(t, repo), commentTime)
+
+	stored, err := repo.GetComment(ctx, comment.ID)
+	if err != nil {
+		t.Fatalf("GetComment failed: %s", err.Error())
+	}
+
+	if !stored.Created.Equal(comment.Created) || stored.Text != comment.Text || stored.CityID != city.ID {
+		t.Fatalf("expected %+v, got %+v", comment, stored)
+	}
+
+	comment.Text = unique("edited")
+	comment.Modified = commentTime.Add(time.Hour)
+
+	if err = repo.UpdateComment(ctx, comment); err != nil {
+		t.Fatalf("UpdateComment failed: %s", err.Error())
+	}
+
+	if stored, _ = repo.GetComment(ctx, comment.ID); stored.Text != comment.Text || !stored.Modified.Equal(comment.Modified) {
+		t.Fatalf("expected %+v, got %+v", comment, stored)
+	}
+
+	if err = repo.DeleteComment(ctx, comment.ID); err != nil {
+		t.Fatalf("DeleteComment failed: %s", err.Error())
+	}
+
+	if _, err = repo.GetComment(ctx, comment.ID); !errors.Is(err, entity.ErrCommentNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCommentNotFound, err)
+	}
+
+	if err = repo.DeleteComment(ctx, comment.ID); !errors.Is(err, entity.ErrCommentNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCommentNotFound, err)
+	}
+
+	if err = repo.UpdateComment(ctx, comment); !errors.Is(err, entity.ErrCommentNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCommentNotFound, err)
+	}
+
+	comment.CityID += 1000000
+	if _, err = repo.AddComment(ctx, comment); !errors.Is(err, entity.ErrCityNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCityNotFound, err)
+	}
+}
+
+func testGetCityComments(t *testing.T, repo storage.Repository) {
+	city := addCity(t, repo)
+	poster := saveUser(t, repo)
+	oldest := addComment(t, repo, city, poster, commentTime)
+	newest := addComment(t, repo, city, poster, commentTime.Add(2*time.Hour))
+	middle := addComment(t, repo, city, poster, commentTime.Add(time.Hour))
+	addComment(t, repo, addCity(t, repo), poster, commentTime)
+
+	output, err := repo.GetCityComments(context.Background(), entity.GetCityCommentsInput{City: city, NumberOfComments: 2})
+	if err != nil {
+		t.Fatalf("GetCityComments failed: %s", err.Error())
+	}
+
+	if len(output.Comments) != 2 || output.Comments[0].Comment.ID != newest.ID || output.Comments[1].Comment.ID != middle.ID {
+		t.Fatalf("expected comments %d and %d, got %+v", newest.ID, middle.ID, output.Comments)
+	}
+
+	if output.Comments[0].PosterName != poster.Username || output.City != city {
+		t.Fatalf("expected poster %s of city %+v, got %+v", poster.Username, city, output)
+	}
+
+	output, err = repo.GetCityComments(context.Background(), entity.GetCityCommentsInput{City: city, NumberOfComments: 10})
+	if err != nil || len(output.Comments) != 3 || output.Comments[2].Comment.ID != oldest.ID {
+		t.Fatalf("expected all 3 comments, got %+v, %v", output.Comments, err)
+	}
+
+	output, err = repo.GetCityComments(context.Background(), entity.GetCityCommentsInput{City: city})
+	if err != nil || output.Comments == nil || len(output.Comments) != 0 {
+		t.Fatalf("expected empty list, got %+v, %v", output.Comments, err)
+	}
+}
+
+func testAirportsAndRoutes(t *testing.T, repo storage.Repository) {
+	ctx := context.Background()
+	city := addCity(t, repo)
+	source := addAirport(t, repo, city)
+	destination := addAirport(t, repo, addCity(t, repo))
+
+	airport, err := repo.GetAirport(ctx, source.ID)
+	if err != nil || airport != source {
+		t.Fatalf("expected %+v, got %+v, %v", source, airport, err)
+	}
+
+	if _, err = repo.AddAirport(ctx, source); !errors.Is(err, entity.ErrAirportExists) {
+		t.Fatalf("expected %v, got %v", entity.ErrAirportExists, err)
+	}
+
+	missingCity := entity.Airport{AirportID: uniqueNumber(), Name: unique("airport"), CityID: city.ID + 1000000}
+	if _, err = repo.AddAirport(ctx, missingCity); !errors.Is(err, entity.ErrCityNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCityNotFound, err)
+	}
+
+	airports, err := repo.GetCityAirports(ctx, city.ID)
+	if err != nil || len(airports) != 1 || airports[0] != source {
+		t.Fatalf("expected [%+v], got %+v, %v", source, airports, err)
+	}
+
+	route := entity.Route{SourceID: source.ID, DestinationID: destination.ID, Price: 99.5}
+
+	if route.ID, err = repo.AddRoute(ctx, route); err != nil {
+		t.Fatalf("AddRoute failed: %s", err.Error())
+	}
+
+	if stored, err := repo.GetRoute(ctx, route.ID); err != nil || stored != route {
+		t.Fatalf("expected %+v, got %+v, %v", route, stored, err)
+	}
+
+	routes, err := repo.GetRoutesFrom(ctx, source.ID)
+	if err != nil || len(routes) != 1 || routes[0] != route {
+		t.Fatalf("expected [%+v], got %+v, %v", route, routes, err)
+	}
+
+	route.Price = 120
+	if err = repo.UpdateRoutePrice(ctx, route.ID, route.Price); err != nil {
+		t.Fatalf("UpdateRoutePrice failed: %s", err.Error())
+	}
+
+	// unchanged price is not reported as missing route
+	if err = repo.UpdateRoutePrice(ctx, route.ID, route.Price); err != nil {
+		t.Fatalf("UpdateRoutePrice with same price failed: %s", err.Error())
+	}
+
+	if stored, err := repo.GetRoute(ctx, route.ID); err != nil || stored != route {
+		t.Fatalf("expected %+v, got %+v, %v", route, stored, err)
+	}
+
+	if err = repo.UpdateRoutePrice(ctx, route.ID+1000000, 1); !errors.Is(err, entity.ErrRouteNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrRouteNotFound, err)
+	}
+
+	route.DestinationID += 1000000
+	if _, err = repo.AddRoute(ctx, route); !errors.Is(err, entity.ErrAirportNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrAirportNotFound, err)
+	}
+
+	if _, err = repo.GetRoute(ctx, route.ID+1000000); !errors.Is(err, entity.ErrRouteNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrRouteNotFound, err)
+	}
+}
+
+func testDeleteCityWithDependents(t *testing.T, repo storage.Repository) {
+	ctx := context.Background()
+	city := addCity(t, repo)
+	comment := addComment(t, repo, city, saveUser(t, repo), commentTime)
+	airport := addAirport(t, repo, city)
+	other := addAirport(t, repo, addCity(t, repo))
+
+	routeID, err := repo.AddRoute(ctx, entity.Route{SourceID: other.ID, DestinationID: airport.ID, Price: 10})
+	if err != nil {
+		t.Fatalf("AddRoute failed: %s", err.Error())
+	}
+
+	if err = repo.DeleteCity(ctx, city); err != nil {
+		t.Fatalf("DeleteCity failed: %s", err.Error())
+	}
+
+	if _, err = repo.GetComment(ctx, comment.ID); !errors.Is(err, entity.ErrCommentNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrCommentNotFound, err)
+	}
+
+	if _, err = repo.GetAirport(ctx, airport.ID); !errors.Is(err, entity.ErrAirportNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrAirportNotFound, err)
+	}
+
+	if _, err = repo.GetRoute(ctx, routeID); !errors.Is(err, entity.ErrRouteNotFound) {
+		t.Fatalf("expected %v, got %v", entity.ErrRouteNotFound, err)
+	}
+
+	if _, err = repo.GetAirport(ctx, other.ID); err != nil {
+		t.Fatalf("airport of other city was deleted: %v", err)
+	}
+}
+
+func testReadinessChecks(t *testing.T, repo storage.Repository) {
+	ctx := context.Background()
+
+	if err := repo.CheckSchema(ctx); err != nil {
+		t.Errorf("CheckSchema failed: %s", err.Error())
+	}
+
+	if version, err := repo.SchemaVersion(ctx); err != nil || version != storage.CurrentSchemaVersion {
+		t.Errorf("expected schema version %d, got %d, %v", storage.CurrentSchemaVersion, version, err)
+	}
+
+	source := addAirport(t, repo, addCity(t, repo))
+	destination := addAirport(t, repo, addCity(t, repo))
+
+	if _, err := repo.AddRoute(ctx, entity.Route{SourceID: source.ID, DestinationID: destination.ID, Price: 10}); err != nil {
+		t.Fatalf("AddRoute failed: %s", err.Error())
+	}
+
+	if err := repo.CheckRouteGraph(ctx); err != nil {
+		t.Errorf("CheckRouteGraph failed: %s", err.Error())
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// TxOptions configures Transaction, zero value uses default isolation level and no retries
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	// MaxRetries is number of additional attempts after deadlock or serialization failure
+	MaxRetries int
+}
+
+type sqlTxKey struct {
+	repo *sqlRepository
+}
+
+func (r *sqlRepository) txFromContext(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(sqlTxKey{repo: r}).(*sql.Tx)
+	return tx
+}
+
+// Transaction runs fn in a transaction which is rolled back if fn returns error or panics.
+// Repository calls made with ctx passed to fn are part of the transaction,
+// nested calls join transaction which is already in progress.
+func (r *sqlRepository) Transaction(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	if r.txFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	b := backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), uint64(opts.MaxRetries)), ctx)
+
+	return backoff.Retry(func() error {
+		err := r.runTx(ctx, opts, fn)
+		if err != nil && !r.retryable(err) {
+			return backoff.Permanent(err)
+		}
+
+		return err
+	}, b)
+}
+
+func (r *sqlRepository) runTx(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) (err error) {
+	txOpts := &sql.TxOptions{Isolation: opts.Isolation}
+	if r.dialect.defaultIsolationOnly {
+		txOpts.Isolation = sql.LevelDefault
+	}
+
+	tx, err := r.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return ErrBeginTx{cause: err}
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = fn(context.WithValue(ctx, sqlTxKey{repo: r}, tx)); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return ErrCommitTx{cause: err}
+	}
+
+	return nil
+}
+
+func (r *sqlRepository) retryable(err error) bool {
+	return r.dialect.isRetryable != nil && r.dialect.isRetryable(err)
+}
+
+type memoryTxKey struct {
+	repo *memoryRepository
+}
+
+func (r *memoryRepository) inTransaction(ctx context.Context) bool {
+	return ctx.Value(memoryTxKey{repo: r}) != nil
+}
+
+// Transaction holds write lock until fn returns, so calls made outside of it wait and can't be lost
+// when data is restored from snapshot after fn returns error or panics. Calls made within fn
+// have to use ctx passed to it.
+func (r *memoryRepository) Transaction(ctx context.Context, _ TxOptions, fn func(ctx context.Context) error) error {
+	if r.inTransaction(ctx) {
+		return fn(ctx)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := r.snapshot()
+
+	defer func() {
+		if p := recover(); p != nil {
+			r.restore(snapshot)
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, memoryTxKey{repo: r}, true)); err != nil {
+		r.restore(snapshot)
+		return err
+	}
+
+	return nil
+}
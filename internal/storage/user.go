@@ -7,38 +7,17 @@ import (
 	"errors"
 	"fmt"
 
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/strax84mb/go-travel-reactive/internal/entity"
 )
 
-func NewRepository(dsn string) (*repository, error) {
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, fmt.Errorf("could not connect: %w", err)
-	}
-
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(10)
-
-	return &repository{db: db}, nil
-}
-
-type repository struct {
-	db *sql.DB
-}
-
-// GetUserByUsername input is username
-func (r *repository) GetUserByUsername(ctx context.Context, usernameItem interface{}) (interface{}, error) {
-	username := usernameItem.(string)
+func (r *sqlRepository) GetUserByUsername(ctx context.Context, username string) (entity.User, error) {
 	query := `SELECT id, password, salt, role FROM users WHERE username = ?`
 
-	stmt, err := r.db.Prepare(query)
+	stmt, err := r.prepare(ctx, query)
 	if err != nil {
-		return entity.User{}, makeErrPreparingStatement(query, err)
+		return entity.User{}, err
 	}
 
-	defer stmt.Close()
-
 	var salt string
 
 	user := entity.User{
@@ -63,27 +42,17 @@ func (r *repository) GetUserByUsername(ctx context.Context, usernameItem interfa
 }
 
 // SaveUser returns last inserted ID
-// input is entity.User
-func (r *repository) SaveUser(ctx context.Context, userItem interface{}) (interface{}, error) {
-	user := userItem.(entity.User)
+func (r *sqlRepository) SaveUser(ctx context.Context, user entity.User) (int, error) {
 	query := `INSERT INTO users (username, password, salt, role) VALUES (?, ?, ?, ?)`
 
-	stmt, err := r.db.Prepare(query)
-	if err != nil {
-		return 0, makeErrPreparingStatement(query, err)
-	}
-
-	defer stmt.Close()
-
-	result, err := stmt.ExecContext(ctx, user.Username, user.Password, hex.EncodeToString(user.Salt), user.Role)
+	id, err := r.insert(ctx, query, user.Username, user.Password, hex.EncodeToString(user.Salt), user.Role)
 	if err != nil {
-		return 0, ErrQuerying{cause: err}
-	}
+		if r.uniqueViolation(err) {
+			return 0, entity.ErrUsernameTaken
+		}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("could not get last inserted ID: %w", err)
+		return 0, err
 	}
 
-	return int(id), nil
+	return id, nil
 }
@@ -0,0 +1,325 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+)
+
+// maxLastErrorLength matches last_error column
+const maxLastErrorLength = 255
+
+// times of outbox and webhooks are stored as unix milliseconds
+func toMillis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
+
+func joinTopics(topics []string) string {
+	return strings.Join(topics, ",")
+}
+
+func splitTopics(topics string) []string {
+	if topics == "" {
+		return nil
+	}
+
+	return strings.Split(topics, ",")
+}
+
+func truncateError(message string) string {
+	if len(message) <= maxLastErrorLength {
+		return message
+	}
+
+	return message[:maxLastErrorLength]
+}
+
+func (r *sqlRepository) AddOutboxEvent(ctx context.Context, event entity.OutboxEvent) (int, error) {
+	return r.insert(ctx, `INSERT INTO outbox (topic, event_type, payload, created) VALUES (?, ?, ?, ?)`,
+		event.Topic, event.Type, string(event.Payload), toMillis(event.Created))
+}
+
+// GetUndispatchedEvents returns oldest events which have no deliveries yet
+func (r *sqlRepository) GetUndispatchedEvents(ctx context.Context, limit int) ([]entity.OutboxEvent, error) {
+	query := `SELECT id, topic, event_type, payload, created FROM outbox WHERE dispatched IS NULL ORDER BY id LIMIT ?`
+
+	stmt, err := r.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, limit)
+	if err != nil {
+		return nil, ErrQuerying{cause: err}
+	}
+
+	defer rows.Close()
+
+	var result []entity.OutboxEvent
+
+	for rows.Next() {
+		var (
+			event   entity.OutboxEvent
+			payload string
+			created int64
+		)
+
+		if err = rows.Scan(&event.ID, &event.Topic, &event.Type, &payload, &created); err != nil {
+			return nil, ErrScanning{cause: err}
+		}
+
+		event.Payload = []byte(payload)
+		event.Created = fromMillis(created)
+		result = append(result, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, ErrIteration{cause: err}
+	}
+
+	return result, nil
+}
+
+// ClaimOutboxEvent marks event as dispatched, false means that someone else dispatched it first
+func (r *sqlRepository) ClaimOutboxEvent(ctx context.Context, id int, at time.Time) (bool, error) {
+	return r.execAffected(ctx, `UPDATE outbox SET dispatched=? WHERE id=? AND dispatched IS NULL`, toMillis(at), id)
+}
+
+// execAffected executes statement and tells if it changed any row
+func (r *sqlRepository) execAffected(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	stmt, err := r.prepare(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return false, ErrQuerying{cause: err}
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not get number of affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+func (r *sqlRepository) AddWebhookSubscription(ctx context.Context, s entity.WebhookSubscription) (int, error) {
+	return r.insert(ctx, `INSERT INTO webhook_subscriptions (url, secret, topics, created) VALUES (?, ?, ?, ?)`,
+		s.URL, s.Secret, joinTopics(s.Topics), toMillis(s.Created))
+}
+
+func (r *sqlRepository) GetWebhookSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	query := `SELECT id, url, secret, topics, created FROM webhook_subscriptions ORDER BY id`
+
+	stmt, err := r.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, ErrQuerying{cause: err}
+	}
+
+	defer rows.Close()
+
+	var result []entity.WebhookSubscription
+
+	for rows.Next() {
+		var (
+			s       entity.WebhookSubscription
+			topics  string
+			created int64
+		)
+
+		if err = rows.Scan(&s.ID, &s.URL, &s.Secret, &topics, &created); err != nil {
+			return nil, ErrScanning{cause: err}
+		}
+
+		s.Topics = splitTopics(topics)
+		s.Created = fromMillis(created)
+		result = append(result, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, ErrIteration{cause: err}
+	}
+
+	return result, nil
+}
+
+// DeleteWebhookSubscription removes subscription with its deliveries
+func (r *sqlRepository) DeleteWebhookSubscription(ctx context.Context, id int) error {
+	return r.Transaction(ctx, TxOptions{}, func(ctx context.Context) error {
+		if err := r.exec(ctx, `DELETE FROM webhook_deliveries WHERE subscription_id=?`, id); err != nil {
+			return err
+		}
+
+		deleted, err := r.execAffected(ctx, `DELETE FROM webhook_subscriptions WHERE id=?`, id)
+		if err != nil {
+			return err
+		} else if !deleted {
+			return entity.ErrSubscriptionNotFound
+		}
+
+		return nil
+	})
+}
+
+func (r *sqlRepository) AddWebhookDelivery(ctx context.Context, d entity.WebhookDelivery) (int, error) {
+	return r.insert(ctx, `INSERT INTO webhook_deliveries (event_id, subscription_id, status, attempts, next_attempt, last_error, updated)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		d.EventID, d.SubscriptionID, string(d.Status), d.Attempts, toMillis(d.NextAttempt), truncateError(d.LastError), toMillis(d.Updated))
+}
+
+// GetDueDeliveries returns pending deliveries which next attempt is not after now, earliest first
+func (r *sqlRepository) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]entity.DueDelivery, error) {
+	query := `SELECT d.id, d.event_id, d.subscription_id, d.status, d.attempts, d.next_attempt, d.last_error, d.updated,
+			o.topic, o.event_type, o.payload, o.created, s.url, s.secret
+		FROM webhook_deliveries d
+		JOIN outbox o ON o.id = d.event_id
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = ? AND d.next_attempt <= ?
+		ORDER BY d.next_attempt, d.id
+		LIMIT ?`
+
+	stmt, err := r.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, string(entity.DeliveryPending), toMillis(now), limit)
+	if err != nil {
+		return nil, ErrQuerying{cause: err}
+	}
+
+	defer rows.Close()
+
+	var result []entity.DueDelivery
+
+	for rows.Next() {
+		var (
+			due                           entity.DueDelivery
+			payload                       string
+			nextAttempt, updated, created int64
+		)
+
+		err = rows.Scan(&due.Delivery.ID, &due.Delivery.EventID, &due.Delivery.SubscriptionID, &due.Delivery.Status,
+			&due.Delivery.Attempts, &nextAttempt, &due.Delivery.LastError, &updated,
+			&due.Event.Topic, &due.Event.Type, &payload, &created, &due.URL, &due.Secret)
+		if err != nil {
+			return nil, ErrScanning{cause: err}
+		}
+
+		due.Delivery.NextAttempt = fromMillis(nextAttempt)
+		due.Delivery.Updated = fromMillis(updated)
+		due.Event.ID = due.Delivery.EventID
+		due.Event.Payload = []byte(payload)
+		due.Event.Created = fromMillis(created)
+		result = append(result, due)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, ErrIteration{cause: err}
+	}
+
+	return result, nil
+}
+
+// ClaimDelivery postpones due delivery until lease ends so that other dispatchers skip it,
+// false means that someone else claimed it first
+func (r *sqlRepository) ClaimDelivery(ctx context.Context, id int, now, until time.Time) (bool, error) {
+	return r.execAffected(ctx, `UPDATE webhook_deliveries SET next_attempt=? WHERE id=? AND status=? AND next_attempt <= ?`,
+		toMillis(until), id, string(entity.DeliveryPending), toMillis(now))
+}
+
+// UpdateDelivery stores outcome of delivery attempt
+func (r *sqlRepository) UpdateDelivery(ctx context.Context, d entity.WebhookDelivery) error {
+	return r.exec(ctx, `UPDATE webhook_deliveries SET status=?, attempts=?, next_attempt=?, last_error=?, updated=? WHERE id=?`,
+		string(d.Status), d.Attempts, toMillis(d.NextAttempt), truncateError(d.LastError), toMillis(d.Updated), d.ID)
+}
+
+// GetWebhookDeliveries lists deliveries of subscription, all statuses when status is empty
+func (r *sqlRepository) GetWebhookDeliveries(ctx context.Context, subscriptionID int, status entity.DeliveryStatus) ([]entity.WebhookDelivery, error) {
+	query := `SELECT id, event_id, subscription_id, status, attempts, next_attempt, last_error, updated
+		FROM webhook_deliveries WHERE subscription_id=? AND (? = '' OR status=?) ORDER BY id`
+
+	stmt, err := r.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, subscriptionID, string(status), string(status))
+	if err != nil {
+		return nil, ErrQuerying{cause: err}
+	}
+
+	defer rows.Close()
+
+	var result []entity.WebhookDelivery
+
+	for rows.Next() {
+		var (
+			d                    entity.WebhookDelivery
+			nextAttempt, updated int64
+		)
+
+		err = rows.Scan(&d.ID, &d.EventID, &d.SubscriptionID, &d.Status, &d.Attempts, &nextAttempt, &d.LastError, &updated)
+		if err != nil {
+			return nil, ErrScanning{cause: err}
+		}
+
+		d.NextAttempt = fromMillis(nextAttempt)
+		d.Updated = fromMillis(updated)
+		result = append(result, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, ErrIteration{cause: err}
+	}
+
+	return result, nil
+}
+
+// ReplayDelivery makes dead delivery of subscription pending again with fresh attempts
+func (r *sqlRepository) ReplayDelivery(ctx context.Context, subscriptionID, deliveryID int, now time.Time) error {
+	return r.Transaction(ctx, TxOptions{}, func(ctx context.Context) error {
+		stmt, err := r.prepare(ctx, `SELECT status FROM webhook_deliveries WHERE id=? AND subscription_id=?`)
+		if err != nil {
+			return err
+		}
+
+		var status entity.DeliveryStatus
+
+		if err = stmt.QueryRowContext(ctx, deliveryID, subscriptionID).Scan(&status); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return entity.ErrDeliveryNotFound
+			}
+
+			return ErrQuerying{cause: err}
+		} else if status != entity.DeliveryDead {
+			return entity.ErrDeliveryNotDead
+		}
+
+		replayed, err := r.execAffected(ctx, `UPDATE webhook_deliveries SET status=?, attempts=0, next_attempt=?, last_error='', updated=? WHERE id=? AND status=?`,
+			string(entity.DeliveryPending), toMillis(now), toMillis(now), deliveryID, string(entity.DeliveryDead))
+		if err != nil {
+			return err
+		} else if !replayed {
+			return entity.ErrDeliveryNotDead
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,210 @@
+// Package tlsconfig builds server TLS configuration and reloads certificate when its files change
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+var versions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":         tls.NoClientCert,
+	"none":     tls.NoClientCert,
+	"optional": tls.VerifyClientCertIfGiven,
+	"require":  tls.RequireAndVerifyClientCert,
+}
+
+// New returns TLS configuration which serves certificate kept by reloader,
+// HTTP/2 is negotiated by http.Server
+func New(cfg app.TLSConfig, reloader *Reloader) (*tls.Config, error) {
+	minVersion, ok := versions[cfg.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS version: %s", cfg.MinVersion)
+	}
+
+	clientAuth, ok := clientAuthTypes[cfg.ClientAuth]
+	if !ok {
+		return nil, fmt.Errorf("unknown client auth: %s", cfg.ClientAuth)
+	}
+
+	result := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.GetCertificate,
+		ClientAuth:     clientAuth,
+	}
+
+	if len(cfg.CipherSuites) > 0 {
+		suites, err := cipherSuites(cfg.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+
+		result.CipherSuites = suites
+	}
+
+	if clientAuth != tls.NoClientCert {
+		pool, err := loadCAs(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		result.ClientCAs = pool
+	}
+
+	return result, nil
+}
+
+// cipherSuites maps names like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 to IDs,
+// only suites which Go considers secure are accepted and they apply to TLS 1.2 only
+func cipherSuites(names []string) ([]uint16, error) {
+	known := map[string]uint16{}
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite: %s", name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func loadCAs(file string) (*x509.CertPool, error) {
+	if file == "" {
+		return nil, fmt.Errorf("client CA file is required when client auth is enabled")
+	}
+
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+
+	return pool, nil
+}
+
+// Reloader keeps certificate loaded from files and replaces it once files are modified
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Reloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// lastModified returns newer modification time of certificate and key
+func (r *Reloader) lastModified() (time.Time, error) {
+	var latest time.Time
+
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("could not stat %s: %w", file, err)
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// reload loads key pair if files changed since last load and reports if certificate was replaced,
+// certificate in use is kept when new files can't be loaded
+func (r *Reloader) reload() (bool, error) {
+	modified, err := r.lastModified()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && modified.Equal(r.modified)
+	r.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("could not load certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modified = modified
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch checks files every interval until ctx is done
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, logger app.Logger) {
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				logger.Error(app.ContextWithError(ctx, err), "could not reload TLS certificate")
+			} else if reloaded {
+				logger.Info(ctx, "reloaded TLS certificate from %s", r.certFile)
+			}
+		}
+	}
+}
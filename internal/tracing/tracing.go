@@ -0,0 +1,116 @@
+// Package tracing configures OpenTelemetry and starts spans which are visible in logs
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/reactivex/rxgo/v2"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/strax84mb/go-travel-reactive"
+	defaultServiceName  = "go-travel-reactive"
+)
+
+// Setup installs W3C trace context propagator and tracer provider for tracing.exporter,
+// returned function flushes and stops the provider
+func Setup(ctx context.Context, cfg app.TracingConfig) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+
+	switch cfg.Exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %s", cfg.Exporter)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not create trace exporter: %w", err)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("could not create trace resource: %w", err)
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start starts span and adds its trace and span IDs to logging context
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+
+	if sc := span.SpanContext(); sc.IsValid() {
+		ctx = app.ContextWithValue(ctx, "traceId", sc.TraceID().String())
+		ctx = app.ContextWithValue(ctx, "spanId", sc.SpanID().String())
+	}
+
+	return ctx, span
+}
+
+// Fail records err on span and marks span as failed
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Pipeline returns function which wraps stages of named pipeline in spans
+func Pipeline(pipeline string) func(stage string, fn rxgo.Func) rxgo.Func {
+	return func(stage string, fn rxgo.Func) rxgo.Func {
+		return func(ctx context.Context, item interface{}) (interface{}, error) {
+			ctx, span := Start(ctx, pipeline+"/"+stage)
+			defer span.End()
+
+			result, err := fn(ctx, item)
+			if err != nil {
+				Fail(span, err)
+			}
+
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package web
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/mux"
+)
+
+// encodings are in order of preference when client accepts several with the same quality
+var encodings = []string{"br", "gzip"}
+
+var encoderPools = map[string]*sync.Pool{
+	"br": {New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression)
+	}},
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}},
+}
+
+type resettableEncoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+	Flush() error
+}
+
+// Compress encodes responses with brotli or gzip as negotiated from Accept-Encoding.
+// Bodies shorter than minBytes, event streams and responses which already have
+// Content-Encoding are written as they are.
+func Compress(minBytes int) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := acceptedEncoding(r.Header.Values("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				minBytes:       minBytes,
+			}
+			defer cw.Close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptedEncoding returns most preferred supported coding or empty string for identity
+func acceptedEncoding(accept []string) string {
+	best, bestQ := "", 0.0
+
+	for _, header := range accept {
+		for _, part := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+
+			q := 1.0
+
+			if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					continue
+				}
+
+				q = parsed
+			}
+
+			candidates := []string{name}
+			if name == "*" {
+				candidates = encodings
+			}
+
+			for _, c := range candidates {
+				if q > bestQ || (q == bestQ && q > 0 && preferred(c, best)) {
+					if _, ok := encoderPools[c]; ok {
+						best, bestQ = c, q
+					}
+				}
+			}
+		}
+	}
+
+	return best
+}
+
+func preferred(a, b string) bool {
+	for _, e := range encodings {
+		if e == a {
+			return true
+		} else if e == b {
+			return false
+		}
+	}
+
+	return false
+}
+
+// compressWriter buffers beginning of body until it knows whether compression pays off
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minBytes int
+	status   int
+	buf      []byte
+	decided  bool
+	enc      resettableEncoder
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.decided || c.status != 0 {
+		return
+	}
+
+	c.status = status
+
+	// informational and bodiless responses go out right away
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		c.decide()
+	}
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.decided {
+		c.buf = append(c.buf, b...)
+		if len(c.buf) >= c.minBytes {
+			if err := c.decide(); err != nil {
+				return 0, err
+			}
+		}
+
+		return len(b), nil
+	}
+
+	if c.enc != nil {
+		return c.enc.Write(b)
+	}
+
+	return c.ResponseWriter.Write(b)
+}
+
+// decide starts response, compressed when there is enough body and nothing else encoded it
+func (c *compressWriter) decide() error {
+	c.decided = true
+
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+
+	h := c.Header()
+	mediaType, _, _ := strings.Cut(h.Get("Content-Type"), ";")
+
+	encodable := h.Get("Content-Encoding") == "" && strings.TrimSpace(mediaType) != "text/event-stream" &&
+		(c.status >= http.StatusOK && c.status < http.StatusMultipleChoices || c.status == http.StatusNotModified)
+
+	// representation differs from uncompressed one so it needs its own tag, the tag doesn't depend
+	// on size of body so that 304 without body carries the same tag as 200
+	if tag := h.Get("ETag"); encodable && strings.HasSuffix(tag, `"`) {
+		h.Set("ETag", strings.TrimSuffix(tag, `"`)+"-"+c.encoding+`"`)
+	}
+
+	compress := encodable && len(c.buf) >= c.minBytes && len(c.buf) > 0 &&
+		c.status != http.StatusNoContent && c.status != http.StatusNotModified
+
+	if compress {
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+
+		c.enc = encoderPools[c.encoding].Get().(resettableEncoder)
+		c.enc.Reset(c.ResponseWriter)
+	}
+
+	c.ResponseWriter.WriteHeader(c.status)
+
+	buf := c.buf
+	c.buf = nil
+
+	if len(buf) == 0 {
+		return nil
+	}
+
+	_, err := c.Write(buf)
+
+	return err
+}
+
+// Flush sends buffered body, partly written responses can't be compressed in a different way later
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		_ = c.decide()
+	}
+
+	if c.enc != nil {
+		_ = c.enc.Flush()
+	}
+
+	_ = http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// Close finishes response after handler returns
+func (c *compressWriter) Close() {
+	if !c.decided {
+		if c.status == 0 && len(c.buf) == 0 {
+			// handler wrote nothing, leave default response to server
+			return
+		}
+
+		_ = c.decide()
+	}
+
+	if c.enc != nil {
+		_ = c.enc.Close()
+		c.enc.Reset(io.Discard)
+		encoderPools[c.encoding].Put(c.enc)
+		c.enc = nil
+	}
+}
+
+// Unwrap lets http.ResponseController reach underlying writer
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Hijack hands connection over as it is, e.g. for WebSocket upgrade
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(c.ResponseWriter).Hijack()
+	if err == nil {
+		c.decided = true
+	}
+
+	return conn, rw, err
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompressedETagRevalidates(t *testing.T) {
+	tests := map[string]struct {
+		payload    interface{}
+		compressed bool
+	}{
+		"large body": {payload: map[string]string{"name": strings.Repeat("Paris ", 100)}, compressed: true},
+		"small body": {payload: map[string]string{"name": "Paris"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := Compress(256)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				OkConditional(w, r, 3, tt.payload)
+			}))
+
+			ok := serve(handler, http.MethodGet, "/cities/1", map[string]string{"Accept-Encoding": "gzip"})
+			if ok.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", ok.Code)
+			}
+
+			tag := ok.Header().Get("ETag")
+			if !strings.HasPrefix(tag, `"3.`) || !strings.HasSuffix(tag, `-gzip"`) {
+				t.Fatalf("unexpected ETag %s", tag)
+			}
+
+			if compressed := ok.Header().Get("Content-Encoding") == "gzip"; compressed != tt.compressed {
+				t.Errorf("expected compressed to be %v", tt.compressed)
+			}
+
+			notModified := serve(handler, http.MethodGet, "/cities/1", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": tag})
+			if notModified.Code != http.StatusNotModified {
+				t.Fatalf("expected 304, got %d", notModified.Code)
+			}
+
+			if got := notModified.Header().Get("ETag"); got != tag {
+				t.Errorf("304 has ETag %s, 200 had %s", got, tag)
+			}
+
+			if notModified.Body.Len() != 0 {
+				t.Errorf("304 has body %q", notModified.Body.String())
+			}
+		})
+	}
+}
+
+func TestETagDependsOnEncoding(t *testing.T) {
+	payload := map[string]string{"name": strings.Repeat("Paris ", 100)}
+	handler := Compress(256)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		OkConditional(w, r, 3, payload)
+	}))
+
+	identity := serve(handler, http.MethodGet, "/cities/1", nil)
+	compressed := serve(handler, http.MethodGet, "/cities/1", map[string]string{"Accept-Encoding": "gzip"})
+
+	plain := identity.Header().Get("ETag")
+	if plain == compressed.Header().Get("ETag") || strings.Contains(plain, "-") {
+		t.Fatalf("expected different tags, got %s and %s", plain, compressed.Header().Get("ETag"))
+	}
+
+	reader, err := gzip.NewReader(compressed.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %s", err.Error())
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil || string(body) != identity.Body.String() {
+		t.Errorf("decompressed body differs from identity one: %v", err)
+	}
+
+	// If-None-Match uses weak comparison, so tag of other encoding is fresh as well
+	for _, headers := range []map[string]string{
+		{"If-None-Match": compressed.Header().Get("ETag")},
+		{"Accept-Encoding": "gzip", "If-None-Match": plain},
+	} {
+		if rec := serve(handler, http.MethodGet, "/cities/1", headers); rec.Code != http.StatusNotModified {
+			t.Errorf("%v: expected 304, got %d", headers, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+)
+
+var defaultCORSMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// CORS answers preflight requests for every route of router and adds CORS headers to responses.
+// It wraps router instead of being its middleware since mux rejects OPTIONS before middlewares run.
+type CORS struct {
+	router *mux.Router
+	cfg    atomic.Pointer[app.CORSConfig]
+}
+
+func NewCORS(cfg app.CORSConfig, router *mux.Router) *CORS {
+	c := &CORS{router: router}
+	c.SetConfig(cfg)
+
+	return c
+}
+
+// SetConfig replaces allowed origins, methods and headers for subsequent requests
+func (c *CORS) SetConfig(cfg app.CORSConfig) {
+	if len(cfg.AllowedMethods) == 0 {
+		cfg.AllowedMethods = defaultCORSMethods
+	}
+
+	c.cfg.Store(&cfg)
+}
+
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := c.cfg.Load()
+		origin := r.Header.Get("Origin")
+
+		w.Header().Add("Vary", "Origin")
+
+		if origin == "" || !originAllowed(cfg.AllowedOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			c.preflight(w, r, cfg, origin)
+			return
+		}
+
+		setAllowOrigin(w, cfg, origin)
+
+		if len(cfg.ExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// OriginAllowed accepts requests without Origin, same-origin requests and allowed origins,
+// it is meant for requests which CORS doesn't cover like WebSocket upgrades
+func (c *CORS) OriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	return originAllowed(c.cfg.Load().AllowedOrigins, origin)
+}
+
+// preflight allows requested method only if some route serves it on requested path,
+// response without Access-Control-Allow-Origin makes browser block the request
+func (c *CORS) preflight(w http.ResponseWriter, r *http.Request, cfg *app.CORSConfig, origin string) {
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	methods := c.routeMethods(r, cfg.AllowedMethods)
+	if len(methods) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	requested := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !contains(methods, requested) || !headersAllowed(cfg.AllowedHeaders, r.Header.Get("Access-Control-Request-Headers")) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	setAllowOrigin(w, cfg, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+	if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+	}
+
+	if cfg.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// routeMethods returns methods out of allowed which have a route matching request path
+func (c *CORS) routeMethods(r *http.Request, allowed []string) []string {
+	var methods []string
+
+	for _, method := range allowed {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+
+		var match mux.RouteMatch
+		if c.router.Match(probe, &match) && match.MatchErr == nil {
+			methods = append(methods, method)
+		}
+	}
+
+	return methods
+}
+
+func setAllowOrigin(w http.ResponseWriter, cfg *app.CORSConfig, origin string) {
+	// credentials can't be combined with wildcard origin
+	if contains(cfg.AllowedOrigins, "*") && !cfg.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if cfg.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// originAllowed matches origin against patterns like https://app.example.com,
+// https://*.example.com or *, comparison ignores case
+func originAllowed(patterns []string, origin string) bool {
+	origin = strings.ToLower(origin)
+
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+
+		prefix, suffix, wildcard := strings.Cut(p, "*")
+		if !wildcard {
+			if p == origin {
+				return true
+			}
+
+			continue
+		}
+
+		if len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headersAllowed checks comma separated list of requested headers, * allows any header
+func headersAllowed(allowed []string, requested string) bool {
+	if contains(allowed, "*") {
+		return true
+	}
+
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+
+		found := false
+
+		for _, a := range allowed {
+			if strings.EqualFold(a, h) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,118 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+)
+
+func newTestCORS() http.Handler {
+	r := mux.NewRouter()
+	r.Methods(http.MethodGet, http.MethodPut).Path("/cities/{id}").Handler(okHandler)
+
+	cors := NewCORS(app.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.travel.example"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"ETag"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}, r)
+
+	return cors.Handler(r)
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	for _, origin := range []string{"https://app.example.com", "https://eu.travel.example"} {
+		rec := serve(newTestCORS(), http.MethodGet, "/cities/1", map[string]string{"Origin": origin})
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", origin, rec.Code)
+		}
+
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("%s: unexpected Access-Control-Allow-Origin %q", origin, got)
+		}
+
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("%s: unexpected Access-Control-Allow-Credentials %q", origin, got)
+		}
+
+		if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "ETag" {
+			t.Errorf("%s: unexpected Access-Control-Expose-Headers %q", origin, got)
+		}
+	}
+}
+
+func TestCORSDeniedOrigin(t *testing.T) {
+	for _, origin := range []string{"https://evil.example.com", "https://travel.example.evil.com"} {
+		rec := serve(newTestCORS(), http.MethodGet, "/cities/1", map[string]string{"Origin": origin})
+
+		// request is served, browser blocks the response without CORS headers
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", origin, rec.Code)
+		}
+
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("%s: expected no Access-Control-Allow-Origin, got %q", origin, got)
+		}
+
+		if got := rec.Header().Get("Vary"); got != "Origin" {
+			t.Errorf("%s: expected Vary: Origin, got %q", origin, got)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+		allowed bool
+	}{
+		{name: "allowed", origin: "https://app.example.com", method: http.MethodPut, headers: "authorization, content-type", allowed: true},
+		{name: "denied origin", origin: "https://evil.example.com", method: http.MethodPut},
+		{name: "method without route", origin: "https://app.example.com", method: http.MethodDelete},
+		{name: "header not allowed", origin: "https://app.example.com", method: http.MethodPut, headers: "X-Custom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{"Origin": tt.origin, "Access-Control-Request-Method": tt.method}
+			if tt.headers != "" {
+				headers["Access-Control-Request-Headers"] = tt.headers
+			}
+
+			rec := serve(newTestCORS(), http.MethodOptions, "/cities/1", headers)
+			allowOrigin := rec.Header().Get("Access-Control-Allow-Origin")
+
+			if !tt.allowed {
+				if allowOrigin != "" {
+					t.Errorf("expected preflight to be denied, got Access-Control-Allow-Origin %q", allowOrigin)
+				}
+
+				return
+			}
+
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("expected 204, got %d", rec.Code)
+			}
+
+			expected := map[string]string{
+				"Access-Control-Allow-Origin":  tt.origin,
+				"Access-Control-Allow-Methods": "GET, PUT",
+				"Access-Control-Allow-Headers": tt.headers,
+				"Access-Control-Max-Age":       "600",
+			}
+
+			for name, value := range expected {
+				if got := rec.Header().Get(name); got != value {
+					t.Errorf("expected %s %q, got %q", name, value, got)
+				}
+			}
+		})
+	}
+}
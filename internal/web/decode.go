@@ -0,0 +1,215 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+const DefaultMaxBodyBytes int64 = 1 << 20
+
+const ctxMaxBodyIdx ctxKey = ctxRequestIDIdx + 1
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// field errors are reported by JSON names
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			return ""
+		}
+
+		if name == "" {
+			return field.Name
+		}
+
+		return name
+	})
+
+	return v
+}
+
+// MaxBodySize sets limit used by DecodeJSON, requests without it are limited to DefaultMaxBodyBytes
+func MaxBodySize(maxBytes int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxBytes > 0 {
+				r = r.WithContext(context.WithValue(r.Context(), ctxMaxBodyIdx, maxBytes))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ErrDecoding describes why request body was rejected, it is written by WriteDecodingError
+type ErrDecoding struct {
+	status  int
+	message string
+	details map[string][]string
+}
+
+func (e ErrDecoding) Error() string {
+	return e.message
+}
+
+func (e ErrDecoding) Status() int {
+	return e.status
+}
+
+func (e ErrDecoding) Details() map[string][]string {
+	return e.details
+}
+
+func badPayload(message string, details map[string][]string) ErrDecoding {
+	return ErrDecoding{
+		status:  http.StatusBadRequest,
+		message: message,
+		details: details,
+	}
+}
+
+// DecodeJSON reads JSON object into dst and runs its validate tags.
+// Body must be application/json, fit into size limit, contain only fields known to dst
+// and nothing after the object. Returned error is ErrDecoding.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return ErrDecoding{
+			status:  http.StatusUnsupportedMediaType,
+			message: "content type must be application/json",
+		}
+	}
+
+	maxBytes, ok := r.Context().Value(ctxMaxBodyIdx).(int64)
+	if !ok {
+		maxBytes = DefaultMaxBodyBytes
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxBytes)
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	if err = dec.Decode(dst); err != nil {
+		return decodingError(err)
+	}
+
+	if err = dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return decodingError(err)
+		}
+
+		return badPayload("incorrect payload", map[string][]string{
+			"body": {"must contain single JSON object"},
+		})
+	}
+
+	if err = validate.Struct(dst); err != nil {
+		var invalid validator.ValidationErrors
+		if !errors.As(err, &invalid) {
+			return badPayload("incorrect payload", nil)
+		}
+
+		details := map[string][]string{}
+
+		for _, fe := range invalid {
+			field := strings.SplitN(fe.Namespace(), ".", 2)
+			name := field[len(field)-1]
+			details[name] = append(details[name], validationMessage(fe))
+		}
+
+		return badPayload("validation failed", details)
+	}
+
+	return nil
+}
+
+func decodingError(err error) ErrDecoding {
+	var (
+		tooLarge  *http.MaxBytesError
+		syntax    *json.SyntaxError
+		wrongType *json.UnmarshalTypeError
+	)
+
+	switch {
+	case errors.As(err, &tooLarge):
+		return ErrDecoding{
+			status:  http.StatusRequestEntityTooLarge,
+			message: fmt.Sprintf("payload must not be larger than %d bytes", tooLarge.Limit),
+		}
+	case errors.Is(err, io.EOF):
+		return badPayload("payload needed", nil)
+	case errors.As(err, &syntax), errors.Is(err, io.ErrUnexpectedEOF):
+		return badPayload("malformed JSON", map[string][]string{
+			"body": {err.Error()},
+		})
+	case errors.As(err, &wrongType):
+		field := wrongType.Field
+		if field == "" {
+			field = "body"
+		}
+
+		return badPayload("incorrect payload", map[string][]string{
+			field: {"must be " + wrongType.Type.String()},
+		})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no type for this error
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+
+		return badPayload("incorrect payload", map[string][]string{
+			field: {"unknown field"},
+		})
+	default:
+		return badPayload("incorrect payload", map[string][]string{
+			"body": {err.Error()},
+		})
+	}
+}
+
+func validationMessage(fe validator.FieldError) string {
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return "must be at least " + fe.Param() + unit
+	case "max":
+		return "must be at most " + fe.Param() + unit
+	case "oneof":
+		return "must be one of " + fe.Param()
+	case "email":
+		return "must be email address"
+	default:
+		return "failed " + fe.Tag() + " validation"
+	}
+}
+
+// WriteDecodingError responds with status of ErrDecoding, other errors are bad requests
+func WriteDecodingError(w http.ResponseWriter, err error) {
+	var decoding ErrDecoding
+	if !errors.As(err, &decoding) {
+		BadRequest(w, err.Error(), nil)
+		return
+	}
+
+	writeError(w, decoding.status, decoding.message, decoding.details)
+}
@@ -0,0 +1,137 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type decodeInput struct {
+	Name  string `json:"name" validate:"required,max=5"`
+	Count int    `json:"count" validate:"min=1"`
+	Role  string `json:"role,omitempty" validate:"omitempty,oneof=user admin"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		maxBytes    int64
+		status      int
+		message     string
+		details     map[string][]string
+	}{
+		{name: "valid", contentType: "application/json", body: `{"name":"Novi","count":2}`},
+		{name: "vendor json", contentType: "application/vnd.api+json; charset=utf-8", body: `{"name":"Novi","count":2}`},
+		{
+			name: "missing content type", body: `{"name":"Novi","count":2}`,
+			status: http.StatusUnsupportedMediaType, message: "content type must be application/json",
+		},
+		{
+			name: "wrong content type", contentType: "text/plain", body: `{"name":"Novi","count":2}`,
+			status: http.StatusUnsupportedMediaType, message: "content type must be application/json",
+		},
+		{
+			name: "unknown field", contentType: "application/json", body: `{"name":"Novi","count":2,"admin":true}`,
+			status: http.StatusBadRequest, message: "incorrect payload",
+			details: map[string][]string{"admin": {"unknown field"}},
+		},
+		{
+			name: "trailing object", contentType: "application/json", body: `{"name":"Novi","count":2}{"name":"Sad"}`,
+			status: http.StatusBadRequest, message: "incorrect payload",
+			details: map[string][]string{"body": {"must contain single JSON object"}},
+		},
+		{
+			name: "trailing garbage", contentType: "application/json", body: `{"name":"Novi","count":2} x`,
+			status: http.StatusBadRequest, message: "incorrect payload",
+			details: map[string][]string{"body": {"must contain single JSON object"}},
+		},
+		{name: "trailing whitespace", contentType: "application/json", body: "{\"name\":\"Novi\",\"count\":2}\n\t "},
+		{
+			name: "too large", contentType: "application/json", body: `{"name":"Novi","count":2}`, maxBytes: 10,
+			status: http.StatusRequestEntityTooLarge, message: "payload must not be larger than 10 bytes",
+		},
+		{
+			name: "too large after object", contentType: "application/json", body: `{"name":"Novi","count":2}` + strings.Repeat(" ", 20) + "x", maxBytes: 30,
+			status: http.StatusRequestEntityTooLarge, message: "payload must not be larger than 30 bytes",
+		},
+		{
+			name: "empty", contentType: "application/json",
+			status: http.StatusBadRequest, message: "payload needed",
+		},
+		{
+			name: "wrong type", contentType: "application/json", body: `{"name":"Novi","count":"2"}`,
+			status: http.StatusBadRequest, message: "incorrect payload",
+			details: map[string][]string{"count": {"must be int"}},
+		},
+		{
+			name: "validation", contentType: "application/json", body: `{"name":"Belgrade","count":0,"role":"root"}`,
+			status: http.StatusBadRequest, message: "validation failed",
+			details: map[string][]string{
+				"name":  {"must be at most 5 characters"},
+				"count": {"must be at least 1"},
+				"role":  {"must be one of user admin"},
+			},
+		},
+		{
+			name: "required", contentType: "application/json", body: `{"count":1}`,
+			status: http.StatusBadRequest, message: "validation failed",
+			details: map[string][]string{"name": {"is required"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var input decodeInput
+				if err := DecodeJSON(w, r, &input); err != nil {
+					WriteDecodingError(w, err)
+					return
+				}
+
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			if tt.maxBytes > 0 {
+				handler = MaxBodySize(tt.maxBytes)(handler)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/city", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if tt.status == 0 {
+				if rec.Code != http.StatusNoContent {
+					t.Fatalf("expected payload to be accepted, got %d: %s", rec.Code, rec.Body.String())
+				}
+
+				return
+			}
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid error body: %s", err.Error())
+			}
+
+			if resp.Message != tt.message {
+				t.Errorf("expected message %q, got %q", tt.message, resp.Message)
+			}
+
+			if !reflect.DeepEqual(resp.Details, tt.details) {
+				t.Errorf("expected details %v, got %v", tt.details, resp.Details)
+			}
+		})
+	}
+}
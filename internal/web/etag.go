@@ -0,0 +1,104 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETag is strong entity tag of encoded body, non-zero version of stored row is put in front of
+// content hash so that If-Match can be checked against storage while hash still changes
+// with parts of response which are not versioned, e.g. comments of city
+func ETag(version int, body []byte) string {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:8])
+
+	if version == 0 {
+		return `"` + hash + `"`
+	}
+
+	return `"` + strconv.Itoa(version) + "." + hash + `"`
+}
+
+// OkConditional responds with payload in negotiated format and its ETag,
+// or with 304 when If-None-Match lists the same tag
+func OkConditional(w http.ResponseWriter, r *http.Request, version int, payload interface{}) {
+	contentType, body, ok := negotiateBody(w, r, payload)
+	if !ok {
+		return
+	}
+
+	tag := ETag(version, body)
+	w.Header().Set("ETag", tag)
+
+	if noneMatch := r.Header.Get("If-None-Match"); noneMatch != "" && tagListed(noneMatch, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+// tagListed uses weak comparison required for If-None-Match, tags of compressed representations
+// made by Compress match uncompressed one
+func tagListed(list, tag string) bool {
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || weakTag(t) == weakTag(tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func weakTag(tag string) string {
+	tag = strings.TrimPrefix(tag, "W/")
+
+	for _, encoding := range encodings {
+		if trimmed, ok := strings.CutSuffix(tag, "-"+encoding+`"`); ok {
+			return trimmed + `"`
+		}
+	}
+
+	return tag
+}
+
+// IfMatchVersion returns row version from If-Match tags made by ETag, zero when header is missing
+// or *. Result is false when header can't be satisfied: weak tags, tags without version
+// or tags naming different versions.
+func IfMatchVersion(r *http.Request) (int, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+
+	version := 0
+
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+
+		// If-Match uses strong comparison
+		if strings.HasPrefix(t, "W/") || len(t) < 2 || !strings.HasPrefix(t, `"`) || !strings.HasSuffix(t, `"`) {
+			return 0, false
+		}
+
+		prefix, _, ok := strings.Cut(strings.Trim(t, `"`), ".")
+		if !ok {
+			return 0, false
+		}
+
+		v, err := strconv.Atoi(prefix)
+		if err != nil || v <= 0 || (version != 0 && v != version) {
+			return 0, false
+		}
+
+		version = v
+	}
+
+	return version, true
+}
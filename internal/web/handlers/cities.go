@@ -1,14 +1,392 @@
 package handlers
 
-import "github.com/gorilla/mux"
-
-func RegisterCitiesHandlers(r *mux.Router) {
-	/*
-		router.GET("/city", h.GetAllCities)
-		router.POST("/city", h.AddCity)
-		router.GET("/city/:id", h.GetCity)
-		router.PUT("/city/:id", h.UpdateCity)
-		router.DELETE("/city/:id", h.DeleteCity)
-		router.POST("/city/import", h.ImportCities)
-	*/
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/services/cities"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
+)
+
+const defaultNumberOfComments = 5
+
+type cityService interface {
+	GetCity(ctx context.Context, id, numberOfComments int) (cities.CityDto, error)
+	ListAllCities(ctx context.Context, numberOfComments int) ([]cities.CityDto, error)
+	StreamCities(ctx context.Context, numberOfComments int, fn func(city cities.CityDto) error) error
+	AddCity(ctx context.Context, name, country string) (int, error)
+	UpdateCity(ctx context.Context, id, version int, name, country string) error
+	DeleteCity(ctx context.Context, id, version int) error
+}
+
+// RegisterCitiesHandlers adds city routes, changes are allowed to admins only.
+// Cities are returned in shape of version r, versions after v2 keep shape of v2.
+func RegisterCitiesHandlers(r *web.Version, service cityService, auth authService) {
+	shape, ok := cityShapes[r.Name]
+	if !ok {
+		shape = cityShapes["v2"]
+	}
+
+	r.Methods(http.MethodGet).Path("/city").Name(r.RouteName("listCities")).HandlerFunc(listCities(service, shape))
+	r.Methods(http.MethodPost).Path("/city").Name(r.RouteName("addCity")).HandlerFunc(addCity(service, auth))
+	r.Methods(http.MethodGet).Path("/city/{id:[0-9]+}").Name(r.RouteName("getCity")).HandlerFunc(getCity(service, shape))
+	r.Methods(http.MethodPut).Path("/city/{id:[0-9]+}").Name(r.RouteName("updateCity")).HandlerFunc(updateCity(service, auth))
+	r.Methods(http.MethodDelete).Path("/city/{id:[0-9]+}").Name(r.RouteName("deleteCity")).HandlerFunc(deleteCity(service, auth))
+}
+
+var commentsParameter = openapi.Parameter{
+	Name:        "comments",
+	Description: "Number of latest comments per city, defaults to 5",
+	Example:     defaultNumberOfComments,
+}
+
+var (
+	ifNoneMatchHeader = openapi.Parameter{
+		Name:        "If-None-Match",
+		Description: "ETag of cached response, 304 is returned when it is still current",
+		Example:     "",
+	}
+	ifMatchHeader = openapi.Parameter{
+		Name:        "If-Match",
+		Description: "ETag returned by getCity, change is rejected with 412 when city was changed since, updateCity requires it",
+		Example:     "",
+	}
+)
+
+var cityOperations = openapi.Operations{
+	"listCities": {
+		Summary: "List cities with latest comments",
+		Tags:    []string{"cities"},
+		Query:   []openapi.Parameter{commentsParameter},
+		Headers: []openapi.Parameter{ifNoneMatchHeader},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {
+				Description: "Cities, streamed one by one for Accept: application/x-ndjson or application/json; stream=true",
+				Body:        []cities.CityDto{},
+			},
+			http.StatusNotModified: {Description: "List did not change"},
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"addCity": {
+		Summary: "Add city",
+		Tags:    []string{"cities"},
+		Request: cityInput{},
+		Responses: map[int]openapi.Response{
+			http.StatusCreated: {Body: idOutput{}},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+		Secured: true,
+	},
+	"getCity": {
+		Summary: "Get city with latest comments",
+		Tags:    []string{"cities"},
+		Query:   []openapi.Parameter{commentsParameter},
+		Headers: []openapi.Parameter{ifNoneMatchHeader},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:          {Body: cities.CityDto{}},
+			http.StatusNotModified: {Description: "City did not change"},
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"updateCity": {
+		Summary: "Update city",
+		Tags:    []string{"cities"},
+		Headers: []openapi.Parameter{ifMatchHeader},
+		Request: cityInput{},
+		Responses: map[int]openapi.Response{
+			http.StatusNoContent: {Description: "City updated"},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusPreconditionRequired, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+		Secured: true,
+	},
+	"deleteCity": {
+		Summary: "Delete city",
+		Tags:    []string{"cities"},
+		Headers: []openapi.Parameter{ifMatchHeader},
+		Responses: map[int]openapi.Response{
+			http.StatusNoContent: {Description: "City deleted"},
+		},
+		Errors:  []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusInternalServerError},
+		Secured: true,
+	},
+}
+
+// v2 operations differ from ones for every version only by city shape
+var cityV2Operations = openapi.Operations{
+	"v2.listCities": withBody(cityOperations["listCities"], http.StatusOK, []cityV2{}),
+	"v2.getCity":    withBody(cityOperations["getCity"], http.StatusOK, cityV2{}),
+}
+
+func withBody(op openapi.Operation, status int, body interface{}) openapi.Operation {
+	responses := make(map[int]openapi.Response, len(op.Responses))
+	for code, response := range op.Responses {
+		responses[code] = response
+	}
+
+	response := responses[status]
+	response.Body = body
+	responses[status] = response
+	op.Responses = responses
+
+	return op
+}
+
+// cityV2 nests poster of comments, v1 shape is cities.CityDto
+type cityV2 struct {
+	ID       int         `json:"id"`
+	Name     string      `json:"name"`
+	Country  string      `json:"country"`
+	Comments []commentV2 `json:"comments"`
+}
+
+type commentV2 struct {
+	ID       int      `json:"id"`
+	Poster   posterV2 `json:"poster"`
+	Text     string   `json:"text"`
+	Created  string   `json:"created"`
+	Modified string   `json:"modified"`
+}
+
+type posterV2 struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+func toCityV2(city cities.CityDto) cityV2 {
+	result := cityV2{
+		ID:       city.ID,
+		Name:     city.Name,
+		Country:  city.Country,
+		Comments: make([]commentV2, len(city.Comments)),
+	}
+
+	for i, c := range city.Comments {
+		result.Comments[i] = commentV2{
+			ID:       c.ID,
+			Poster:   posterV2{ID: c.PosterID, Username: c.Poster},
+			Text:     c.Text,
+			Created:  c.Created,
+			Modified: c.Modified,
+		}
+	}
+
+	return result
+}
+
+// cityShape converts cities of service to response bodies of one API version,
+// lists keep element type so that they can be written as CSV
+type cityShape struct {
+	one  func(city cities.CityDto) interface{}
+	list func(list []cities.CityDto) interface{}
+}
+
+func newCityShape[T any](convert func(city cities.CityDto) T) cityShape {
+	return cityShape{
+		one: func(city cities.CityDto) interface{} {
+			return convert(city)
+		},
+		list: func(list []cities.CityDto) interface{} {
+			result := make([]T, len(list))
+			for i, city := range list {
+				result[i] = convert(city)
+			}
+
+			return result
+		},
+	}
+}
+
+var cityShapes = map[string]cityShape{
+	"v1": newCityShape(func(city cities.CityDto) cities.CityDto { return city }),
+	"v2": newCityShape(toCityV2),
+}
+
+type cityInput struct {
+	Name    string `json:"name" validate:"required,max=100"`
+	Country string `json:"country" validate:"required,max=100"`
+}
+
+// numberOfComments reads comments query parameter, it defaults to 5
+func numberOfComments(r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("comments")
+	if value == "" {
+		return defaultNumberOfComments, true
+	}
+
+	n, err := strconv.Atoi(value)
+
+	return n, err == nil && n >= 0
+}
+
+func cityID(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	return id, err == nil
+}
+
+// writeCityError maps service errors to statuses
+func writeCityError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, entity.ErrCityNotFound):
+		web.NotFound(w, entity.ErrCityNotFound.Error())
+	case errors.Is(err, entity.ErrCityExists):
+		web.Conflict(w, entity.ErrCityExists.Error())
+	case errors.Is(err, entity.ErrCityChanged):
+		web.PreconditionFailed(w, entity.ErrCityChanged.Error())
+	default:
+		web.InternalServerError(w, message, map[string][]string{
+			"error": {err.Error()},
+		})
+	}
+}
+
+func listCities(service cityService, shape cityShape) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n, ok := numberOfComments(r)
+		if !ok {
+			web.BadRequest(w, "comments must be non-negative number", nil)
+			return
+		}
+
+		if stream, ok := web.NewStreamWriter(w, r); ok {
+			err := service.StreamCities(r.Context(), n, func(city cities.CityDto) error {
+				return stream.Write(shape.one(city))
+			})
+			if err != nil && !stream.Started() {
+				writeCityError(w, "could not list cities", err)
+				return
+			}
+
+			stream.Close(err)
+
+			return
+		}
+
+		list, err := service.ListAllCities(r.Context(), n)
+		if err != nil {
+			writeCityError(w, "could not list cities", err)
+			return
+		}
+
+		web.OkConditional(w, r, 0, shape.list(list))
+	}
+}
+
+func getCity(service cityService, shape cityShape) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := cityID(r)
+		if !ok {
+			web.BadRequest(w, "incorrect city ID", nil)
+			return
+		}
+
+		n, ok := numberOfComments(r)
+		if !ok {
+			web.BadRequest(w, "comments must be non-negative number", nil)
+			return
+		}
+
+		city, err := service.GetCity(r.Context(), id, n)
+		if err != nil {
+			writeCityError(w, "could not get city", err)
+			return
+		}
+
+		web.OkConditional(w, r, city.Version, shape.one(city))
+	}
+}
+
+func addCity(service cityService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AdminUserRole) {
+			return
+		}
+
+		var payload cityInput
+
+		if err := web.DecodeJSON(w, r, &payload); err != nil {
+			web.WriteDecodingError(w, err)
+			return
+		}
+
+		id, err := service.AddCity(r.Context(), payload.Name, payload.Country)
+		if err != nil {
+			writeCityError(w, "could not add city", err)
+			return
+		}
+
+		web.Created(w, r, idOutput{ID: id})
+	}
+}
+
+func updateCity(service cityService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AdminUserRole) {
+			return
+		}
+
+		id, ok := cityID(r)
+		if !ok {
+			web.BadRequest(w, "incorrect city ID", nil)
+			return
+		}
+
+		// updates made without reading city first would overwrite changes of others
+		if r.Header.Get("If-Match") == "" {
+			web.PreconditionRequired(w, "If-Match header is required")
+			return
+		}
+
+		version, ok := web.IfMatchVersion(r)
+		if !ok {
+			web.PreconditionFailed(w, entity.ErrCityChanged.Error())
+			return
+		}
+
+		var payload cityInput
+
+		if err := web.DecodeJSON(w, r, &payload); err != nil {
+			web.WriteDecodingError(w, err)
+			return
+		}
+
+		if err := service.UpdateCity(r.Context(), id, version, payload.Name, payload.Country); err != nil {
+			writeCityError(w, "could not update city", err)
+			return
+		}
+
+		web.NoContent(w)
+	}
+}
+
+func deleteCity(service cityService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AdminUserRole) {
+			return
+		}
+
+		id, ok := cityID(r)
+		if !ok {
+			web.BadRequest(w, "incorrect city ID", nil)
+			return
+		}
+
+		version, ok := web.IfMatchVersion(r)
+		if !ok {
+			web.PreconditionFailed(w, entity.ErrCityChanged.Error())
+			return
+		}
+
+		if err := service.DeleteCity(r.Context(), id, version); err != nil {
+			writeCityError(w, "could not delete city", err)
+			return
+		}
+
+		web.NoContent(w)
+	}
 }
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/services/cities"
+	"github.com/strax84mb/go-travel-reactive/internal/storage"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+)
+
+// admins accepts every request as admin
+type admins struct{}
+
+func (admins) ValidateJwt(context.Context, *http.Request, entity.UserRole) (string, error) {
+	return "admin", nil
+}
+
+func (admins) Login(context.Context, string, string) (string, error) {
+	return "", nil
+}
+
+func (admins) SaveUser(context.Context, string, string) (int, error) {
+	return 0, nil
+}
+
+func newCityRouter(t *testing.T) http.Handler {
+	t.Helper()
+
+	cfg := app.DefaultConfig()
+	cfg.API.DbDriver = storage.DriverMemory
+
+	repo, err := storage.NewRepository(context.Background(), &cfg)
+	if err != nil {
+		t.Fatalf("could not open repository: %s", err.Error())
+	}
+
+	t.Cleanup(func() { _ = repo.Close() })
+
+	bus := events.NewBus(8)
+	t.Cleanup(bus.Close)
+
+	logger := app.NewLogger(app.ErrorSeverity, app.NewMemorySink())
+
+	r := mux.NewRouter()
+	RegisterCitiesHandlers(web.NewVersions(r, "/api", cfg.API.Versions).Register("v1"), cities.NewCityService(repo, logger, bus, false), admins{})
+
+	return r
+}
+
+func cityRequest(method, ifMatch, ifNoneMatch string) *http.Request {
+	var r *http.Request
+	if method == http.MethodPut {
+		r = httptest.NewRequest(method, "/api/v1/city/1", strings.NewReader(`{"name":"Novi Sad","country":"Serbia"}`))
+		r.Header.Set("Content-Type", "application/json")
+	} else {
+		r = httptest.NewRequest(method, "/api/v1/city/1", nil)
+	}
+
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+
+	if ifNoneMatch != "" {
+		r.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
+	return r
+}
+
+func TestCityConditionalRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		ifMatch     func(etag string) string
+		ifNoneMatch func(etag string) string
+		status      int
+	}{
+		{name: "get", method: http.MethodGet, status: http.StatusOK},
+		{name: "get not modified", method: http.MethodGet, ifNoneMatch: func(etag string) string { return etag }, status: http.StatusNotModified},
+		{name: "get weak not modified", method: http.MethodGet, ifNoneMatch: func(etag string) string { return "W/" + etag }, status: http.StatusNotModified},
+		{name: "get other tag", method: http.MethodGet, ifNoneMatch: func(string) string { return `"1.0000"` }, status: http.StatusOK},
+		{name: "put matching", method: http.MethodPut, ifMatch: func(etag string) string { return etag }, status: http.StatusNoContent},
+		{name: "put stale", method: http.MethodPut, ifMatch: func(string) string { return `"7.0000"` }, status: http.StatusPreconditionFailed},
+		{name: "put weak", method: http.MethodPut, ifMatch: func(etag string) string { return "W/" + etag }, status: http.StatusPreconditionFailed},
+		{name: "put missing", method: http.MethodPut, status: http.StatusPreconditionRequired},
+		{name: "put any", method: http.MethodPut, ifMatch: func(string) string { return "*" }, status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newCityRouter(t)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, cityRequest(http.MethodGet, "", ""))
+
+			etag := rec.Header().Get("ETag")
+			if rec.Code != http.StatusOK || etag == "" {
+				t.Fatalf("expected city with ETag, got %d: %s", rec.Code, rec.Body.String())
+			}
+
+			var ifMatch, ifNoneMatch string
+			if tt.ifMatch != nil {
+				ifMatch = tt.ifMatch(etag)
+			}
+
+			if tt.ifNoneMatch != nil {
+				ifNoneMatch = tt.ifNoneMatch(etag)
+			}
+
+			rec = httptest.NewRecorder()
+			router.ServeHTTP(rec, cityRequest(tt.method, ifMatch, ifNoneMatch))
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+
+			if tt.status == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("304 has body %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCityUpdateWithOldETagFails(t *testing.T) {
+	router := newCityRouter(t)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, cityRequest(http.MethodGet, "", ""))
+	etag := rec.Header().Get("ETag")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, cityRequest(http.MethodPut, etag, ""))
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("first update failed with %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, cityRequest(http.MethodPut, etag, ""))
+
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected lost update to be rejected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, cityRequest(http.MethodGet, "", etag))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("expected changed city with new ETag, got %d %s", rec.Code, rec.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/services/cities"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
+)
+
+// maxCitySubscriptions limits cities one connection follows
+const maxCitySubscriptions = 100
+
+type commentService interface {
+	AddComment(ctx context.Context, cityID int, username, text string) (int, error)
+	EditComment(ctx context.Context, id int, username, text string) error
+	DeleteComment(ctx context.Context, id int, username string) error
+}
+
+// RegisterCommentHandlers adds comment routes and WebSocket feed of comments of subscribed cities,
+// protocol is described in docs/websocket.md. Signed in users post comments and change their own ones,
+// admins may delete any comment. checkOrigin decides on connections from browsers on other origins.
+func RegisterCommentHandlers(r *web.Version, service commentService, bus eventBus, auth authService, cfg app.WebSocketConfig, checkOrigin func(r *http.Request) bool) {
+	r.Methods(http.MethodPost).Path("/city/{id:[0-9]+}/comment").Name(r.RouteName("addComment")).HandlerFunc(addComment(service, auth))
+	r.Methods(http.MethodPut).Path("/comment/{id:[0-9]+}").Name(r.RouteName("editComment")).HandlerFunc(editComment(service, auth))
+	r.Methods(http.MethodDelete).Path("/comment/{id:[0-9]+}").Name(r.RouteName("deleteComment")).HandlerFunc(deleteComment(service, auth))
+	r.Methods(http.MethodGet).Path("/comments/live").Name(r.RouteName("liveComments")).HandlerFunc(liveComments(bus, auth, cfg, checkOrigin))
+}
+
+var commentOperations = openapi.Operations{
+	"addComment": {
+		Summary: "Post comment to city",
+		Tags:    []string{"comments"},
+		Request: commentInput{},
+		Responses: map[int]openapi.Response{
+			http.StatusCreated: {Body: idOutput{}},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+		Secured: true,
+	},
+	"editComment": {
+		Summary: "Change text of own comment",
+		Tags:    []string{"comments"},
+		Request: commentInput{},
+		Responses: map[int]openapi.Response{
+			http.StatusNoContent: {Description: "Comment changed"},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+		Secured: true,
+	},
+	"deleteComment": {
+		Summary: "Delete own comment, admins may delete any comment",
+		Tags:    []string{"comments"},
+		Responses: map[int]openapi.Response{
+			http.StatusNoContent: {Description: "Comment deleted"},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+		Secured: true,
+	},
+	"liveComments": {
+		Summary: "WebSocket feed of created, edited and deleted comments of subscribed cities, see docs/websocket.md",
+		Tags:    []string{"comments"},
+		Query: []openapi.Parameter{{
+			Name:        "access_token",
+			Description: "Token for browsers which can't set Authorization header on WebSocket requests",
+			Example:     "",
+		}},
+		Responses: map[int]openapi.Response{
+			http.StatusSwitchingProtocols: {Description: "Connection switched to WebSocket"},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+		Secured: true,
+	},
+}
+
+type commentInput struct {
+	Text string `json:"text" validate:"required,max=255"`
+}
+
+func commentID(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	return id, err == nil
+}
+
+// writeCommentError maps service errors to statuses
+func writeCommentError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, entity.ErrCityNotFound):
+		web.NotFound(w, entity.ErrCityNotFound.Error())
+	case errors.Is(err, entity.ErrCommentNotFound):
+		web.NotFound(w, entity.ErrCommentNotFound.Error())
+	case errors.Is(err, entity.ErrNotCommentPoster):
+		web.Forbidden(w, entity.ErrNotCommentPoster.Error())
+	case errors.Is(err, entity.ErrUsernameNotFound):
+		web.Unauthorized(w, "valid token is required")
+	default:
+		web.InternalServerError(w, message, map[string][]string{
+			"error": {err.Error()},
+		})
+	}
+}
+
+func addComment(service commentService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := authenticate(w, r, auth, entity.AnyUserRole)
+		if !ok {
+			return
+		}
+
+		id, ok := cityID(r)
+		if !ok {
+			web.BadRequest(w, "incorrect city ID", nil)
+			return
+		}
+
+		var payload commentInput
+
+		if err := web.DecodeJSON(w, r, &payload); err != nil {
+			web.WriteDecodingError(w, err)
+			return
+		}
+
+		commentID, err := service.AddComment(r.Context(), id, username, payload.Text)
+		if err != nil {
+			writeCommentError(w, "could not add comment", err)
+			return
+		}
+
+		web.Created(w, r, idOutput{ID: commentID})
+	}
+}
+
+func editComment(service commentService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := authenticate(w, r, auth, entity.AnyUserRole)
+		if !ok {
+			return
+		}
+
+		id, ok := commentID(r)
+		if !ok {
+			web.BadRequest(w, "incorrect comment ID", nil)
+			return
+		}
+
+		var payload commentInput
+
+		if err := web.DecodeJSON(w, r, &payload); err != nil {
+			web.WriteDecodingError(w, err)
+			return
+		}
+
+		if err := service.EditComment(r.Context(), id, username, payload.Text); err != nil {
+			writeCommentError(w, "could not edit comment", err)
+			return
+		}
+
+		web.NoContent(w)
+	}
+}
+
+func deleteComment(service commentService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := authenticate(w, r, auth, entity.AnyUserRole)
+		if !ok {
+			return
+		}
+
+		id, ok := commentID(r)
+		if !ok {
+			web.BadRequest(w, "incorrect comment ID", nil)
+			return
+		}
+
+		if err := service.DeleteComment(r.Context(), id, username); err != nil {
+			writeCommentError(w, "could not delete comment", err)
+			return
+		}
+
+		web.NoContent(w)
+	}
+}
+
+// Message types of comments protocol
+const (
+	subscribeMessage     = "subscribe"
+	unsubscribeMessage   = "unsubscribe"
+	subscribedMessage    = "subscribed"
+	errorMessage         = "error"
+	cityDeletedMessage   = "city.deleted"
+	commentMessagePrefix = "comment."
+)
+
+// commentMessageTypes names event types in comments protocol
+var commentMessageTypes = map[string]string{
+	events.Created: "created",
+	events.Updated: "edited",
+	events.Deleted: "deleted",
+}
+
+type commentsRequest struct {
+	Type   string `json:"type"`
+	Cities []int  `json:"cities"`
+}
+
+type subscribedOutput struct {
+	Type   string `json:"type"`
+	Cities []int  `json:"cities"`
+}
+
+type commentOutput struct {
+	Type    string              `json:"type"`
+	EventID string              `json:"eventId"`
+	CityID  int                 `json:"cityId"`
+	Comment cities.CommentEvent `json:"comment"`
+}
+
+type cityDeletedOutput struct {
+	Type    string `json:"type"`
+	EventID string `json:"eventId"`
+	CityID  int    `json:"cityId"`
+}
+
+type errorOutput struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// citySet is cities followed by one connection
+type citySet map[int]struct{}
+
+// apply changes set by request and returns error which is reported to client
+func (c citySet) apply(req commentsRequest) error {
+	for _, id := range req.Cities {
+		if id <= 0 {
+			return fmt.Errorf("invalid city ID %d", id)
+		}
+	}
+
+	switch req.Type {
+	case subscribeMessage:
+		added := map[int]struct{}{}
+
+		for _, id := range req.Cities {
+			if _, ok := c[id]; !ok {
+				added[id] = struct{}{}
+			}
+		}
+
+		if len(c)+len(added) > maxCitySubscriptions {
+			return fmt.Errorf("at most %d cities can be followed", maxCitySubscriptions)
+		}
+
+		for id := range added {
+			c[id] = struct{}{}
+		}
+	case unsubscribeMessage:
+		for _, id := range req.Cities {
+			delete(c, id)
+		}
+	case "":
+		return errors.New("message has to be JSON object with type")
+	default:
+		return fmt.Errorf("unknown message type %q", req.Type)
+	}
+
+	return nil
+}
+
+func (c citySet) list() []int {
+	result := make([]int, 0, len(c))
+	for id := range c {
+		result = append(result, id)
+	}
+
+	sort.Ints(result)
+
+	return result
+}
+
+// message turns event into protocol message, false means that connection does not follow it
+func (c citySet) message(e events.Event) (interface{}, bool) {
+	switch data := e.Data.(type) {
+	case cities.CommentEvent:
+		if _, ok := c[data.CityID]; !ok {
+			return nil, false
+		}
+
+		return commentOutput{
+			Type:    commentMessagePrefix + commentMessageTypes[e.Type],
+			EventID: e.ID,
+			CityID:  data.CityID,
+			Comment: data,
+		}, true
+	case cities.CityEvent:
+		if _, ok := c[data.ID]; !ok || e.Type != events.Deleted {
+			return nil, false
+		}
+
+		// deleted city takes its comments along, there is nothing more to follow
+		delete(c, data.ID)
+
+		return cityDeletedOutput{Type: cityDeletedMessage, EventID: e.ID, CityID: data.ID}, true
+	default:
+		return nil, false
+	}
+}
+
+func liveComments(bus eventBus, auth authService, cfg app.WebSocketConfig, checkOrigin func(r *http.Request) bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// browsers can't set headers on WebSocket requests, query is left out of logs and traces
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		if !authorize(w, r, auth, entity.AnyUserRole) {
+			return
+		}
+
+		sub := bus.Subscribe([]string{events.TopicComments, events.TopicCities}, "")
+		defer sub.Close()
+
+		socket, err := web.Upgrade(w, r, cfg, checkOrigin)
+		if err != nil {
+			return
+		}
+
+		defer socket.Close(websocket.CloseNormalClosure, "")
+
+		requests := make(chan commentsRequest)
+
+		// reader ends when connection is closed by either side
+		go func() {
+			for {
+				var req commentsRequest
+
+				err := socket.Read(&req)
+				if errors.Is(err, web.ErrUnsupportedMessage) {
+					// request with empty type is answered with error
+					req = commentsRequest{}
+				} else if err != nil {
+					return
+				}
+
+				select {
+				case <-socket.Done():
+					return
+				case requests <- req:
+				}
+			}
+		}()
+
+		following := citySet{}
+
+		for {
+			select {
+			case <-socket.Done():
+				return
+			case req := <-requests:
+				if err := following.apply(req); err != nil {
+					socket.Send(errorOutput{Type: errorMessage, Message: err.Error()})
+				} else {
+					socket.Send(subscribedOutput{Type: subscribedMessage, Cities: following.list()})
+				}
+			case e, ok := <-sub.C:
+				if !ok {
+					// connection fell behind on events or server is shutting down, client resubscribes after reconnecting
+					socket.Close(websocket.CloseTryAgainLater, "subscription ended")
+					return
+				}
+
+				if message, ok := following.message(e); ok {
+					socket.Send(message)
+				}
+			}
+		}
+	}
+}
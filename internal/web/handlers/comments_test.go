@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/services/cities"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+)
+
+func cityRange(from, to int) []int {
+	var ids []int
+	for id := from; id <= to; id++ {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func TestCitySetApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		following []int
+		req       commentsRequest
+		want      []int
+		err       string
+	}{
+		{name: "subscribe", req: commentsRequest{Type: subscribeMessage, Cities: []int{2, 1, 2}}, want: []int{1, 2}},
+		{name: "subscribe more", following: []int{1}, req: commentsRequest{Type: subscribeMessage, Cities: []int{3}}, want: []int{1, 3}},
+		{name: "unsubscribe", following: []int{1, 2}, req: commentsRequest{Type: unsubscribeMessage, Cities: []int{2, 5}}, want: []int{1}},
+		{name: "invalid ID", following: []int{1}, req: commentsRequest{Type: subscribeMessage, Cities: []int{2, 0}}, want: []int{1}, err: "invalid city ID 0"},
+		{name: "empty type", following: []int{1}, req: commentsRequest{Cities: []int{2}}, want: []int{1}, err: "message has to be JSON object with type"},
+		{name: "unknown type", following: []int{1}, req: commentsRequest{Type: "follow", Cities: []int{2}}, want: []int{1}, err: `unknown message type "follow"`},
+		{name: "up to cap", following: cityRange(1, 99), req: commentsRequest{Type: subscribeMessage, Cities: []int{100}}, want: cityRange(1, 100)},
+		{name: "over cap", following: cityRange(1, 99), req: commentsRequest{Type: subscribeMessage, Cities: []int{100, 101}}, want: cityRange(1, 99), err: "at most 100 cities can be followed"},
+		{name: "over cap keeps followed", following: cityRange(1, 99), req: commentsRequest{Type: subscribeMessage, Cities: []int{99, 100, 101}}, want: cityRange(1, 99), err: "at most 100 cities can be followed"},
+		{name: "followed again at cap", following: cityRange(1, 100), req: commentsRequest{Type: subscribeMessage, Cities: []int{100}}, want: cityRange(1, 100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := citySet{}
+			for _, id := range tt.following {
+				set[id] = struct{}{}
+			}
+
+			err := set.apply(tt.req)
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("apply failed: %s", err.Error())
+			case tt.err != "" && (err == nil || err.Error() != tt.err):
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+
+			if got := set.list(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCitySetMessage(t *testing.T) {
+	comment := cities.CommentEvent{ID: 7, CityID: 1, Text: "Nice"}
+
+	tests := []struct {
+		name  string
+		event events.Event
+		want  interface{}
+		left  []int
+	}{
+		{
+			name:  "created",
+			event: events.Event{ID: "e-1", Topic: events.TopicComments, Type: events.Created, Data: comment},
+			want:  commentOutput{Type: "comment.created", EventID: "e-1", CityID: 1, Comment: comment},
+			left:  []int{1, 2},
+		},
+		{
+			name:  "edited",
+			event: events.Event{ID: "e-2", Topic: events.TopicComments, Type: events.Updated, Data: comment},
+			want:  commentOutput{Type: "comment.edited", EventID: "e-2", CityID: 1, Comment: comment},
+			left:  []int{1, 2},
+		},
+		{
+			name:  "deleted",
+			event: events.Event{ID: "e-3", Topic: events.TopicComments, Type: events.Deleted, Data: cities.CommentEvent{ID: 7, CityID: 1}},
+			want:  commentOutput{Type: "comment.deleted", EventID: "e-3", CityID: 1, Comment: cities.CommentEvent{ID: 7, CityID: 1}},
+			left:  []int{1, 2},
+		},
+		{
+			name:  "comment of other city",
+			event: events.Event{ID: "e-4", Topic: events.TopicComments, Type: events.Created, Data: cities.CommentEvent{ID: 8, CityID: 3}},
+			left:  []int{1, 2},
+		},
+		{
+			name:  "city deleted",
+			event: events.Event{ID: "e-5", Topic: events.TopicCities, Type: events.Deleted, Data: cities.CityEvent{ID: 2}},
+			want:  cityDeletedOutput{Type: cityDeletedMessage, EventID: "e-5", CityID: 2},
+			left:  []int{1},
+		},
+		{
+			name:  "city updated",
+			event: events.Event{ID: "e-6", Topic: events.TopicCities, Type: events.Updated, Data: cities.CityEvent{ID: 2, Name: "Nis"}},
+			left:  []int{1, 2},
+		},
+		{
+			name:  "other city deleted",
+			event: events.Event{ID: "e-7", Topic: events.TopicCities, Type: events.Deleted, Data: cities.CityEvent{ID: 3}},
+			left:  []int{1, 2},
+		},
+		{
+			name:  "other payload",
+			event: events.Event{ID: "e-8", Topic: events.TopicPrices, Type: events.Updated, Data: 1},
+			left:  []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := citySet{1: {}, 2: {}}
+
+			message, ok := set.message(tt.event)
+			if ok != (tt.want != nil) || !reflect.DeepEqual(message, tt.want) {
+				t.Errorf("expected %+v, got %+v %t", tt.want, message, ok)
+			}
+
+			if got := set.list(); !reflect.DeepEqual(got, tt.left) {
+				t.Errorf("expected to follow %v, got %v", tt.left, got)
+			}
+		})
+	}
+}
+
+// liveMessage is any message of comments protocol
+type liveMessage struct {
+	Type    string              `json:"type"`
+	Message string              `json:"message"`
+	Cities  []int               `json:"cities"`
+	CityID  int                 `json:"cityId"`
+	Comment cities.CommentEvent `json:"comment"`
+}
+
+func dialLiveComments(t *testing.T, bus *events.Bus, cfg app.WebSocketConfig) *websocket.Conn {
+	t.Helper()
+
+	r := mux.NewRouter()
+	v := web.NewVersions(r, "/api", app.DefaultConfig().API.Versions).Register("v1")
+	RegisterCommentHandlers(v, nil, bus, admins{}, cfg, nil)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/comments/live", nil)
+	if err != nil {
+		t.Fatalf("dial failed: %s", err.Error())
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func exchange(t *testing.T, conn *websocket.Conn, req commentsRequest) liveMessage {
+	t.Helper()
+
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatalf("write failed: %s", err.Error())
+	}
+
+	return next(t, conn)
+}
+
+func next(t *testing.T, conn *websocket.Conn) liveMessage {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var message liveMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("read failed: %s", err.Error())
+	}
+
+	return message
+}
+
+func TestLiveComments(t *testing.T) {
+	bus := events.NewBus(10)
+	defer bus.Close()
+
+	conn := dialLiveComments(t, bus, app.DefaultConfig().API.WebSocket)
+
+	if m := exchange(t, conn, commentsRequest{Type: subscribeMessage, Cities: []int{1, 2}}); m.Type != subscribedMessage || !reflect.DeepEqual(m.Cities, []int{1, 2}) {
+		t.Fatalf("unexpected answer to subscribe %+v", m)
+	}
+
+	if m := exchange(t, conn, commentsRequest{Type: subscribeMessage, Cities: cityRange(3, 101)}); m.Type != errorMessage || m.Message != "at most 100 cities can be followed" {
+		t.Fatalf("expected cap to be enforced, got %+v", m)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("follow")); err != nil {
+		t.Fatalf("write failed: %s", err.Error())
+	}
+
+	if m := next(t, conn); m.Type != errorMessage {
+		t.Fatalf("expected text which is not JSON to be answered with error, got %+v", m)
+	}
+
+	bus.Publish(events.TopicComments, events.Created, cities.CommentEvent{ID: 5, CityID: 3, Text: "not followed"})
+	bus.Publish(events.TopicComments, events.Created, cities.CommentEvent{ID: 6, CityID: 1, Text: "Nice"})
+
+	if m := next(t, conn); m.Type != "comment.created" || m.CityID != 1 || m.Comment.Text != "Nice" {
+		t.Fatalf("expected comment of followed city, got %+v", m)
+	}
+
+	bus.Publish(events.TopicCities, events.Deleted, cities.CityEvent{ID: 2})
+
+	if m := next(t, conn); m.Type != cityDeletedMessage || m.CityID != 2 {
+		t.Fatalf("expected city.deleted, got %+v", m)
+	}
+
+	if m := exchange(t, conn, commentsRequest{Type: unsubscribeMessage, Cities: []int{1}}); m.Type != subscribedMessage || len(m.Cities) != 0 {
+		t.Fatalf("deleted or unsubscribed city is still followed: %+v", m)
+	}
+
+	bus.Publish(events.TopicComments, events.Created, cities.CommentEvent{ID: 7, CityID: 1, Text: "unsubscribed"})
+	bus.Publish(events.TopicComments, events.Created, cities.CommentEvent{ID: 8, CityID: 2, Text: "deleted"})
+
+	// next answer proves that comments above were not sent
+	if m := exchange(t, conn, commentsRequest{Type: subscribeMessage, Cities: []int{4}}); m.Type != subscribedMessage || !reflect.DeepEqual(m.Cities, []int{4}) {
+		t.Fatalf("unexpected answer to subscribe %+v", m)
+	}
+}
+
+func TestLiveCommentsClosesSlowConsumer(t *testing.T) {
+	bus := events.NewBus(0)
+	defer bus.Close()
+
+	cfg := app.DefaultConfig().API.WebSocket
+	cfg.SendBuffer = 1
+
+	conn := dialLiveComments(t, bus, cfg)
+
+	if m := exchange(t, conn, commentsRequest{Type: subscribeMessage, Cities: []int{1}}); m.Type != subscribedMessage {
+		t.Fatalf("unexpected answer to subscribe %+v", m)
+	}
+
+	// client reads nothing while comments are published, server drops it instead of buffering them
+	text := strings.Repeat("x", 1024)
+	for i := 0; i < 100000; i++ {
+		bus.Publish(events.TopicComments, events.Created, cities.CommentEvent{ID: i, CityID: 1, Text: text})
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var closed *websocket.CloseError
+			if !errors.As(err, &closed) || closed.Code != websocket.CloseTryAgainLater {
+				t.Fatalf("expected close with %d, got %v", websocket.CloseTryAgainLater, err)
+			}
+
+			return
+		}
+	}
+}
@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
 )
 
 type authService interface {
@@ -12,3 +14,33 @@ type authService interface {
 	Login(ctx context.Context, username, password string) (string, error)
 	SaveUser(ctx context.Context, username, password string) (int, error)
 }
+
+type idOutput struct {
+	ID int `json:"id"`
+}
+
+type statusOutput struct {
+	Status string `json:"status"`
+}
+
+// authorize responds with 401 or 403 and returns false unless request has valid token with role
+func authorize(w http.ResponseWriter, r *http.Request, auth authService, role entity.UserRole) bool {
+	_, ok := authenticate(w, r, auth, role)
+	return ok
+}
+
+// authenticate is authorize which also returns username from token
+func authenticate(w http.ResponseWriter, r *http.Request, auth authService, role entity.UserRole) (string, bool) {
+	username, err := auth.ValidateJwt(r.Context(), r, role)
+
+	switch {
+	case err == nil:
+		return username, true
+	case errors.Is(err, entity.ErrIncorrectRole):
+		web.Forbidden(w, "insufficient role")
+	default:
+		web.Unauthorized(w, "valid token is required")
+	}
+
+	return "", false
+}
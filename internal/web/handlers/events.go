@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
+)
+
+type eventBus interface {
+	Subscribe(topics []string, lastEventID string) *events.Subscription
+}
+
+// RegisterEventHandlers adds feed of entity changes as server-sent events, it is open to any signed in user
+func RegisterEventHandlers(r *web.Version, bus eventBus, auth authService, heartbeat time.Duration) {
+	r.Methods(http.MethodGet).Path("/events").Name(r.RouteName("events")).HandlerFunc(streamEvents(bus, auth, heartbeat))
+}
+
+var eventOperations = openapi.Operations{
+	"events": {
+		Summary: "Feed of created, updated and deleted entities",
+		Tags:    []string{"events"},
+		Query: []openapi.Parameter{
+			{
+				Name:        "topics",
+				Description: "Comma separated topics, all topics when missing: " + strings.Join(events.Topics, ", "),
+				Example:     events.TopicCities,
+			},
+			{
+				Name:        "lastEventId",
+				Description: "Used instead of Last-Event-ID header by clients which can't set it",
+				Example:     "",
+			},
+		},
+		Headers: []openapi.Parameter{{
+			Name:        "Last-Event-ID",
+			Description: "ID of last received event, buffered events after it are sent first; reset event means that some were missed",
+			Example:     "",
+		}},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {
+				Description: "Server-sent events named topic.type, e.g. cities.updated, and heartbeat events without ID",
+				ContentType: web.EventStreamType,
+				Body:        events.Event{},
+			},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized},
+		Secured: true,
+	},
+}
+
+const (
+	heartbeatEvent = "heartbeat"
+	// resetEvent tells client that events were missed and state has to be reloaded
+	resetEvent = "reset"
+)
+
+type timeOutput struct {
+	Time time.Time `json:"time"`
+}
+
+// eventTopics reads topics query parameter, empty list means all topics
+func eventTopics(r *http.Request) ([]string, []string) {
+	var topics, unknown []string
+
+	for _, value := range r.URL.Query()["topics"] {
+		for _, topic := range strings.Split(value, ",") {
+			topic = strings.TrimSpace(topic)
+
+			switch {
+			case topic == "":
+			case contains(events.Topics, topic):
+				topics = append(topics, topic)
+			default:
+				unknown = append(unknown, topic)
+			}
+		}
+	}
+
+	return topics, unknown
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func streamEvents(bus eventBus, auth authService, heartbeat time.Duration) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AnyUserRole) {
+			return
+		}
+
+		topics, unknown := eventTopics(r)
+		if len(unknown) > 0 {
+			web.BadRequest(w, "unknown topics", map[string][]string{
+				"topics": unknown,
+			})
+
+			return
+		}
+
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("lastEventId")
+		}
+
+		sub := bus.Subscribe(topics, lastEventID)
+		defer sub.Close()
+
+		stream, err := web.NewEventWriter(w)
+		if err != nil {
+			return
+		}
+
+		if !sub.Resumed {
+			if err = stream.Event("", resetEvent, timeOutput{Time: time.Now().UTC()}); err != nil {
+				return
+			}
+		}
+
+		for _, e := range sub.Replay {
+			if err = stream.Event(e.ID, e.Topic+"."+e.Type, e); err != nil {
+				return
+			}
+		}
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case t := <-ticker.C:
+				err = stream.Event("", heartbeatEvent, timeOutput{Time: t.UTC()})
+			case e, ok := <-sub.C:
+				if !ok {
+					// client fell behind or server is shutting down, it resumes after reconnecting
+					return
+				}
+
+				err = stream.Event(e.ID, e.Topic+"."+e.Type, e)
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}
+}
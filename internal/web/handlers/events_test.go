@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+)
+
+// readEvents returns names of first n server-sent events, lines with IDs are returned as they are
+func readEvents(t *testing.T, url, lastEventID string, n int) []string {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	// streams never end, timeout fails tests which wait for events that are not sent
+	client := http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != web.EventStreamType {
+		t.Fatalf("expected event stream, got %d %s", resp.StatusCode, ct)
+	}
+
+	var result []string
+
+	scanner := bufio.NewScanner(resp.Body)
+	for len(result) < n && scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") || strings.HasPrefix(line, "id: ") {
+			result = append(result, line)
+		}
+	}
+
+	if len(result) < n {
+		t.Fatalf("expected %d lines, got %v: %v", n, result, scanner.Err())
+	}
+
+	return result
+}
+
+func newEventServer(t *testing.T, bus *events.Bus, heartbeat time.Duration) string {
+	t.Helper()
+
+	r := mux.NewRouter()
+	RegisterEventHandlers(web.NewVersions(r, "/api", app.DefaultConfig().API.Versions).Register("v1"), bus, admins{}, heartbeat)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	return server.URL + "/api/v1/events"
+}
+
+func TestEventsHeartbeat(t *testing.T) {
+	bus := events.NewBus(10)
+	defer bus.Close()
+
+	url := newEventServer(t, bus, 10*time.Millisecond)
+
+	got := readEvents(t, url, "", 2)
+
+	for _, line := range got {
+		if line != "event: "+heartbeatEvent {
+			t.Errorf("expected only heartbeats of idle stream, got %v", got)
+		}
+	}
+}
+
+func TestEventsResume(t *testing.T) {
+	bus := events.NewBus(2)
+	defer bus.Close()
+
+	url := newEventServer(t, bus, time.Hour)
+
+	s := bus.Subscribe(nil, "")
+	defer s.Close()
+
+	for i := 0; i < 4; i++ {
+		bus.Publish(events.TopicCities, events.Created, i)
+	}
+
+	var published []events.Event
+	for i := 0; i < 4; i++ {
+		published = append(published, <-s.C)
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        []string
+	}{
+		{
+			name:        "buffered",
+			lastEventID: published[1].ID,
+			want:        []string{"id: " + published[2].ID, "event: cities.created", "id: " + published[3].ID, "event: cities.created"},
+		},
+		{
+			name:        "evicted",
+			lastEventID: published[0].ID,
+			want:        []string{"event: " + resetEvent},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readEvents(t, url, tt.lastEventID, len(tt.want))
+
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
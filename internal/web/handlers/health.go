@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/health"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
+)
+
+// RegisterHealthHandlers adds probes, liveness only tells that process is serving requests
+// while readiness also runs dependency checks
+func RegisterHealthHandlers(r *mux.Router, registry *health.Registry) {
+	r.Methods(http.MethodGet).Path("/health/live").Name("live").HandlerFunc(live())
+	r.Methods(http.MethodGet).Path("/health/ready").Name("ready").HandlerFunc(ready(registry))
+}
+
+var healthOperations = openapi.Operations{
+	"live": {
+		Summary: "Liveness probe",
+		Tags:    []string{"health"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: statusOutput{}},
+		},
+	},
+	"ready": {
+		Summary: "Readiness probe with dependency checks",
+		Tags:    []string{"health"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                 {ContentType: "application/json", Body: health.Report{}},
+			http.StatusServiceUnavailable: {Description: "Some check failed or server is draining", ContentType: "application/json", Body: health.Report{}},
+		},
+	},
+}
+
+func live() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		web.Ok(w, r, statusOutput{Status: health.StatusOK})
+	}
+}
+
+func ready(registry *health.Registry) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := registry.Run(r.Context())
+
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+
+		web.JSON(w, status, report)
+	}
+}
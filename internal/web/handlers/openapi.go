@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
+)
+
+//go:generate sh swaggerui/fetch.sh 5.17.14
+
+//go:embed swagger.html
+var swaggerPage []byte
+
+// swaggerAssets holds vendored swagger-ui-dist so that /docs loads no third-party scripts
+//
+//go:embed swaggerui
+var swaggerAssets embed.FS
+
+var apiInfo = openapi.Info{
+	Title:       "go-travel-reactive",
+	Description: "Cities with comments, served by reactive pipelines",
+	Version:     "1.0.0",
+}
+
+// metrics route is registered in main next to the router
+var docsOperations = openapi.Operations{
+	"metrics": {
+		Summary: "Prometheus metrics",
+		Tags:    []string{"docs"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {ContentType: "text/plain", Body: ""},
+		},
+	},
+	"openapi": {
+		Summary: "This specification",
+		Tags:    []string{"docs"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Description: "OpenAPI 3 document", ContentType: "application/json", Body: map[string]interface{}{}},
+		},
+		Errors: []int{http.StatusInternalServerError},
+	},
+	"docs": {
+		Summary: "Swagger UI for this specification",
+		Tags:    []string{"docs"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {ContentType: "text/html", Body: ""},
+		},
+		Errors: []int{http.StatusServiceUnavailable},
+	},
+	"docsAsset": {
+		Summary: "Vendored Swagger UI asset",
+		Tags:    []string{"docs"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: ""},
+		},
+		Errors: []int{http.StatusNotFound},
+	},
+}
+
+// Operations documents every route registered by this package, keyed by route name
+func Operations() openapi.Operations {
+	return openapi.Merge(
+		docsOperations,
+		healthOperations,
+		testOperations,
+		userOperations,
+		statsOperations,
+		cityOperations,
+		cityV2Operations,
+		eventOperations,
+		commentOperations,
+		routeOperations,
+		webhookOperations,
+	)
+}
+
+// RegisterOpenAPIHandlers serves /openapi.json and Swagger UI at /docs.
+// Document is built from r on first request so that routes registered later are included.
+func RegisterOpenAPIHandlers(r *mux.Router, ops openapi.Operations) {
+	r.Methods(http.MethodGet).Path("/openapi.json").Name("openapi").HandlerFunc(openAPIDocument(r, ops))
+	assets, _ := fs.Sub(swaggerAssets, "swaggerui")
+
+	r.Methods(http.MethodGet).Path("/docs").Name("docs").HandlerFunc(swaggerUI(assets))
+	r.Methods(http.MethodGet).Path("/docs/{asset:[a-z.-]+\\.(?:js|css)}").Name("docsAsset").
+		Handler(http.StripPrefix("/docs/", http.FileServer(http.FS(assets))))
+}
+
+func openAPIDocument(router *mux.Router, ops openapi.Operations) func(http.ResponseWriter, *http.Request) {
+	var (
+		once sync.Once
+		body []byte
+		err  error
+	)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			var doc *openapi.Document
+
+			doc, err = openapi.Build(apiInfo, router, ops)
+			if err == nil {
+				body, err = json.Marshal(doc)
+			}
+		})
+
+		if err != nil {
+			web.InternalServerError(w, "could not build OpenAPI document", map[string][]string{
+				"error": {err.Error()},
+			})
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// swaggerUI serves the page only when assets were vendored by go generate
+func swaggerUI(assets fs.FS) func(http.ResponseWriter, *http.Request) {
+	_, err := fs.Stat(assets, "swagger-ui-bundle.js")
+	vendored := err == nil
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !vendored {
+			http.Error(w, "Swagger UI is not vendored, run go generate ./internal/web/handlers", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(swaggerPage)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/services/routes"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
+)
+
+type routeService interface {
+	AddRoute(ctx context.Context, sourceID, destinationID int, price float64) (routes.RouteDto, error)
+	UpdatePrice(ctx context.Context, id int, price float64) error
+}
+
+// RegisterRouteHandlers adds changes of routes and their prices, allowed to admins only.
+// Changes are announced on routes and prices topics.
+func RegisterRouteHandlers(r *web.Version, service routeService, auth authService) {
+	r.Methods(http.MethodPost).Path("/route").Name(r.RouteName("addRoute")).HandlerFunc(addRoute(service, auth))
+	r.Methods(http.MethodPut).Path("/route/{id:[0-9]+}/price").Name(r.RouteName("updateRoutePrice")).HandlerFunc(updateRoutePrice(service, auth))
+}
+
+var routeOperations = openapi.Operations{
+	"addRoute": {
+		Summary: "Add direct flight between airports",
+		Tags:    []string{"routes"},
+		Request: routeInput{},
+		Responses: map[int]openapi.Response{
+			http.StatusCreated: {Body: routes.RouteDto{}},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+		Secured: true,
+	},
+	"updateRoutePrice": {
+		Summary: "Change price of route",
+		Tags:    []string{"routes"},
+		Request: priceInput{},
+		Responses: map[int]openapi.Response{
+			http.StatusNoContent: {Description: "Price updated"},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+		Secured: true,
+	},
+}
+
+type routeInput struct {
+	SourceID      int     `json:"sourceId" validate:"required,min=1"`
+	DestinationID int     `json:"destinationId" validate:"required,min=1"`
+	Price         float64 `json:"price" validate:"min=0"`
+}
+
+type priceInput struct {
+	Price float64 `json:"price" validate:"min=0"`
+}
+
+// writeRouteError maps service errors to statuses
+func writeRouteError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, entity.ErrAirportNotFound):
+		web.NotFound(w, entity.ErrAirportNotFound.Error())
+	case errors.Is(err, entity.ErrRouteNotFound):
+		web.NotFound(w, entity.ErrRouteNotFound.Error())
+	default:
+		web.InternalServerError(w, message, map[string][]string{
+			"error": {err.Error()},
+		})
+	}
+}
+
+func addRoute(service routeService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AdminUserRole) {
+			return
+		}
+
+		var payload routeInput
+
+		if err := web.DecodeJSON(w, r, &payload); err != nil {
+			web.WriteDecodingError(w, err)
+			return
+		}
+
+		route, err := service.AddRoute(r.Context(), payload.SourceID, payload.DestinationID, payload.Price)
+		if err != nil {
+			writeRouteError(w, "could not add route", err)
+			return
+		}
+
+		web.Created(w, r, route)
+	}
+}
+
+func updateRoutePrice(service routeService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AdminUserRole) {
+			return
+		}
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			web.BadRequest(w, "incorrect route ID", nil)
+			return
+		}
+
+		var payload priceInput
+
+		if err = web.DecodeJSON(w, r, &payload); err != nil {
+			web.WriteDecodingError(w, err)
+			return
+		}
+
+		if err = service.UpdatePrice(r.Context(), id, payload.Price); err != nil {
+			writeRouteError(w, "could not update price", err)
+			return
+		}
+
+		web.NoContent(w)
+	}
+}
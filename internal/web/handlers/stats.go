@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
+)
+
+type statsProvider interface {
+	Stats() sql.DBStats
+}
+
+// RegisterStatsHandlers adds pool statistics, they are shown to admins only
+func RegisterStatsHandlers(r *web.Version, provider statsProvider, auth authService) {
+	r.Methods(http.MethodGet).Path("/stats/db").Name(r.RouteName("dbStats")).HandlerFunc(dbStats(provider, auth))
+}
+
+var statsOperations = openapi.Operations{
+	"dbStats": {
+		Summary: "Database connection pool statistics",
+		Tags:    []string{"stats"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: dbStatsOutput{}},
+		},
+		Errors:  []int{http.StatusUnauthorized, http.StatusForbidden},
+		Secured: true,
+	},
+}
+
+func dbStats(provider statsProvider, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AdminUserRole) {
+			return
+		}
+
+		stats := provider.Stats()
+
+		web.Ok(w, r, dbStatsOutput{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		})
+	}
+}
+
+type dbStatsOutput struct {
+	MaxOpenConnections int   `json:"maxOpenConnections"`
+	OpenConnections    int   `json:"openConnections"`
+	InUse              int   `json:"inUse"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"waitCount"`
+	WaitDurationMs     int64 `json:"waitDurationMs"`
+	MaxIdleClosed      int64 `json:"maxIdleClosed"`
+	MaxIdleTimeClosed  int64 `json:"maxIdleTimeClosed"`
+	MaxLifetimeClosed  int64 `json:"maxLifetimeClosed"`
+}
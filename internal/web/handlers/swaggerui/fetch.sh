@@ -0,0 +1,16 @@
+#!/bin/sh
+# Vendors swagger-ui-dist of given version next to this script, run by go generate.
+set -eu
+
+version="$1"
+dir="$(dirname "$0")"
+tmp="$(mktemp -d)"
+trap 'rm -rf "$tmp"' EXIT
+
+curl -fsSL "https://registry.npmjs.org/swagger-ui-dist/-/swagger-ui-dist-${version}.tgz" | tar -xz -C "$tmp"
+
+for f in swagger-ui.css swagger-ui-bundle.js LICENSE; do
+  cp "$tmp/package/$f" "$dir/$f"
+done
+
+echo "$version" > "$dir/VERSION"
@@ -3,20 +3,26 @@ package handlers
 import (
 	"net/http"
 
-	"github.com/gorilla/mux"
 	"github.com/strax84mb/go-travel-reactive/internal/web"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
 )
 
-func RegisterTestHandler(r *mux.Router) {
-	r.Methods(http.MethodGet).Path("/test").HandlerFunc(testHandler())
+func RegisterTestHandler(r *web.Version) {
+	r.Methods(http.MethodGet).Path("/test").Name(r.RouteName("test")).HandlerFunc(testHandler())
+}
+
+var testOperations = openapi.Operations{
+	"test": {
+		Summary: "Check that API responds",
+		Tags:    []string{"test"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: statusOutput{}},
+		},
+	},
 }
 
 func testHandler() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		web.Ok(w, struct {
-			Status string `json:"status"`
-		}{
-			Status: "ok",
-		})
+		web.Ok(w, r, statusOutput{Status: "ok"})
 	}
 }
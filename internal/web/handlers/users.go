@@ -1,33 +1,44 @@
 package handlers
 
 import (
-	"encoding/json"
-	"io/ioutil"
 	"net/http"
 
-	"github.com/gorilla/mux"
 	"github.com/strax84mb/go-travel-reactive/internal/web"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
 )
 
-func RegisterUserHandlers(r *mux.Router, service authService) {
-	r.Methods(http.MethodPost).Path("/user/login").HandlerFunc(login(service))
-	r.Methods(http.MethodPost).Path("/user/signup").HandlerFunc(signup(service))
+func RegisterUserHandlers(r *web.Version, service authService) {
+	r.Methods(http.MethodPost).Path("/user/login").Name(r.RouteName("login")).HandlerFunc(login(service))
+	r.Methods(http.MethodPost).Path("/user/signup").Name(r.RouteName("signup")).HandlerFunc(signup(service))
+}
+
+var userOperations = openapi.Operations{
+	"login": {
+		Summary: "Login and get bearer token",
+		Tags:    []string{"users"},
+		Request: loginInput{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: loginOutput{}},
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	"signup": {
+		Summary: "Create regular user",
+		Tags:    []string{"users"},
+		Request: signupInput{},
+		Responses: map[int]openapi.Response{
+			http.StatusCreated: {Body: idOutput{}},
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
 }
 
 func login(service authService) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		bytes, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			web.BadRequest(w, "payload needed", nil)
-			return
-		}
-
-		defer r.Body.Close()
-
 		var payload loginInput
 
-		if err = json.Unmarshal(bytes, &payload); err != nil {
-			web.BadRequest(w, "incorrect payload", nil)
+		if err := web.DecodeJSON(w, r, &payload); err != nil {
+			web.WriteDecodingError(w, err)
 			return
 		}
 
@@ -40,13 +51,19 @@ func login(service authService) func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		web.Ok(w, loginOutput{Token: token})
+		web.Ok(w, r, loginOutput{Token: token})
 	}
 }
 
 type loginInput struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// signupInput limits match users table
+type signupInput struct {
+	Username string `json:"username" validate:"required,min=3,max=30"`
+	Password string `json:"password" validate:"required,min=8"`
 }
 
 type loginOutput struct {
@@ -55,18 +72,10 @@ type loginOutput struct {
 
 func signup(service authService) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		bytes, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			web.BadRequest(w, "payload needed", nil)
-			return
-		}
-
-		defer r.Body.Close()
-
-		var payload loginInput
+		var payload signupInput
 
-		if err = json.Unmarshal(bytes, &payload); err != nil {
-			web.BadRequest(w, "incorrect payload", nil)
+		if err := web.DecodeJSON(w, r, &payload); err != nil {
+			web.WriteDecodingError(w, err)
 			return
 		}
 
@@ -79,10 +88,6 @@ func signup(service authService) func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		web.Created(w, struct {
-			ID int `json:"id"`
-		}{
-			ID: id,
-		})
+		web.Created(w, r, idOutput{ID: id})
 	}
 }
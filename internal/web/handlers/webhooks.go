@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/entity"
+	"github.com/strax84mb/go-travel-reactive/internal/events"
+	"github.com/strax84mb/go-travel-reactive/internal/services/webhooks"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+	"github.com/strax84mb/go-travel-reactive/internal/web/openapi"
+)
+
+type webhookService interface {
+	AddSubscription(ctx context.Context, url string, topics []string) (webhooks.SubscriptionDto, error)
+	ListSubscriptions(ctx context.Context) ([]webhooks.SubscriptionDto, error)
+	DeleteSubscription(ctx context.Context, id int) error
+	ListDeliveries(ctx context.Context, subscriptionID int, status entity.DeliveryStatus) ([]webhooks.DeliveryDto, error)
+	ReplayDelivery(ctx context.Context, subscriptionID, deliveryID int) error
+}
+
+// RegisterWebhookHandlers adds management of webhook subscriptions, allowed to admins only.
+// Requests are described in docs/webhooks.md.
+func RegisterWebhookHandlers(r *web.Version, service webhookService, auth authService) {
+	r.Methods(http.MethodGet).Path("/webhooks").Name(r.RouteName("listWebhooks")).HandlerFunc(listWebhooks(service, auth))
+	r.Methods(http.MethodPost).Path("/webhooks").Name(r.RouteName("addWebhook")).HandlerFunc(addWebhook(service, auth))
+	r.Methods(http.MethodDelete).Path("/webhooks/{id:[0-9]+}").Name(r.RouteName("deleteWebhook")).HandlerFunc(deleteWebhook(service, auth))
+	r.Methods(http.MethodGet).Path("/webhooks/{id:[0-9]+}/deliveries").Name(r.RouteName("listWebhookDeliveries")).HandlerFunc(listWebhookDeliveries(service, auth))
+	r.Methods(http.MethodPost).Path("/webhooks/{id:[0-9]+}/deliveries/{deliveryId:[0-9]+}/replay").Name(r.RouteName("replayWebhookDelivery")).HandlerFunc(replayWebhookDelivery(service, auth))
+}
+
+var deliveryStatuses = []string{string(entity.DeliveryPending), string(entity.DeliveryDelivered), string(entity.DeliveryDead)}
+
+var webhookOperations = openapi.Operations{
+	"listWebhooks": {
+		Summary: "List webhook subscriptions, secrets are left out",
+		Tags:    []string{"webhooks"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: []webhooks.SubscriptionDto{}},
+		},
+		Errors:  []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+		Secured: true,
+	},
+	"addWebhook": {
+		Summary: "Subscribe URL to events, returned secret signs requests and is not shown again",
+		Tags:    []string{"webhooks"},
+		Request: webhookInput{},
+		Responses: map[int]openapi.Response{
+			http.StatusCreated: {Body: webhooks.SubscriptionDto{}},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+		Secured: true,
+	},
+	"deleteWebhook": {
+		Summary: "Delete webhook subscription with its deliveries",
+		Tags:    []string{"webhooks"},
+		Responses: map[int]openapi.Response{
+			http.StatusNoContent: {Description: "Subscription deleted"},
+		},
+		Errors:  []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+		Secured: true,
+	},
+	"listWebhookDeliveries": {
+		Summary: "List deliveries of webhook subscription",
+		Tags:    []string{"webhooks"},
+		Query: []openapi.Parameter{{
+			Name:        "status",
+			Description: "Only deliveries with status: " + strings.Join(deliveryStatuses, ", "),
+			Example:     string(entity.DeliveryDead),
+		}},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: []webhooks.DeliveryDto{}},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+		Secured: true,
+	},
+	"replayWebhookDelivery": {
+		Summary: "Send dead delivery again with fresh attempts",
+		Tags:    []string{"webhooks"},
+		Responses: map[int]openapi.Response{
+			http.StatusNoContent: {Description: "Delivery is pending"},
+		},
+		Errors:  []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+		Secured: true,
+	},
+}
+
+type webhookInput struct {
+	URL string `json:"url" validate:"required,max=500"`
+	// Topics default to all topics
+	Topics []string `json:"topics"`
+}
+
+// writeWebhookError maps service errors to statuses
+func writeWebhookError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, webhooks.ErrInvalidURL):
+		web.BadRequest(w, webhooks.ErrInvalidURL.Error(), nil)
+	case errors.Is(err, webhooks.ErrUnknownTopic):
+		web.BadRequest(w, err.Error(), map[string][]string{
+			"topics": events.Topics,
+		})
+	case errors.Is(err, entity.ErrSubscriptionNotFound):
+		web.NotFound(w, entity.ErrSubscriptionNotFound.Error())
+	case errors.Is(err, entity.ErrDeliveryNotFound):
+		web.NotFound(w, entity.ErrDeliveryNotFound.Error())
+	case errors.Is(err, entity.ErrDeliveryNotDead):
+		web.Conflict(w, entity.ErrDeliveryNotDead.Error())
+	default:
+		web.InternalServerError(w, message, map[string][]string{
+			"error": {err.Error()},
+		})
+	}
+}
+
+func webhookID(r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	return id, err == nil
+}
+
+func listWebhooks(service webhookService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AdminUserRole) {
+			return
+		}
+
+		list, err := service.ListSubscriptions(r.Context())
+		if err != nil {
+			writeWebhookError(w, "could not list webhooks", err)
+			return
+		}
+
+		web.Ok(w, r, list)
+	}
+}
+
+func addWebhook(service webhookService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AdminUserRole) {
+			return
+		}
+
+		var payload webhookInput
+
+		if err := web.DecodeJSON(w, r, &payload); err != nil {
+			web.WriteDecodingError(w, err)
+			return
+		}
+
+		subscription, err := service.AddSubscription(r.Context(), payload.URL, payload.Topics)
+		if err != nil {
+			writeWebhookError(w, "could not add webhook", err)
+			return
+		}
+
+		web.Created(w, r, subscription)
+	}
+}
+
+func deleteWebhook(service webhookService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AdminUserRole) {
+			return
+		}
+
+		id, ok := webhookID(r, "id")
+		if !ok {
+			web.BadRequest(w, "incorrect webhook ID", nil)
+			return
+		}
+
+		if err := service.DeleteSubscription(r.Context(), id); err != nil {
+			writeWebhookError(w, "could not delete webhook", err)
+			return
+		}
+
+		web.NoContent(w)
+	}
+}
+
+func listWebhookDeliveries(service webhookService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AdminUserRole) {
+			return
+		}
+
+		id, ok := webhookID(r, "id")
+		if !ok {
+			web.BadRequest(w, "incorrect webhook ID", nil)
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		if status != "" && !contains(deliveryStatuses, status) {
+			web.BadRequest(w, "status must be one of "+strings.Join(deliveryStatuses, ", "), nil)
+			return
+		}
+
+		list, err := service.ListDeliveries(r.Context(), id, entity.DeliveryStatus(status))
+		if err != nil {
+			writeWebhookError(w, "could not list webhook deliveries", err)
+			return
+		}
+
+		web.Ok(w, r, list)
+	}
+}
+
+func replayWebhookDelivery(service webhookService, auth authService) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, auth, entity.AdminUserRole) {
+			return
+		}
+
+		id, ok := webhookID(r, "id")
+		if !ok {
+			web.BadRequest(w, "incorrect webhook ID", nil)
+			return
+		}
+
+		deliveryID, ok := webhookID(r, "deliveryId")
+		if !ok {
+			web.BadRequest(w, "incorrect delivery ID", nil)
+			return
+		}
+
+		if err := service.ReplayDelivery(r.Context(), id, deliveryID); err != nil {
+			writeWebhookError(w, "could not replay webhook delivery", err)
+			return
+		}
+
+		web.NoContent(w)
+	}
+}
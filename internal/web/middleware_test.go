@@ -0,0 +1,101 @@
+package web
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/metrics"
+)
+
+// okHandler answers every request with 200
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// serve records response of handler to request with headers
+func serve(handler http.Handler, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+type fixedStats struct{}
+
+func (fixedStats) Stats() sql.DBStats {
+	return sql.DBStats{MaxOpenConnections: 7, OpenConnections: 3}
+}
+
+func scrape(t *testing.T, url string) string {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("scrape failed: %s", err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("could not read metrics: %s", err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected Prometheus text format, got %s", ct)
+	}
+
+	return string(body)
+}
+
+func TestMetricsScrape(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(Metrics)
+	r.Methods(http.MethodGet).Path("/metrics").Handler(metrics.Handler())
+	r.Methods(http.MethodGet).Path("/cities/{id}").HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	if err := metrics.RegisterDBStats(fixedStats{}); err != nil {
+		t.Fatalf("RegisterDBStats failed: %s", err.Error())
+	}
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/cities/12")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	body := scrape(t, server.URL+"/metrics")
+
+	for _, expected := range []string{
+		`gotravel_http_requests_total{method="GET",route="/cities/{id}",status="418"} 1`,
+		`gotravel_http_request_duration_seconds_count{method="GET",route="/cities/{id}"} 1`,
+		"gotravel_db_max_open_connections 7",
+		"gotravel_db_open_connections 3",
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("metrics are missing %s", expected)
+		}
+	}
+}
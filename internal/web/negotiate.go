@@ -0,0 +1,320 @@
+package web
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// format is one representation of response payload
+type format struct {
+	contentType string
+	// mediaTypes are accepted in Accept header, first one is canonical
+	mediaTypes []string
+	// supports tells if payload can be represented, nil means any payload
+	supports func(payload interface{}) bool
+	encode   func(payload interface{}) ([]byte, error)
+}
+
+// formats are in order of preference for Accept ranges with wildcards
+var formats = []format{
+	{
+		contentType: "application/json",
+		mediaTypes:  []string{"application/json"},
+		encode:      encodeJSON,
+	},
+	{
+		contentType: "application/msgpack",
+		mediaTypes:  []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+		encode:      encodeMsgpack,
+	},
+	{
+		contentType: "text/csv; charset=utf-8",
+		mediaTypes:  []string{"text/csv"},
+		supports:    csvSupported,
+		encode:      encodeCSV,
+	},
+}
+
+// Respond writes payload in format negotiated from Accept header, JSON is used when header is missing.
+// Response is 406 when none of accepted formats can represent payload.
+func Respond(w http.ResponseWriter, r *http.Request, status int, payload interface{}) {
+	contentType, body, ok := negotiateBody(w, r, payload)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// negotiateBody encodes payload or writes error response and returns false
+func negotiateBody(w http.ResponseWriter, r *http.Request, payload interface{}) (string, []byte, bool) {
+	w.Header().Add("Vary", "Accept")
+
+	f, ok := negotiate(r.Header.Values("Accept"), payload)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "none of accepted media types can represent response", map[string][]string{
+			"supported": MediaTypes(payload),
+		})
+
+		return "", nil, false
+	}
+
+	body, err := f.encode(payload)
+	if err != nil {
+		InternalServerError(w, "could not encode response", map[string][]string{
+			"error": {err.Error()},
+		})
+
+		return "", nil, false
+	}
+
+	return f.contentType, body, true
+}
+
+// MediaTypes lists formats Respond can negotiate for payload
+func MediaTypes(payload interface{}) []string {
+	var result []string
+
+	for _, f := range formats {
+		if f.supports == nil || f.supports(payload) {
+			result = append(result, f.mediaTypes[0])
+		}
+	}
+
+	return result
+}
+
+type mediaRange struct {
+	mediaType string
+	params    map[string]string
+	q         float64
+}
+
+// negotiate picks format for most preferred media range which has format able to represent payload
+func negotiate(accept []string, payload interface{}) (format, bool) {
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return formats[0], true
+	}
+
+	for _, mr := range ranges {
+		for _, f := range formats {
+			if f.supports != nil && !f.supports(payload) {
+				continue
+			}
+
+			for _, mt := range f.mediaTypes {
+				if mediaTypeMatches(mr.mediaType, mt) {
+					return f, true
+				}
+			}
+		}
+	}
+
+	return format{}, false
+}
+
+// parseAccept returns ranges by descending quality, ranges with q=0 are not acceptable and left out
+func parseAccept(accept []string) []mediaRange {
+	var ranges []mediaRange
+
+	for _, header := range accept {
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			q := 1.0
+			if value, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(value, 64); err != nil {
+					continue
+				}
+			}
+
+			if q > 0 {
+				ranges = append(ranges, mediaRange{mediaType: mediaType, params: params, q: q})
+			}
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	return ranges
+}
+
+func mediaTypeMatches(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+
+	prefix, wildcard := strings.CutSuffix(pattern, "/*")
+
+	return wildcard && strings.HasPrefix(mediaType, prefix+"/")
+}
+
+func encodeJSON(payload interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(body, '\n'), nil
+}
+
+// encodeMsgpack uses json tags so field names are the same in both formats
+func encodeMsgpack(payload interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.SetOmitEmpty(false)
+
+	if err := enc.Encode(payload); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// csvSupported accepts lists of structs, e.g. cities
+func csvSupported(payload interface{}) bool {
+	t := reflect.TypeOf(payload)
+	if t == nil || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) {
+		return false
+	}
+
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	return elem.Kind() == reflect.Struct && elem != timeType
+}
+
+type csvColumn struct {
+	name  string
+	index int
+}
+
+// csvColumns are fields with scalar values named by json tags, nested lists and objects are left out
+func csvColumns(t reflect.Type) []csvColumn {
+	var columns []csvColumn
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = field.Name
+		}
+
+		switch field.Type.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct, reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+			if field.Type != timeType {
+				continue
+			}
+		}
+
+		columns = append(columns, csvColumn{name: name, index: i})
+	}
+
+	return columns
+}
+
+func encodeCSV(payload interface{}) ([]byte, error) {
+	list := reflect.ValueOf(payload)
+
+	elem := list.Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	columns := csvColumns(elem)
+
+	var buf bytes.Buffer
+
+	writer := csv.NewWriter(&buf)
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(columns))
+
+	for i := 0; i < list.Len(); i++ {
+		item := reflect.Indirect(list.Index(i))
+		if !item.IsValid() {
+			continue
+		}
+
+		for j, c := range columns {
+			record[j] = csvValue(item.Field(c.index))
+		}
+
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+
+	return buf.Bytes(), writer.Error()
+}
+
+// csvText stops spreadsheets from running user text, e.g. city names, as formulas
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+
+	return s
+}
+
+func csvValue(v reflect.Value) string {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return csvText(v.String())
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
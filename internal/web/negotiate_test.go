@@ -0,0 +1,39 @@
+package web
+
+import "testing"
+
+type csvRow struct {
+	ID   int     `json:"id"`
+	Name string  `json:"name"`
+	Rate float64 `json:"rate"`
+}
+
+func TestEncodeCSVEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		name string
+		row  csvRow
+		want string
+	}{
+		{name: "plain text", row: csvRow{ID: 1, Name: "Belgrade"}, want: "1,Belgrade,0\n"},
+		{name: "equals", row: csvRow{ID: 1, Name: "=HYPERLINK(\"http://x\")"}, want: "1,\"'=HYPERLINK(\"\"http://x\"\")\",0\n"},
+		{name: "plus", row: csvRow{ID: 1, Name: "+1+2"}, want: "1,'+1+2,0\n"},
+		{name: "minus", row: csvRow{ID: 1, Name: "-2+3"}, want: "1,'-2+3,0\n"},
+		{name: "at", row: csvRow{ID: 1, Name: "@SUM(A1)"}, want: "1,'@SUM(A1),0\n"},
+		{name: "tab", row: csvRow{ID: 1, Name: "\t=1"}, want: "1,'\t=1,0\n"},
+		{name: "formula char inside", row: csvRow{ID: 1, Name: "Novi Sad=1"}, want: "1,Novi Sad=1,0\n"},
+		{name: "negative numbers", row: csvRow{ID: -1, Rate: -0.5}, want: "-1,,-0.5\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := encodeCSV([]csvRow{tt.row})
+			if err != nil {
+				t.Fatalf("encodeCSV failed: %s", err.Error())
+			}
+
+			if want := "id,name,rate\n" + tt.want; string(body) != want {
+				t.Errorf("expected %q, got %q", want, body)
+			}
+		})
+	}
+}
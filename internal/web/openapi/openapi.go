@@ -0,0 +1,517 @@
+// Package openapi builds OpenAPI 3 document from routes of mux router and operations documented by route name
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/web"
+)
+
+const bearerAuth = "bearerAuth"
+
+// Operation documents route with the same name, values of Request and response bodies
+// are only used for their types
+type Operation struct {
+	Summary string
+	Tags    []string
+	Query   []Parameter
+	Headers []Parameter
+	Request interface{}
+	// Responses are successful responses by status
+	Responses map[int]Response
+	// Errors are statuses which are returned with web.ErrorResponse body
+	Errors []int
+	// Secured operations need bearer token
+	Secured bool
+}
+
+type Parameter struct {
+	Name        string
+	Description string
+	Required    bool
+	// Example is value of parameter type
+	Example interface{}
+}
+
+// Response body is written in every format web.Respond can negotiate for it unless ContentType is set,
+// nil body means no content
+type Response struct {
+	Description string
+	ContentType string
+	Body        interface{}
+}
+
+// Operations are keyed by route name, operation named without version like getCity documents
+// routes of every version, e.g. v1.getCity, unless that version has its own v2.getCity
+type Operations map[string]Operation
+
+// find returns operation of route name
+func (o Operations) find(name string) (Operation, bool) {
+	if name == "" {
+		return Operation{}, false
+	}
+
+	if op, ok := o[name]; ok {
+		return op, true
+	}
+
+	_, unversioned, ok := strings.Cut(name, ".")
+	if !ok {
+		return Operation{}, false
+	}
+
+	op, ok := o[unversioned]
+
+	return op, ok
+}
+
+// Merge returns operations of all sets, later sets override earlier ones
+func Merge(sets ...Operations) Operations {
+	result := Operations{}
+
+	for _, set := range sets {
+		for name, op := range set {
+			result[name] = op
+		}
+	}
+
+	return result
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Document struct {
+	OpenAPI    string                       `json:"openapi"`
+	Info       Info                         `json:"info"`
+	Paths      map[string]map[string]*opDoc `json:"paths"`
+	Components components                   `json:"components"`
+}
+
+type components struct {
+	Schemas         map[string]*Schema           `json:"schemas"`
+	SecuritySchemes map[string]securitySchemeDoc `json:"securitySchemes"`
+}
+
+type securitySchemeDoc struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type opDoc struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Parameters  []parameterDoc         `json:"parameters,omitempty"`
+	RequestBody *requestBodyDoc        `json:"requestBody,omitempty"`
+	Responses   map[string]responseDoc `json:"responses"`
+	Security    []map[string][]string  `json:"security,omitempty"`
+}
+
+type parameterDoc struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type requestBodyDoc struct {
+	Required bool                    `json:"required"`
+	Content  map[string]mediaTypeDoc `json:"content"`
+}
+
+type responseDoc struct {
+	Description string                  `json:"description"`
+	Content     map[string]mediaTypeDoc `json:"content,omitempty"`
+}
+
+type mediaTypeDoc struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is subset of JSON schema used by OpenAPI 3.0
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+}
+
+// route is method and path template of one registered handler
+type route struct {
+	name     string
+	method   string
+	template string
+}
+
+func (r route) String() string {
+	return r.method + " " + r.template
+}
+
+// routes lists every route with methods and path, routes without methods are not endpoints
+func routes(router *mux.Router) ([]route, error) {
+	var result []route
+
+	err := router.Walk(func(rt *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := rt.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		template, err := rt.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+
+		for _, m := range methods {
+			result = append(result, route{
+				name:     rt.GetName(),
+				method:   m,
+				template: template,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not walk routes: %w", err)
+	}
+
+	return result, nil
+}
+
+// Undocumented returns routes which have no operation, e.g. "GET /city"
+func Undocumented(router *mux.Router, ops Operations) ([]string, error) {
+	all, err := routes(router)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	for _, r := range all {
+		if _, ok := ops.find(r.name); !ok {
+			result = append(result, r.String())
+		}
+	}
+
+	return result, nil
+}
+
+// templateVar matches {name} and {name:pattern} in mux templates
+var templateVar = regexp.MustCompile(`\{([^}:]+)(:([^}]*))?\}`)
+
+// Build describes documented routes, undocumented ones are left out
+func Build(info Info, router *mux.Router, ops Operations) (*Document, error) {
+	all, err := routes(router)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &builder{schemas: map[string]*Schema{}}
+
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   map[string]map[string]*opDoc{},
+		Components: components{
+			Schemas: b.schemas,
+			SecuritySchemes: map[string]securitySchemeDoc{
+				bearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+
+	for _, r := range all {
+		op, ok := ops.find(r.name)
+		if !ok {
+			continue
+		}
+
+		path, params := pathParameters(r.template)
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*opDoc{}
+		}
+
+		doc.Paths[path][strings.ToLower(r.method)] = b.operation(r, op, params)
+	}
+
+	return doc, nil
+}
+
+// pathParameters converts mux template to OpenAPI path, variables matching only digits are integers
+func pathParameters(template string) (string, []parameterDoc) {
+	var params []parameterDoc
+
+	for _, m := range templateVar.FindAllStringSubmatch(template, -1) {
+		schema := &Schema{Type: "string"}
+		if m[3] == "[0-9]+" || m[3] == `\d+` {
+			schema = &Schema{Type: "integer"}
+		}
+
+		params = append(params, parameterDoc{
+			Name:     m[1],
+			In:       "path",
+			Required: true,
+			Schema:   schema,
+		})
+	}
+
+	return templateVar.ReplaceAllString(template, "{$1}"), params
+}
+
+type builder struct {
+	schemas map[string]*Schema
+}
+
+func (b *builder) operation(r route, op Operation, params []parameterDoc) *opDoc {
+	result := &opDoc{
+		OperationID: r.name,
+		Summary:     op.Summary,
+		Tags:        op.Tags,
+		Parameters:  params,
+		Responses:   map[string]responseDoc{},
+	}
+
+	for _, q := range op.Query {
+		result.Parameters = append(result.Parameters, b.parameter("query", q))
+	}
+
+	for _, h := range op.Headers {
+		result.Parameters = append(result.Parameters, b.parameter("header", h))
+	}
+
+	if op.Request != nil {
+		result.RequestBody = &requestBodyDoc{
+			Required: true,
+			Content: map[string]mediaTypeDoc{
+				"application/json": {Schema: b.schema(reflect.TypeOf(op.Request))},
+			},
+		}
+	}
+
+	for status, resp := range op.Responses {
+		doc := responseDoc{Description: resp.Description}
+		if doc.Description == "" {
+			doc.Description = http.StatusText(status)
+		}
+
+		if resp.Body != nil {
+			contentTypes := []string{resp.ContentType}
+			if resp.ContentType == "" {
+				contentTypes = web.MediaTypes(resp.Body)
+			}
+
+			schema := b.schema(reflect.TypeOf(resp.Body))
+			doc.Content = map[string]mediaTypeDoc{}
+
+			for _, contentType := range contentTypes {
+				doc.Content[contentType] = mediaTypeDoc{Schema: schema}
+			}
+		}
+
+		result.Responses[strconv.Itoa(status)] = doc
+	}
+
+	for _, status := range op.Errors {
+		result.Responses[strconv.Itoa(status)] = responseDoc{
+			Description: http.StatusText(status),
+			Content: map[string]mediaTypeDoc{
+				"application/json": {Schema: &Schema{Ref: "#/components/schemas/ErrorResponse"}},
+			},
+		}
+	}
+
+	if len(op.Errors) > 0 {
+		b.schema(reflect.TypeOf(web.ErrorResponse{}))
+	}
+
+	if op.Secured {
+		result.Security = []map[string][]string{{bearerAuth: {}}}
+	}
+
+	return result
+}
+
+func (b *builder) parameter(in string, p Parameter) parameterDoc {
+	return parameterDoc{
+		Name:        p.Name,
+		In:          in,
+		Description: p.Description,
+		Required:    p.Required,
+		Schema:      b.schema(reflect.TypeOf(p.Example)),
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns inline schema for basic types and reference to component for structs
+func (b *builder) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		return b.component(t)
+	default:
+		return &Schema{}
+	}
+}
+
+// component registers struct schema under exported form of type name
+func (b *builder) component(t reflect.Type) *Schema {
+	name := componentName(t)
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+
+	if _, ok := b.schemas[name]; ok {
+		return ref
+	}
+
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.schemas[name] = s
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, omitEmpty := jsonName(field)
+		if name == "" {
+			continue
+		}
+
+		prop := b.schema(field.Type)
+		rules := strings.Split(field.Tag.Get("validate"), ",")
+
+		if contains(rules, "required") || (!omitEmpty && field.Type.Kind() != reflect.Ptr && !contains(rules, "omitempty")) {
+			s.Required = append(s.Required, name)
+		}
+
+		applyRules(prop, rules)
+
+		s.Properties[name] = prop
+	}
+
+	sort.Strings(s.Required)
+
+	return ref
+}
+
+func componentName(t reflect.Type) string {
+	name := []rune(t.Name())
+	if len(name) == 0 {
+		return "Object"
+	}
+
+	name[0] = unicode.ToUpper(name[0])
+
+	return string(name)
+}
+
+func jsonName(field reflect.StructField) (string, bool) {
+	parts := strings.Split(field.Tag.Get("json"), ",")
+	if parts[0] == "-" {
+		return "", false
+	}
+
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+
+	return name, contains(parts[1:], "omitempty")
+}
+
+// applyRules copies min, max and oneof validation rules to schema
+func applyRules(s *Schema, rules []string) {
+	for _, rule := range rules {
+		key, value, ok := strings.Cut(rule, "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "min", "max":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+
+			switch {
+			case s.Type == "string" && key == "min":
+				length := int(n)
+				s.MinLength = &length
+			case s.Type == "string":
+				length := int(n)
+				s.MaxLength = &length
+			case key == "min":
+				s.Minimum = &n
+			default:
+				s.Maximum = &n
+			}
+		case "oneof":
+			s.Enum = strings.Fields(value)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,155 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/ratelimit"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+type tokenSubjects interface {
+	TokenSubject(ctx context.Context, r *http.Request) (string, error)
+}
+
+// RateLimiter takes one token per request from bucket of request's client and route group
+type RateLimiter struct {
+	store  ratelimit.Store
+	users  tokenSubjects
+	logger app.Logger
+	cfg    atomic.Pointer[app.RateLimitConfig]
+}
+
+func NewRateLimiter(cfg app.RateLimitConfig, store ratelimit.Store, users tokenSubjects, logger app.Logger) *RateLimiter {
+	l := &RateLimiter{
+		store:  store,
+		users:  users,
+		logger: logger,
+	}
+	l.SetConfig(cfg)
+
+	return l
+}
+
+// SetConfig replaces limits, buckets are kept so clients can't reset them by waiting for reload
+func (l *RateLimiter) SetConfig(cfg app.RateLimitConfig) {
+	l.cfg.Store(&cfg)
+}
+
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := l.cfg.Load()
+		if !cfg.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		group := routeGroup(cfg, r.URL.Path)
+		if group.Limit.Requests <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := ipKey(r)
+		if !group.ByIP {
+			client = l.clientKey(r, cfg)
+		}
+
+		result, err := l.store.Take(r.Context(), group.Name+"|"+client, ratelimit.Limit{
+			Requests: group.Limit.Requests,
+			Period:   group.Limit.Period,
+			Burst:    group.Limit.Burst,
+		})
+		if err != nil {
+			// limiter failing must not take API down
+			l.logger.Error(app.ContextWithError(r.Context(), err), "rate limit store failed")
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", ceilSeconds(result.Reset))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+			TooManyRequests(w, "rate limit exceeded")
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeGroup returns first group with prefix of path or default group,
+// prefix without API version segment matches path of every version
+func routeGroup(cfg *app.RateLimitConfig, path string) app.RateLimitGroup {
+	unversioned := withoutVersion(path)
+
+	for _, g := range cfg.Groups {
+		for _, prefix := range g.PathPrefixes {
+			if strings.HasPrefix(path, prefix) || strings.HasPrefix(unversioned, prefix) {
+				return g
+			}
+		}
+	}
+
+	return app.RateLimitGroup{Name: "default", Limit: cfg.Default}
+}
+
+// withoutVersion removes first segment like v2 from path
+func withoutVersion(path string) string {
+	segments := strings.Split(path, "/")
+
+	for i, segment := range segments {
+		if versionName(segment) {
+			return strings.Join(append(segments[:i:i], segments[i+1:]...), "/")
+		}
+	}
+
+	return path
+}
+
+// clientKey identifies caller by accepted API key, subject of verified JWT or IP address,
+// callers whose token can't be verified share bucket of their IP
+func (l *RateLimiter) clientKey(r *http.Request, cfg *app.RateLimitConfig) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		for _, accepted := range cfg.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(accepted)) == 1 {
+				return "key:" + accepted
+			}
+		}
+	}
+
+	if l.users != nil && r.Header.Get("Authorization") != "" {
+		if username, err := l.users.TokenSubject(r.Context(), r); err == nil {
+			return "user:" + username
+		}
+	}
+
+	return ipKey(r)
+}
+
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
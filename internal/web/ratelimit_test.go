@@ -0,0 +1,130 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+	"github.com/strax84mb/go-travel-reactive/internal/ratelimit"
+)
+
+// subjects verifies tokens like "Bearer valid:<username>", every other token is forged
+type subjects struct{}
+
+func (subjects) TokenSubject(_ context.Context, r *http.Request) (string, error) {
+	if username, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer valid:"); ok {
+		return username, nil
+	}
+
+	return "", errors.New("invalid token")
+}
+
+func newTestLimiter() http.Handler {
+	cfg := app.RateLimitConfig{
+		Enabled: true,
+		APIKeys: []string{"partner"},
+		Default: app.RateLimit{Requests: 100, Period: time.Minute, Burst: 100},
+		Groups: []app.RateLimitGroup{{
+			Name:         "login",
+			PathPrefixes: []string{"/gotravel/reactivex/user/login"},
+			Limit:        app.RateLimit{Requests: 2, Period: time.Minute, Burst: 2},
+			ByIP:         true,
+		}, {
+			Name:         "webhooks",
+			PathPrefixes: []string{"/gotravel/reactivex/webhooks"},
+			Limit:        app.RateLimit{Requests: 2, Period: time.Minute, Burst: 2},
+		}},
+	}
+
+	limiter := NewRateLimiter(cfg, ratelimit.NewMemoryStore(), subjects{}, app.NewLogger(app.ErrorSeverity, app.NewMemorySink()))
+
+	return limiter.Middleware(okHandler)
+}
+
+func TestRateLimitGroupMatchesEveryVersion(t *testing.T) {
+	handler := newTestLimiter()
+
+	for _, path := range []string{"/gotravel/reactivex/v1/user/login", "/gotravel/reactivex/v2/user/login"} {
+		if rec := serve(handler, http.MethodPost, path, nil); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "2" {
+			t.Fatalf("%s: expected login limit, got %d with limit %s", path, rec.Code, rec.Header().Get("RateLimit-Limit"))
+		}
+	}
+
+	rec := serve(handler, http.MethodPost, "/gotravel/reactivex/v3/user/login", nil)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After, got %d", rec.Code)
+	}
+
+	if rec = serve(handler, http.MethodPost, "/gotravel/reactivex/v1/city", nil); rec.Header().Get("RateLimit-Limit") != "100" {
+		t.Errorf("expected default limit, got %s", rec.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestRateLimitClients(t *testing.T) {
+	handler := newTestLimiter()
+	path := "/gotravel/reactivex/v1/webhooks"
+
+	for i := 0; i < 2; i++ {
+		serve(handler, http.MethodPost, path, nil)
+	}
+
+	if rec := serve(handler, http.MethodPost, path, nil); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected IP to be limited, got %d", rec.Code)
+	}
+
+	// the same IP gets separate buckets for verified user and accepted API key
+	for _, headers := range []map[string]string{
+		{"Authorization": "Bearer valid:first"},
+		{APIKeyHeader: "partner"},
+	} {
+		if rec := serve(handler, http.MethodPost, path, headers); rec.Code != http.StatusOK {
+			t.Errorf("%v: expected own bucket, got %d", headers, rec.Code)
+		}
+	}
+
+	// forged token and unknown API key fall back to IP
+	for _, headers := range []map[string]string{
+		{"Authorization": "Bearer forged:first"},
+		{"Authorization": "Bearer forged:" + t.Name()},
+		{APIKeyHeader: "guess"},
+	} {
+		if rec := serve(handler, http.MethodPost, path, headers); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("%v: expected IP bucket, got %d", headers, rec.Code)
+		}
+	}
+}
+
+func TestRateLimitGroupByIP(t *testing.T) {
+	handler := newTestLimiter()
+	path := "/gotravel/reactivex/v1/user/login"
+
+	for i := 0; i < 2; i++ {
+		serve(handler, http.MethodPost, path, nil)
+	}
+
+	// neither verified token nor API key escapes limit of unauthenticated route
+	for _, headers := range []map[string]string{
+		{"Authorization": "Bearer valid:first"},
+		{APIKeyHeader: "partner"},
+	} {
+		if rec := serve(handler, http.MethodPost, path, headers); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("%v: expected IP bucket, got %d", headers, rec.Code)
+		}
+	}
+}
+
+func TestWithoutVersion(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/gotravel/reactivex/v1/user/login": "/gotravel/reactivex/user/login",
+		"/gotravel/reactivex/user/login":    "/gotravel/reactivex/user/login",
+		"/gotravel/reactivex/vip/user":      "/gotravel/reactivex/vip/user",
+	} {
+		if got := withoutVersion(path); got != expected {
+			t.Errorf("withoutVersion(%s) = %s, expected %s", path, got, expected)
+		}
+	}
+}
@@ -5,22 +5,58 @@ import (
 	"net/http"
 )
 
-func Ok(w http.ResponseWriter, payload interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(payload)
+func Ok(w http.ResponseWriter, r *http.Request, payload interface{}) {
+	Respond(w, r, http.StatusOK, payload)
 }
 
-func Created(w http.ResponseWriter, payload interface{}) {
+// JSON writes payload with any status without negotiating format, for responses read by tools
+// which expect JSON, e.g. health probes
+func JSON(w http.ResponseWriter, status int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
+func Created(w http.ResponseWriter, r *http.Request, payload interface{}) {
+	Respond(w, r, http.StatusCreated, payload)
+}
+
 func BadRequest(w http.ResponseWriter, message string, details map[string][]string) {
 	writeError(w, http.StatusBadRequest, message, details)
 }
 
+func TooManyRequests(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusTooManyRequests, message, nil)
+}
+
+func Unauthorized(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusUnauthorized, message, nil)
+}
+
+func Forbidden(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusForbidden, message, nil)
+}
+
+func NotFound(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusNotFound, message, nil)
+}
+
+func Conflict(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusConflict, message, nil)
+}
+
+func NoContent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func PreconditionFailed(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusPreconditionFailed, message, nil)
+}
+
+func PreconditionRequired(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusPreconditionRequired, message, nil)
+}
+
 func InternalServerError(w http.ResponseWriter, message string, details map[string][]string) {
 	writeError(w, http.StatusInternalServerError, message, details)
 }
@@ -28,13 +64,16 @@ func InternalServerError(w http.ResponseWriter, message string, details map[stri
 func writeError(w http.ResponseWriter, status int, message string, details map[string][]string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(errorResponse{
-		Message: message,
-		Details: details,
+	_ = json.NewEncoder(w).Encode(ErrorResponse{
+		Message:   message,
+		Details:   details,
+		RequestID: w.Header().Get(RequestIDHeader),
 	})
 }
 
-type errorResponse struct {
-	Message string              `json:"message"`
-	Details map[string][]string `json:"details,omitempty"`
+// ErrorResponse is body of every error response
+type ErrorResponse struct {
+	Message   string              `json:"message"`
+	Details   map[string][]string `json:"details,omitempty"`
+	RequestID string              `json:"requestId,omitempty"`
 }
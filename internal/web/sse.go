@@ -0,0 +1,84 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	EventStreamType = "text/event-stream"
+	// eventWriteTimeout replaces server WriteTimeout, which would end long-lived streams,
+	// clients which stop reading are still disconnected
+	eventWriteTimeout = 10 * time.Second
+	// eventRetry tells browsers how long to wait before reconnecting
+	eventRetry = 3 * time.Second
+)
+
+// EventWriter sends server-sent events, every event is flushed right away
+type EventWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// NewEventWriter starts event stream response
+func NewEventWriter(w http.ResponseWriter) (*EventWriter, error) {
+	e := &EventWriter{w: w, rc: http.NewResponseController(w)}
+
+	h := w.Header()
+	h.Set("Content-Type", EventStreamType)
+	h.Set("Cache-Control", "no-cache")
+	// proxies like nginx would otherwise buffer events
+	h.Set("X-Accel-Buffering", "no")
+
+	if err := e.extendDeadline(); err != nil {
+		return nil, err
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	return e, e.write(fmt.Sprintf("retry: %d\n\n", eventRetry.Milliseconds()))
+}
+
+// Event sends data as JSON, empty id leaves Last-Event-ID of client as it is
+func (e *EventWriter) Event(id, name string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+
+	if id != "" {
+		sb.WriteString("id: " + id + "\n")
+	}
+
+	sb.WriteString("event: " + name + "\n")
+	sb.WriteString("data: " + string(body) + "\n\n")
+
+	return e.write(sb.String())
+}
+
+func (e *EventWriter) write(message string) error {
+	if err := e.extendDeadline(); err != nil {
+		return err
+	}
+
+	if _, err := e.w.Write([]byte(message)); err != nil {
+		return err
+	}
+
+	return e.rc.Flush()
+}
+
+func (e *EventWriter) extendDeadline() error {
+	err := e.rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+
+	return err
+}
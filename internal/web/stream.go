@@ -0,0 +1,139 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// streamWriteTimeout replaces server WriteTimeout for every item, long lists are not cut off
+// while clients which stop reading are still disconnected
+const streamWriteTimeout = 10 * time.Second
+
+var ndjsonTypes = []string{"application/x-ndjson", "application/ndjson"}
+
+// StreamWriter sends list items as soon as they are produced and flushes after every item,
+// slow clients slow down producer instead of response being buffered
+type StreamWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	ndjson  bool
+	started bool
+	count   int
+}
+
+// NewStreamWriter returns writer when most preferred accepted media type is NDJSON
+// or application/json with stream=true parameter, other requests get buffered responses
+func NewStreamWriter(w http.ResponseWriter, r *http.Request) (*StreamWriter, bool) {
+	for _, mr := range parseAccept(r.Header.Values("Accept")) {
+		switch {
+		case contains(ndjsonTypes, mr.mediaType):
+			return &StreamWriter{w: w, rc: http.NewResponseController(w), ndjson: true}, true
+		case mr.mediaType == "application/json" && mr.params["stream"] == "true":
+			return &StreamWriter{w: w, rc: http.NewResponseController(w)}, true
+		}
+
+		for _, f := range formats {
+			for _, mt := range f.mediaTypes {
+				if mediaTypeMatches(mr.mediaType, mt) {
+					return nil, false
+				}
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// Started tells if response status was sent, errors after that can't change it
+func (s *StreamWriter) Started() bool {
+	return s.started
+}
+
+func (s *StreamWriter) start() {
+	s.started = true
+
+	s.w.Header().Add("Vary", "Accept")
+
+	if s.ndjson {
+		s.w.Header().Set("Content-Type", ndjsonTypes[0])
+	} else {
+		s.w.Header().Set("Content-Type", "application/json")
+	}
+
+	s.w.WriteHeader(http.StatusOK)
+
+	if !s.ndjson {
+		_, _ = s.w.Write([]byte("["))
+	}
+}
+
+// Write sends one item, error means that client went away or item could not be encoded
+func (s *StreamWriter) Write(item interface{}) error {
+	body, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	if err = s.extendDeadline(); err != nil {
+		return err
+	}
+
+	if !s.started {
+		s.start()
+	}
+
+	switch {
+	case s.ndjson:
+		body = append(body, '\n')
+	case s.count > 0:
+		body = append([]byte(",\n"), body...)
+	}
+
+	if _, err = s.w.Write(body); err != nil {
+		return err
+	}
+
+	s.count++
+
+	if err = s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	return nil
+}
+
+// Close ends stream. When err stopped producer after items were sent, JSON array is left unclosed
+// and NDJSON gets last line with ErrorResponse, so clients can tell that list is incomplete.
+func (s *StreamWriter) Close(err error) {
+	_ = s.extendDeadline()
+
+	if !s.started {
+		s.start()
+	}
+
+	switch {
+	case err == nil && s.ndjson:
+	case err == nil:
+		_, _ = s.w.Write([]byte("]\n"))
+	case s.ndjson:
+		body, _ := json.Marshal(ErrorResponse{
+			Message:   "stream interrupted",
+			Details:   map[string][]string{"error": {err.Error()}},
+			RequestID: s.w.Header().Get(RequestIDHeader),
+		})
+		_, _ = s.w.Write(append(body, '\n'))
+	}
+
+	_ = s.rc.Flush()
+}
+
+func (s *StreamWriter) extendDeadline() error {
+	err := s.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+
+	return err
+}
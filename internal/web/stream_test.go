@@ -0,0 +1,203 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deadlineRecorder records write deadlines set through http.ResponseController
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadlines []time.Time
+}
+
+func (d *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	d.deadlines = append(d.deadlines, deadline)
+	return nil
+}
+
+func streamRequest(accept string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/city", nil)
+	r.Header.Set("Accept", accept)
+
+	return r
+}
+
+func TestStreamWriterFraming(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		items       []interface{}
+		contentType string
+		body        string
+	}{
+		{name: "ndjson", accept: "application/x-ndjson", items: []interface{}{1, "two"}, contentType: "application/x-ndjson", body: "1\n\"two\"\n"},
+		{name: "ndjson empty", accept: "application/ndjson", contentType: "application/x-ndjson", body: ""},
+		{name: "json stream", accept: "application/json; stream=true", items: []interface{}{1, "two"}, contentType: "application/json", body: "[1,\n\"two\"]\n"},
+		{name: "json stream empty", accept: "application/json; stream=true", contentType: "application/json", body: "[]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			stream, ok := NewStreamWriter(rec, streamRequest(tt.accept))
+			if !ok {
+				t.Fatalf("%s is not streamed", tt.accept)
+			}
+
+			for _, item := range tt.items {
+				if err := stream.Write(item); err != nil {
+					t.Fatalf("Write failed: %s", err.Error())
+				}
+			}
+
+			stream.Close(nil)
+
+			if ct := rec.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("expected %s, got %s", tt.contentType, ct)
+			}
+
+			if body := rec.Body.String(); body != tt.body {
+				t.Errorf("expected %q, got %q", tt.body, body)
+			}
+		})
+	}
+}
+
+func TestStreamWriterNotSelected(t *testing.T) {
+	for _, accept := range []string{"application/json", "text/csv", "text/csv, application/x-ndjson;q=0.5"} {
+		if _, ok := NewStreamWriter(httptest.NewRecorder(), streamRequest(accept)); ok {
+			t.Errorf("%s is streamed", accept)
+		}
+	}
+}
+
+func TestStreamWriterErrorAfterPartialOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		check  func(t *testing.T, body string)
+	}{
+		{
+			name:   "ndjson ends with error line",
+			accept: "application/x-ndjson",
+			check: func(t *testing.T, body string) {
+				lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+				if len(lines) != 3 {
+					t.Fatalf("expected 2 items and error, got %q", body)
+				}
+
+				var resp ErrorResponse
+				if err := json.Unmarshal([]byte(lines[2]), &resp); err != nil {
+					t.Fatalf("last line is not ErrorResponse: %s", err.Error())
+				}
+
+				if resp.Message != "stream interrupted" || resp.Details["error"][0] != "boom" {
+					t.Errorf("unexpected error line %+v", resp)
+				}
+			},
+		},
+		{
+			name:   "json array is left open",
+			accept: "application/json; stream=true",
+			check: func(t *testing.T, body string) {
+				if body != "[1,\n2" {
+					t.Errorf("expected unclosed array, got %q", body)
+				}
+
+				var items []int
+				if err := json.Unmarshal([]byte(body), &items); err == nil {
+					t.Error("incomplete list is valid JSON")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			stream, _ := NewStreamWriter(rec, streamRequest(tt.accept))
+
+			for _, item := range []int{1, 2} {
+				if err := stream.Write(item); err != nil {
+					t.Fatalf("Write failed: %s", err.Error())
+				}
+			}
+
+			stream.Close(errors.New("boom"))
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected status sent with first item, got %d", rec.Code)
+			}
+
+			tt.check(t, rec.Body.String())
+		})
+	}
+}
+
+func TestStreamWriterExtendsDeadlinePerItem(t *testing.T) {
+	rec := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+	stream, _ := NewStreamWriter(rec, streamRequest("application/x-ndjson"))
+
+	for i := 0; i < 3; i++ {
+		if err := stream.Write(i); err != nil {
+			t.Fatalf("Write failed: %s", err.Error())
+		}
+	}
+
+	if len(rec.deadlines) != 3 {
+		t.Fatalf("expected deadline per item, got %d", len(rec.deadlines))
+	}
+
+	for i, deadline := range rec.deadlines {
+		if time.Until(deadline) <= 0 || (i > 0 && deadline.Before(rec.deadlines[i-1])) {
+			t.Errorf("deadline %d was not extended: %s", i, deadline)
+		}
+	}
+}
+
+func TestStreamWriterStopsProducerWhenClientGoesAway(t *testing.T) {
+	stopped := make(chan error, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stream, _ := NewStreamWriter(w, r)
+
+		for i := 0; ; i++ {
+			if err := stream.Write(strings.Repeat("x", 1024)); err != nil {
+				stopped <- err
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err.Error())
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for i := 0; i < 3 && scanner.Scan(); i++ {
+	}
+
+	_ = resp.Body.Close()
+
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Error("producer stopped without error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("producer kept writing after client went away")
+	}
+}
@@ -0,0 +1,197 @@
+package web
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+)
+
+const (
+	APIVersionHeader = "API-Version"
+	// versionParam is media type parameter of Accept header, e.g. application/json; version=2
+	versionParam = "version"
+)
+
+// Versions mounts each API version under prefix/vN and serves requests to prefix without version
+// by version from Accept header or configured default. Deprecated versions get Deprecation,
+// Sunset and successor Link headers.
+type Versions struct {
+	router   *mux.Router
+	prefix   string
+	versions []string
+	cfg      atomic.Pointer[app.VersionsConfig]
+}
+
+func NewVersions(router *mux.Router, prefix string, cfg app.VersionsConfig) *Versions {
+	v := &Versions{
+		router: router,
+		prefix: strings.TrimSuffix(prefix, "/"),
+	}
+	v.SetConfig(cfg)
+
+	return v
+}
+
+// SetConfig replaces default version and deprecations for subsequent requests
+func (v *Versions) SetConfig(cfg app.VersionsConfig) {
+	v.cfg.Store(&cfg)
+}
+
+// Version is router of one API version
+type Version struct {
+	*mux.Router
+	// Name is version like v2
+	Name string
+}
+
+// RouteName prefixes name with version, so that versions may register the same handlers
+// and still have unique route names, e.g. v2.getCity
+func (v *Version) RouteName(name string) string {
+	return v.Name + "." + name
+}
+
+// Register returns router for routes of version like v2
+func (v *Versions) Register(version string) *Version {
+	v.versions = append(v.versions, version)
+	sort.Slice(v.versions, func(i, j int) bool {
+		return versionNumber(v.versions[i]) < versionNumber(v.versions[j])
+	})
+
+	s := v.router.PathPrefix(v.prefix + "/" + version).Subrouter()
+	s.Use(v.headers(version))
+
+	return &Version{Router: s, Name: version}
+}
+
+func versionNumber(version string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	return n
+}
+
+func (v *Versions) registered(version string) bool {
+	return contains(v.versions, version)
+}
+
+// Default is configured default version or latest one if default is not registered
+func (v *Versions) Default() string {
+	if def := v.cfg.Load().Default; v.registered(def) {
+		return def
+	}
+
+	if len(v.versions) == 0 {
+		return ""
+	}
+
+	return v.versions[len(v.versions)-1]
+}
+
+func (v *Versions) headers(version string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(APIVersionHeader, version)
+
+			for _, d := range v.cfg.Load().Deprecated {
+				if d.Name != version {
+					continue
+				}
+
+				// RFC 9745 structured date
+				w.Header().Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+
+				if !d.Sunset.IsZero() {
+					w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+				}
+
+				if successor := v.successor(version); successor != "" {
+					w.Header().Add("Link", "<"+v.prefix+"/"+successor+`>; rel="successor-version"`)
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// successor is next newer registered version
+func (v *Versions) successor(version string) string {
+	for _, candidate := range v.versions {
+		if versionNumber(candidate) > versionNumber(version) {
+			return candidate
+		}
+	}
+
+	return ""
+}
+
+// Handler rewrites prefix/path to prefix/vN/path before next sees request, so that
+// routing, middlewares and route names are the same as for requests with version in path.
+// Unknown version in Accept header is rejected with 406.
+func (v *Versions) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, v.prefix+"/")
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		segment, _, _ := strings.Cut(rest, "/")
+		if v.registered(segment) || versionName(segment) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		version, requested := acceptedVersion(r.Header.Values("Accept"))
+		if !requested {
+			version = v.Default()
+		}
+
+		w.Header().Add("Vary", "Accept")
+
+		if !v.registered(version) {
+			writeError(w, http.StatusNotAcceptable, "unsupported API version "+version, map[string][]string{
+				"versions": v.versions,
+			})
+
+			return
+		}
+
+		rewritten := new(http.Request)
+		*rewritten = *r
+		u := *r.URL
+		u.Path = v.prefix + "/" + version + "/" + rest
+		u.RawPath = ""
+		rewritten.URL = &u
+
+		next.ServeHTTP(w, rewritten)
+	})
+}
+
+func versionName(segment string) bool {
+	n, err := strconv.Atoi(strings.TrimPrefix(segment, "v"))
+	return strings.HasPrefix(segment, "v") && err == nil && n > 0
+}
+
+// acceptedVersion reads version parameter from first media range having it,
+// both version=2 and version=v2 are accepted
+func acceptedVersion(accept []string) (string, bool) {
+	for _, header := range accept {
+		for _, mediaRange := range strings.Split(header, ",") {
+			_, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil {
+				continue
+			}
+
+			if version, ok := params[versionParam]; ok {
+				return "v" + strings.TrimPrefix(strings.ToLower(version), "v"), true
+			}
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,155 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/strax84mb/go-travel-reactive/internal/app"
+)
+
+// ErrUnsupportedMessage is returned by Socket.Read for binary messages and text which is not JSON
+var ErrUnsupportedMessage = errors.New("message has to be JSON text")
+
+// socketWriteTimeout limits writing of one message, client which stops reading is disconnected
+const socketWriteTimeout = 10 * time.Second
+
+// Socket is WebSocket connection which sends JSON messages from its own goroutine.
+// Send never blocks, connection which can't keep up is closed instead.
+type Socket struct {
+	conn *websocket.Conn
+	cfg  app.WebSocketConfig
+	send chan []byte
+	done chan struct{}
+	once sync.Once
+	// closeMessage is sent by writer before connection is closed
+	closeMessage []byte
+}
+
+// Upgrade switches request to WebSocket, on failure response was already written.
+// checkOrigin decides on cross-origin requests from browsers, see CORS.OriginAllowed.
+func Upgrade(w http.ResponseWriter, r *http.Request, cfg app.WebSocketConfig, checkOrigin func(r *http.Request) bool) (*Socket, error) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: checkOrigin,
+		Error: func(w http.ResponseWriter, _ *http.Request, status int, reason error) {
+			writeError(w, status, "websocket upgrade failed", map[string][]string{
+				"error": {reason.Error()},
+			})
+		},
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Socket{
+		conn: conn,
+		cfg:  cfg,
+		send: make(chan []byte, cfg.SendBuffer),
+		done: make(chan struct{}),
+	}
+
+	// server timeouts stay on hijacked connection, they are replaced by keepalive
+	conn.SetReadLimit(cfg.MaxMessageBytes)
+	_ = conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout))
+	})
+
+	go s.write()
+
+	return s, nil
+}
+
+// Read waits for next message from client and decodes it into v. Error is returned when connection
+// is closed, message is not JSON text or client did not answer pings for PongTimeout.
+func (s *Socket) Read(v interface{}) error {
+	kind, body, err := s.conn.ReadMessage()
+	if err != nil {
+		s.Close(websocket.CloseNormalClosure, "")
+		return err
+	}
+
+	// any message proves that client is alive
+	_ = s.conn.SetReadDeadline(time.Now().Add(s.cfg.PongTimeout))
+
+	if kind != websocket.TextMessage {
+		return ErrUnsupportedMessage
+	}
+
+	if err = json.Unmarshal(body, v); err != nil {
+		return ErrUnsupportedMessage
+	}
+
+	return nil
+}
+
+// Send queues message, it returns false when connection is closed or its buffer is full,
+// in which case connection gets closed with 1013 (try again later)
+func (s *Socket) Send(message interface{}) bool {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return false
+	}
+
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	select {
+	case s.send <- body:
+		return true
+	default:
+		s.Close(websocket.CloseTryAgainLater, "client is too slow")
+		return false
+	}
+}
+
+// Done is closed when connection is closing
+func (s *Socket) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close stops sending, already queued messages are dropped
+func (s *Socket) Close(code int, reason string) {
+	s.once.Do(func() {
+		s.closeMessage = websocket.FormatCloseMessage(code, reason)
+		close(s.done)
+	})
+}
+
+// write is the only writer of messages, control frames may be written concurrently
+func (s *Socket) write() {
+	ticker := time.NewTicker(s.cfg.PingInterval)
+
+	defer func() {
+		ticker.Stop()
+		_ = s.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-s.done:
+			_ = s.conn.WriteControl(websocket.CloseMessage, s.closeMessage, time.Now().Add(socketWriteTimeout))
+			return
+		case body := <-s.send:
+			_ = s.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+
+			if err := s.conn.WriteMessage(websocket.TextMessage, body); err != nil {
+				s.Close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteTimeout)); err != nil {
+				s.Close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		}
+	}
+}